@@ -6,8 +6,10 @@ import (
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/configs"
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/connector"
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/http_server"
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/logger"
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/system"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/tracing"
 	"github.com/spf13/cobra"
 
 	"go.uber.org/fx"
@@ -55,8 +57,10 @@ func run() error {
 			logger.GetLogger,
 			connector.New,
 			system.New,
+			http_server.New,
 		),
-		fx.Invoke(dispatcher.New),
+		fx.Invoke(tracing.New, dispatcher.New),
+		fx.StopTimeout(dispatcher.GetShutdownTimeout()+fx.DefaultTimeout),
 		fx.NopLogger,
 	).Run()
 
@@ -35,6 +35,10 @@ func GetConfig() *Config {
 		Events: make([]string, 0),
 	}
 
+	// Products are shared with other replicas if there are more than one dispatcher
+	viper.SetDefault("REPLICAS", 1)
+	config.Replicas = viper.GetInt("REPLICAS")
+
 	// Specify events from environment variable for watching
 	events := viper.GetStringSlice("EVENTS")
 	for _, e := range events {
@@ -0,0 +1,159 @@
+package dispatcher
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// AckTracker keeps messages which were received but not acked yet. Acking a message acknowledges all messages
+// before it with AckAll policy, so only the highest contiguous sequence whose events were stored can be acked.
+type AckTracker struct {
+	mutex   sync.Mutex
+	seqs    []uint64
+	pending map[uint64]*nats.Msg
+	done    map[uint64]bool
+}
+
+func NewAckTracker() *AckTracker {
+	return &AckTracker{
+		seqs:    make([]uint64, 0),
+		pending: make(map[uint64]*nats.Msg),
+		done:    make(map[uint64]bool),
+	}
+}
+
+func getStreamSeq(msg *nats.Msg) (uint64, bool) {
+
+	if msg == nil || msg.Sub == nil {
+		return 0, false
+	}
+
+	meta, err := msg.Metadata()
+	if err != nil {
+		return 0, false
+	}
+
+	return meta.Sequence.Stream, true
+}
+
+// Track registers message which was received from stream
+func (at *AckTracker) Track(msg *nats.Msg) {
+
+	seq, ok := getStreamSeq(msg)
+	if !ok {
+		return
+	}
+
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	// Redelivered
+	if _, ok := at.pending[seq]; ok {
+		at.pending[seq] = msg
+		return
+	}
+
+	at.pending[seq] = msg
+
+	// Sequence is usually increasing
+	n := len(at.seqs)
+	if n == 0 || at.seqs[n-1] < seq {
+		at.seqs = append(at.seqs, seq)
+		return
+	}
+
+	i := sort.Search(n, func(i int) bool {
+		return at.seqs[i] > seq
+	})
+
+	at.seqs = append(at.seqs, 0)
+	copy(at.seqs[i+1:], at.seqs[i:])
+	at.seqs[i] = seq
+}
+
+// Done marks message as completed, then acks the last message of contiguous completed messages.
+func (at *AckTracker) Done(msg *nats.Msg) {
+
+	seq, ok := getStreamSeq(msg)
+	if !ok {
+		return
+	}
+
+	at.mutex.Lock()
+
+	// Not tracked or discarded already
+	if _, ok := at.pending[seq]; !ok {
+		at.mutex.Unlock()
+		return
+	}
+
+	at.done[seq] = true
+
+	count := 0
+	for _, s := range at.seqs {
+		if !at.done[s] {
+			break
+		}
+
+		count++
+	}
+
+	if count == 0 {
+		at.mutex.Unlock()
+		return
+	}
+
+	last := at.pending[at.seqs[count-1]]
+
+	for _, s := range at.seqs[:count] {
+		delete(at.pending, s)
+		delete(at.done, s)
+	}
+
+	at.seqs = at.seqs[count:]
+
+	at.mutex.Unlock()
+
+	err := last.Ack()
+	if err != nil {
+		logger.Error("Failed to ack",
+			zap.Error(err),
+		)
+	}
+}
+
+// Pending returns the number of messages which are not acked yet
+func (at *AckTracker) Pending() int {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+	return len(at.seqs)
+}
+
+// NakAll asks server to redeliver all messages which were not acked yet, and stop tracking them.
+func (at *AckTracker) NakAll() {
+
+	at.mutex.Lock()
+
+	msgs := make([]*nats.Msg, 0, len(at.seqs))
+	for _, s := range at.seqs {
+		msgs = append(msgs, at.pending[s])
+	}
+
+	at.seqs = make([]uint64, 0)
+	at.pending = make(map[uint64]*nats.Msg)
+	at.done = make(map[uint64]bool)
+
+	at.mutex.Unlock()
+
+	for _, msg := range msgs {
+		err := msg.Nak()
+		if err != nil {
+			logger.Warn("Failed to nak",
+				zap.Error(err),
+			)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dispatch_state"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func CreateTestSourceMessages(t *testing.T, js nats.JetStreamContext, count int) []*nats.Msg {
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:     "GVT_default_DE",
+		Subjects: []string{"$GVT.default.EVENT.>"},
+	})
+	require.Nil(t, err)
+
+	_, err = js.AddConsumer("GVT_default_DE", &nats.ConsumerConfig{
+		Durable:   "source",
+		AckPolicy: nats.AckAllPolicy,
+		AckWait:   time.Minute,
+	})
+	require.Nil(t, err)
+
+	for i := 1; i <= count; i++ {
+		_, err := js.Publish("$GVT.default.EVENT.dataCreated", []byte(fmt.Sprintf("%d", i)))
+		require.Nil(t, err)
+	}
+
+	sub, err := js.PullSubscribe("", "source", nats.Bind("GVT_default_DE", "source"))
+	require.Nil(t, err)
+
+	t.Cleanup(func() {
+		sub.Unsubscribe()
+	})
+
+	msgs, err := sub.Fetch(count)
+	require.Nil(t, err)
+	require.Len(t, msgs, count)
+
+	return msgs
+}
+
+func GetTestAckFloor(t *testing.T, js nats.JetStreamContext) uint64 {
+
+	info, err := js.ConsumerInfo("GVT_default_DE", "source")
+	require.Nil(t, err)
+
+	return info.AckFloor.Stream
+}
+
+func TestAckTracker(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	client := CreateTestClient(t)
+	js, err := client.GetJetStream()
+	require.Nil(t, err)
+
+	msgs := CreateTestSourceMessages(t, js, 5)
+
+	at := NewAckTracker()
+	for _, msg := range msgs {
+		at.Track(msg)
+	}
+
+	assert.Equal(t, 5, at.Pending())
+
+	// Message before it is not completed yet
+	at.Done(msgs[2])
+	assert.Equal(t, uint64(0), GetTestAckFloor(t, js))
+
+	at.Done(msgs[0])
+	assert.Eventually(t, func() bool {
+		return GetTestAckFloor(t, js) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Contiguous up to the third message
+	at.Done(msgs[1])
+	assert.Eventually(t, func() bool {
+		return GetTestAckFloor(t, js) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, at.Pending())
+
+	// Rest of messages will be redelivered
+	at.NakAll()
+	assert.Equal(t, 0, at.Pending())
+
+	sub, err := js.PullSubscribe("", "source", nats.Bind("GVT_default_DE", "source"))
+	require.Nil(t, err)
+	defer sub.Unsubscribe()
+
+	redelivered, err := sub.Fetch(5, nats.MaxWait(time.Second))
+	require.Nil(t, err)
+	require.Len(t, redelivered, 2)
+	assert.Equal(t, "4", string(redelivered[0].Data))
+	assert.Equal(t, "5", string(redelivered[1].Data))
+
+	// Discarded messages are never acked by tracker
+	at.Done(msgs[3])
+	assert.Equal(t, uint64(3), GetTestAckFloor(t, js))
+}
+
+func CreateTestDispatchChunk(t *testing.T, p *Product, js nats.JetStreamContext, msgs []*nats.Msg) []interface{} {
+
+	chunk := make([]interface{}, 0, len(msgs))
+	for _, msg := range msgs {
+
+		output := &MessageOutput{
+			ID:  string(msg.Data),
+			Msg: nats.NewMsg("$GVT.default.DP.ack_test.0.EVENT.dataCreated"),
+		}
+		output.Msg.Data = msg.Data
+
+		m := NewMessage()
+		m.Publisher = js
+		m.Product = p
+		m.Msg = msg
+		m.Outputs = append(m.Outputs, output)
+
+		p.acks.Track(msg)
+
+		chunk = append(chunk, m)
+	}
+
+	return chunk
+}
+
+func TestProductAckAfterPublishFailure(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	client := CreateTestClient(t)
+	js, err := client.GetJetStream()
+	require.Nil(t, err)
+
+	msgs := CreateTestSourceMessages(t, js, 6)
+
+	// Product stream accepts first three events only
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:       "GVT_default_DP_ack_test",
+		Subjects:   []string{"$GVT.default.DP.ack_test.>"},
+		Duplicates: time.Minute,
+		MaxMsgs:    3,
+		Discard:    nats.DiscardNew,
+	})
+	require.Nil(t, err)
+
+	p := NewProduct(nil)
+	p.Name = "ack_test"
+	p.Enabled.Store(true)
+	p.IsRunning.Store(true)
+	p.breaker.SetPolicy(NewRetryPolicy(&product_setting.RetryPolicy{
+		InitialInterval: "10ms",
+		MaxInterval:     "10ms",
+	}))
+
+	chunk := CreateTestDispatchChunk(t, p, js, msgs)
+
+	done := make(chan struct{})
+	go func() {
+		p.dispatcherBufferHandler(chunk)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return p.breaker.State().Failures > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Only messages whose events were stored can be acked
+	assert.Eventually(t, func() bool {
+		return GetTestAckFloor(t, js) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3, p.acks.Pending())
+
+	// Product stream is able to store rest of events
+	_, err = js.UpdateStream(&nats.StreamConfig{
+		Name:       "GVT_default_DP_ack_test",
+		Subjects:   []string{"$GVT.default.DP.ack_test.>"},
+		Duplicates: time.Minute,
+		MaxMsgs:    -1,
+		Discard:    nats.DiscardNew,
+	})
+	require.Nil(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages were not dispatched")
+	}
+
+	info, err := js.StreamInfo("GVT_default_DP_ack_test")
+	require.Nil(t, err)
+	assert.Equal(t, uint64(6), info.State.Msgs)
+	assert.Equal(t, dispatch_state.BreakerClosed, p.breaker.State().Breaker)
+
+	assert.Eventually(t, func() bool {
+		return GetTestAckFloor(t, js) == 6
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestProductRedeliverAfterStop(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	client := CreateTestClient(t)
+	js, err := client.GetJetStream()
+	require.Nil(t, err)
+
+	msgs := CreateTestSourceMessages(t, js, 3)
+
+	p := NewProduct(nil)
+	p.Name = "ack_test"
+	p.Enabled.Store(true)
+	p.IsRunning.Store(true)
+	p.breaker.SetPolicy(NewRetryPolicy(&product_setting.RetryPolicy{
+		InitialInterval: "10ms",
+		MaxInterval:     "10ms",
+	}))
+
+	chunk := CreateTestDispatchChunk(t, p, js, msgs)
+
+	done := make(chan struct{})
+	go func() {
+		p.dispatcherBufferHandler(chunk)
+		close(done)
+	}()
+
+	// Product stream doesn't exist
+	require.Eventually(t, func() bool {
+		return p.breaker.State().Failures > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Nil(t, p.deactivate())
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not stopped")
+	}
+
+	assert.Equal(t, uint64(0), GetTestAckFloor(t, js))
+
+	// Nothing was lost
+	sub, err := js.PullSubscribe("", "source", nats.Bind("GVT_default_DE", "source"))
+	require.Nil(t, err)
+	defer sub.Unsubscribe()
+
+	redelivered, err := sub.Fetch(3, nats.MaxWait(time.Second))
+	require.Nil(t, err)
+	assert.Len(t, redelivered, 3)
+}
@@ -3,7 +3,7 @@ package dispatcher
 import (
 	"testing"
 
-	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
 	"go.uber.org/zap"
 )
 
@@ -15,7 +15,7 @@ func BenchmarkProcessor_PassThrough(b *testing.B) {
 	results := make(chan interface{}, 1024)
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			c, _ := msg.ProductEvent.GetContent()
+			c, _ := msg.Outputs[0].ProductEvent.GetContent()
 			msg.Reset()
 			results <- c
 		}),
@@ -25,7 +25,7 @@ func BenchmarkProcessor_PassThrough(b *testing.B) {
 	// Preparing product
 	r := CreateTestProductRule()
 	setting := CreateTestProductSetting()
-	setting.Rules = map[string]*product_sdk.Rule{
+	setting.Rules = map[string]*product_setting.Rule{
 		"testRule": r,
 	}
 
@@ -66,7 +66,7 @@ func BenchmarkProcessor_Normal(b *testing.B) {
 	results := make(chan interface{}, 1024)
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			c, _ := msg.ProductEvent.GetContent()
+			c, _ := msg.Outputs[0].ProductEvent.GetContent()
 			msg.Reset()
 			results <- c
 		}),
@@ -75,13 +75,13 @@ func BenchmarkProcessor_Normal(b *testing.B) {
 
 	// Preparing product
 	r := CreateTestProductRule()
-	r.HandlerConfig = &product_sdk.HandlerConfig{
+	r.HandlerConfig = &product_setting.HandlerConfig{
 		Type:   "script",
 		Script: `return  source`,
 	}
 
 	setting := CreateTestProductSetting()
-	setting.Rules = map[string]*product_sdk.Rule{
+	setting.Rules = map[string]*product_setting.Rule{
 		"testRule": r,
 	}
 
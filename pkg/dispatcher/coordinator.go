@@ -0,0 +1,449 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultCoordinatorLeaseTTL = 15 * time.Second
+)
+
+const (
+	coordinatorBucket = "GVT_%s_DISPATCHER"
+	memberKeyPrefix   = "members."
+	leaseKeyPrefix    = "leases."
+)
+
+// CoordinatorHandler is able to start and stop dispatching products which were assigned to replica
+type CoordinatorHandler interface {
+	Assignable() []string                      // Products which have to be dispatched by one of replicas
+	Acquired(name string) error                // Start dispatching product
+	Released(ctx context.Context, name string) // Stop dispatching product after events in progress were stored
+}
+
+// Coordinator shares products between dispatcher replicas. Every replica joins as a member and owns products
+// based on rendezvous hashing of live members. A product is dispatched only when replica holds its lease, so
+// events of a product are always processed by a single replica in order.
+type Coordinator struct {
+	client   *core.Client
+	domain   string
+	id       string
+	handler  CoordinatorHandler
+	kv       nats.KeyValue
+	leaseTTL time.Duration
+	members  map[string]bool
+	leases   map[string]uint64 // Revisions of leases which are held by this replica
+	mutex    sync.Mutex
+	trigger  chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+
+	// Bucket is created by provision if it's specified
+	provision func(name string, check func() (bool, error), create func() error) error
+}
+
+func NewCoordinator(client *core.Client, domain string, handler CoordinatorHandler) *Coordinator {
+
+	id, _ := uuid.NewUUID()
+
+	return &Coordinator{
+		client:  client,
+		domain:  domain,
+		id:      id.String(),
+		handler: handler,
+		members: make(map[string]bool),
+		leases:  make(map[string]uint64),
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+func (c *Coordinator) Init() error {
+
+	viper.SetDefault("dispatcher.lease_ttl", DefaultCoordinatorLeaseTTL)
+
+	leaseTTL := viper.GetDuration("dispatcher.lease_ttl")
+
+	js, err := c.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	bucket := fmt.Sprintf(coordinatorBucket, c.domain)
+
+	// Members and leases expire if they were not renewed in time
+	kv, err := assertKeyValue(js, c.provision, &nats.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Gravity dispatcher coordination",
+		History:     1,
+		TTL:         leaseTTL,
+		Replicas:    3,
+	})
+	if err != nil {
+		return err
+	}
+
+	// All replicas have to follow TTL of bucket
+	status, err := kv.Status()
+	if err != nil {
+		return err
+	}
+
+	c.kv = kv
+	c.leaseTTL = status.TTL()
+
+	logger.Info("Initialized coordinator",
+		zap.String("replica", c.id),
+		zap.String("bucket", bucket),
+		zap.Duration("lease_ttl", c.leaseTTL),
+	)
+
+	return nil
+}
+
+// ID returns identity of replica
+func (c *Coordinator) ID() string {
+	return c.id
+}
+
+// Start joins as a member and keeps balancing products with other replicas
+func (c *Coordinator) Start() error {
+
+	watcher, err := c.kv.Watch(memberKeyPrefix + "*")
+	if err != nil {
+		return err
+	}
+
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+
+	c.rebalance()
+
+	go func() {
+
+		defer close(c.done)
+		defer watcher.Stop()
+
+		ticker := time.NewTicker(c.leaseTTL / 3)
+		defer ticker.Stop()
+
+		updates := watcher.Updates()
+
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			case <-c.trigger:
+			case entry, ok := <-updates:
+
+				// Watcher was closed, keep balancing by ticker
+				if !ok {
+					updates = nil
+					continue
+				}
+
+				// Heartbeats of known members don't change assignment
+				if entry == nil || !c.isMembershipChanged(entry) {
+					continue
+				}
+			}
+
+			c.rebalance()
+		}
+	}()
+
+	return nil
+}
+
+// Trigger balances products as soon as possible, it should be called after products were changed
+func (c *Coordinator) Trigger() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Leave stops dispatching all products and releases them for other replicas
+func (c *Coordinator) Leave(ctx context.Context) {
+
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	logger.Info("Leaving coordination",
+		zap.String("replica", c.id),
+		zap.Int("leases", len(c.leases)),
+	)
+
+	var wg sync.WaitGroup
+	for name := range c.leases {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			c.handler.Released(ctx, name)
+		}(name)
+	}
+
+	wg.Wait()
+
+	for name, rev := range c.leases {
+		c.releaseLease(name, rev)
+	}
+
+	err := c.kv.Delete(memberKeyPrefix + c.id)
+	if err != nil {
+		logger.Warn("Failed to leave",
+			zap.String("replica", c.id),
+			zap.Error(err),
+		)
+	}
+}
+
+func (c *Coordinator) isMembershipChanged(entry nats.KeyValueEntry) bool {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	id := strings.TrimPrefix(entry.Key(), memberKeyPrefix)
+
+	if entry.Operation() != nats.KeyValuePut {
+		return c.members[id]
+	}
+
+	return !c.members[id]
+}
+
+func (c *Coordinator) listMembers() []string {
+
+	members := []string{c.id}
+
+	keys, err := c.kv.Keys()
+	if err != nil {
+		if err != nats.ErrNoKeysFound {
+			logger.Warn("Failed to list members",
+				zap.Error(err),
+			)
+		}
+
+		return members
+	}
+
+	for _, key := range keys {
+
+		if !strings.HasPrefix(key, memberKeyPrefix) {
+			continue
+		}
+
+		id := strings.TrimPrefix(key, memberKeyPrefix)
+		if id != c.id {
+			members = append(members, id)
+		}
+	}
+
+	sort.Strings(members)
+
+	return members
+}
+
+// owner returns member which product should be assigned to by rendezvous hashing, so only products of
+// a member which joined or left are moved.
+func owner(members []string, name string) string {
+
+	var selected string
+	var max uint64
+
+	for _, member := range members {
+
+		h := fnv.New64a()
+		h.Write([]byte(member))
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+
+		// FNV is not well distributed for keys with the same suffix
+		score := h.Sum64()
+		score ^= score >> 33
+		score *= 0xff51afd7ed558ccd
+		score ^= score >> 33
+		score *= 0xc4ceb9fe1a85ec53
+		score ^= score >> 33
+		if len(selected) == 0 || score > max {
+			selected = member
+			max = score
+		}
+	}
+
+	return selected
+}
+
+func (c *Coordinator) rebalance() {
+
+	c.mutex.Lock()
+
+	// Heartbeat
+	_, err := c.kv.Put(memberKeyPrefix+c.id, []byte(time.Now().Format(time.RFC3339)))
+	if err != nil {
+		logger.Warn("Failed to renew membership",
+			zap.String("replica", c.id),
+			zap.Error(err),
+		)
+	}
+
+	members := c.listMembers()
+
+	c.members = make(map[string]bool, len(members))
+	for _, member := range members {
+		c.members[member] = true
+	}
+
+	assigned := make(map[string]bool)
+	for _, name := range c.handler.Assignable() {
+		if owner(members, name) == c.id {
+			assigned[name] = true
+		}
+	}
+
+	// Renew leases before releasing products, so leases will not expire while draining others
+	releasing := make(map[string]uint64)
+	lost := make([]string, 0)
+	for name, rev := range c.leases {
+
+		// Hand over product to another replica
+		if !assigned[name] {
+			releasing[name] = rev
+			delete(c.leases, name)
+			continue
+		}
+
+		newRev, err := c.kv.Update(leaseKeyPrefix+name, []byte(c.id), rev)
+		if err != nil {
+
+			// Lease was expired and might be taken by others already
+			logger.Error("Lost lease of product",
+				zap.String("replica", c.id),
+				zap.String("product", name),
+				zap.Error(err),
+			)
+
+			lost = append(lost, name)
+			delete(c.leases, name)
+
+			continue
+		}
+
+		c.leases[name] = newRev
+	}
+
+	c.mutex.Unlock()
+
+	c.release(releasing, lost)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Acquire leases of products which were assigned to this replica
+	for name := range assigned {
+
+		if _, ok := c.leases[name]; ok {
+			continue
+		}
+
+		// Lease is still held by previous owner, it will be released or expired later
+		rev, err := c.kv.Create(leaseKeyPrefix+name, []byte(c.id))
+		if err != nil {
+			continue
+		}
+
+		logger.Info("Acquired product",
+			zap.String("replica", c.id),
+			zap.String("product", name),
+		)
+
+		err = c.handler.Acquired(name)
+		if err != nil {
+			logger.Error("Failed to start dispatching product",
+				zap.String("replica", c.id),
+				zap.String("product", name),
+				zap.Error(err),
+			)
+
+			// Try again next time
+			c.releaseLease(name, rev)
+			continue
+		}
+
+		c.leases[name] = rev
+	}
+}
+
+// release stops dispatching products in parallel. Products are drained before the shared deadline which is
+// earlier than expiration of leases, but products of lost leases are stopped immediately.
+func (c *Coordinator) release(releasing map[string]uint64, lost []string) {
+
+	if len(releasing) == 0 && len(lost) == 0 {
+		return
+	}
+
+	// Events in progress should be stored before lease expired
+	ctx, cancel := context.WithTimeout(context.Background(), c.leaseTTL/3)
+	defer cancel()
+
+	// Lease might be taken by others already
+	lostCtx, lostCancel := context.WithCancel(context.Background())
+	lostCancel()
+
+	var wg sync.WaitGroup
+	for name, rev := range releasing {
+
+		logger.Info("Releasing product",
+			zap.String("replica", c.id),
+			zap.String("product", name),
+		)
+
+		wg.Add(1)
+		go func(name string, rev uint64) {
+			defer wg.Done()
+			c.handler.Released(ctx, name)
+			c.releaseLease(name, rev)
+		}(name, rev)
+	}
+
+	for _, name := range lost {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			c.handler.Released(lostCtx, name)
+		}(name)
+	}
+
+	wg.Wait()
+}
+
+func (c *Coordinator) releaseLease(name string, rev uint64) {
+
+	// Lease which was taken by others should not be deleted
+	err := c.kv.Delete(leaseKeyPrefix+name, nats.LastRevision(rev))
+	if err != nil {
+		logger.Warn("Failed to release lease of product",
+			zap.String("replica", c.id),
+			zap.String("product", name),
+			zap.Error(err),
+		)
+	}
+}
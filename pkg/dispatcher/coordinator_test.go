@@ -0,0 +1,317 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/configs"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/system"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testCoordinatorHandler struct {
+	products     []string
+	owned        map[string]bool
+	lost         int           // Products which were stopped immediately
+	releaseDelay time.Duration // Time to drain product
+	mutex        sync.Mutex
+}
+
+func (h *testCoordinatorHandler) Assignable() []string {
+	return h.products
+}
+
+func (h *testCoordinatorHandler) Acquired(name string) error {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.owned[name] = true
+
+	return nil
+}
+
+func (h *testCoordinatorHandler) Released(ctx context.Context, name string) {
+
+	if ctx.Err() != nil {
+		h.mutex.Lock()
+		h.lost++
+		h.mutex.Unlock()
+	} else if h.releaseDelay > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(h.releaseDelay):
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.owned, name)
+}
+
+func (h *testCoordinatorHandler) Lost() int {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.lost
+}
+
+func (h *testCoordinatorHandler) Owned() map[string]bool {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	owned := make(map[string]bool, len(h.owned))
+	for name := range h.owned {
+		owned[name] = true
+	}
+
+	return owned
+}
+
+func TestCoordinator(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	viper.Set("dispatcher.lease_ttl", time.Second)
+	t.Cleanup(func() {
+		viper.Set("dispatcher.lease_ttl", DefaultCoordinatorLeaseTTL)
+	})
+
+	client := CreateTestClient(t)
+
+	products := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		products = append(products, fmt.Sprintf("product_%d", i))
+	}
+
+	handlers := make([]*testCoordinatorHandler, 3)
+	coordinators := make([]*Coordinator, 3)
+	for i := range coordinators {
+		handlers[i] = &testCoordinatorHandler{
+			products: products,
+			owned:    make(map[string]bool),
+		}
+
+		coordinators[i] = NewCoordinator(client, "test", handlers[i])
+		require.Nil(t, coordinators[i].Init())
+		require.Nil(t, coordinators[i].Start())
+	}
+
+	// Every product is dispatched by exactly one replica
+	balanced := func(handlers []*testCoordinatorHandler) bool {
+
+		owners := make(map[string]int)
+		for _, h := range handlers {
+			for name := range h.Owned() {
+				owners[name]++
+			}
+		}
+
+		if len(owners) != len(products) {
+			return false
+		}
+
+		for _, count := range owners {
+			if count != 1 {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	require.Eventually(t, func() bool {
+
+		// Products should be shared with all replicas
+		for _, h := range handlers {
+			if len(h.Owned()) == 0 {
+				return false
+			}
+		}
+
+		return balanced(handlers)
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// Products of the replica which left are taken over by others
+	coordinators[0].Leave(context.Background())
+	assert.Empty(t, handlers[0].Owned())
+
+	require.Eventually(t, func() bool {
+		return balanced(handlers[1:])
+	}, 10*time.Second, 100*time.Millisecond)
+
+	coordinators[1].Leave(context.Background())
+
+	require.Eventually(t, func() bool {
+		return len(handlers[2].Owned()) == len(products)
+	}, 10*time.Second, 100*time.Millisecond)
+
+	coordinators[2].Leave(context.Background())
+}
+
+func TestCoordinatorSlowRelease(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	viper.Set("dispatcher.lease_ttl", time.Second)
+	t.Cleanup(func() {
+		viper.Set("dispatcher.lease_ttl", DefaultCoordinatorLeaseTTL)
+	})
+
+	client := CreateTestClient(t)
+
+	products := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		products = append(products, fmt.Sprintf("product_%d", i))
+	}
+
+	// Draining products takes until deadline
+	first := &testCoordinatorHandler{
+		products:     products,
+		owned:        make(map[string]bool),
+		releaseDelay: time.Minute,
+	}
+
+	c1 := NewCoordinator(client, "slow", first)
+	require.Nil(t, c1.Init())
+	require.Nil(t, c1.Start())
+
+	require.Eventually(t, func() bool {
+		return len(first.Owned()) == len(products)
+	}, 5*time.Second, 100*time.Millisecond)
+
+	second := &testCoordinatorHandler{
+		products: products,
+		owned:    make(map[string]bool),
+	}
+
+	c2 := NewCoordinator(client, "slow", second)
+	require.Nil(t, c2.Init())
+	require.Nil(t, c2.Start())
+
+	// Products are handed over in parallel without losing leases of others
+	require.Eventually(t, func() bool {
+
+		owned := first.Owned()
+		if len(owned) == 0 || len(owned)+len(second.Owned()) != len(products) {
+			return false
+		}
+
+		for name := range second.Owned() {
+			if owned[name] {
+				return false
+			}
+		}
+
+		return true
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// Leases of remaining products are still renewed
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 0, first.Lost())
+	assert.Equal(t, len(products), len(first.Owned())+len(second.Owned()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	c1.Leave(ctx)
+	c2.Leave(ctx)
+}
+
+func TestCoordinatorProvisionByOwner(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	viper.Set("dispatcher.lease_ttl", time.Second)
+	viper.Set("election.provision_timeout", time.Second)
+	t.Cleanup(func() {
+		viper.Set("dispatcher.lease_ttl", DefaultCoordinatorLeaseTTL)
+		viper.Set("election.provision_timeout", system.DefaultElectionProvisionTimeout)
+	})
+
+	CreateTestServer(t)
+
+	leader := StartTestDispatcher(t, &configs.Config{Replicas: 2})
+	require.True(t, leader.election.IsLeader())
+
+	replica := StartTestDispatcher(t, &configs.Config{Replicas: 2})
+	require.False(t, replica.election.IsLeader())
+
+	// Both replicas know each other
+	members := []string{leader.coordinator.ID(), replica.coordinator.ID()}
+	require.Eventually(t, func() bool {
+
+		for _, c := range []*Coordinator{leader.coordinator, replica.coordinator} {
+
+			c.mutex.Lock()
+			joined := c.members[members[0]] && c.members[members[1]]
+			c.mutex.Unlock()
+
+			if !joined {
+				return false
+			}
+		}
+
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// New product which is assigned to replica rather than leader
+	var name string
+	for i := 0; len(name) == 0; i++ {
+		candidate := fmt.Sprintf("owner_test_%d", i)
+		if owner(members, candidate) == replica.coordinator.ID() {
+			name = candidate
+		}
+	}
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = name
+	setting.Enabled = true
+	setting.Rules["testRule"] = CreateTestProductRule()
+
+	data, err := json.Marshal(setting)
+	require.Nil(t, err)
+
+	_, err = leader.productConfigStore.Put(setting.Name, data)
+	require.Nil(t, err)
+
+	// Owner creates consumer of product without waiting for leader
+	require.Eventually(t, func() bool {
+
+		p := replica.productManager.GetProduct(name)
+		if p == nil || !p.IsRunning.Load() || p.watcher == nil || !p.watcher.IsRunning() {
+			return false
+		}
+
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+
+	p := leader.productManager.GetProduct(name)
+	require.NotNil(t, p)
+	assert.True(t, p.standby.Load())
+	assert.False(t, p.IsRunning.Load())
+
+	js, err := replica.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	_, err = js.ConsumerInfo(fmt.Sprintf(domainStream, "default"), fmt.Sprintf(domainEventConsumer, "default", name))
+	assert.Nil(t, err)
+
+	// Both replicas are ready
+	code, _ := RequestTestHealth(t, leader.readyzHandler)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = RequestTestHealth(t, replica.readyzHandler)
+	assert.Equal(t, http.StatusOK, code)
+}
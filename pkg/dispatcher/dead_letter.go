@@ -0,0 +1,213 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/rule_manager"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/tracing"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultDeadLetterMaxStreamBytes = 1024 * 1024 * 1024  // 1GB
+	DefaultDeadLetterMaxStreamAge   = 30 * 24 * time.Hour // 30 days
+)
+
+const (
+	deadLetterStream  = "GVT_%s_DLQ_%s"
+	deadLetterSubject = "$GVT.%s.DLQ.%s"
+)
+
+// Stages of processing which are able to send event to dead-letter stream
+const (
+	DeadLetterStageParse     = "parse"
+	DeadLetterStageTransform = "transform"
+	DeadLetterStageConvert   = "convert"
+)
+
+// Headers of dead-letter message
+const (
+	DeadLetterHeaderEvent     = "Gravity-Dlq-Event"
+	DeadLetterHeaderRule      = "Gravity-Dlq-Rule"
+	DeadLetterHeaderStage     = "Gravity-Dlq-Stage"
+	DeadLetterHeaderError     = "Gravity-Dlq-Error"
+	DeadLetterHeaderSourceSeq = "Gravity-Dlq-Source-Seq"
+
+	// Replayed event will be handled by specific product only
+	DeadLetterHeaderTarget = "Gravity-Dlq-Target"
+)
+
+// Line breaks are not allowed in header value
+var deadLetterHeaderReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+func (pm *ProductManager) assertDeadLetterStream(name string) error {
+
+	viper.SetDefault("product.dlq.max_stream_bytes", DefaultDeadLetterMaxStreamBytes)
+	viper.SetDefault("product.dlq.max_stream_age", DefaultDeadLetterMaxStreamAge)
+
+	maxStreamBytes := viper.GetInt64("product.dlq.max_stream_bytes")
+	maxStreamAge := viper.GetDuration("product.dlq.max_stream_age")
+
+	if maxStreamAge <= 0 {
+		maxStreamAge = 0
+	}
+
+	// Preparing JetStream
+	js, err := pm.dispatcher.connector.GetClient().GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	domain := pm.dispatcher.connector.GetDomain()
+	streamName := fmt.Sprintf(deadLetterStream, domain, name)
+
+	// Check if the stream already exists
+	check := func() (bool, error) {
+		return streamExists(js, streamName)
+	}
+
+	return pm.dispatcher.provision(streamName, check, func() error {
+
+		subject := fmt.Sprintf(deadLetterSubject, domain, name)
+
+		logger.Info("Creating a new dead-letter stream...",
+			zap.String("product", name),
+			zap.String("stream", streamName),
+			zap.String("subject", subject),
+			zap.Int64("max_stream_bytes", maxStreamBytes),
+			zap.Duration("max_stream_age", maxStreamAge),
+		)
+
+		sc := &nats.StreamConfig{
+			Name:        streamName,
+			Description: "Gravity product dead-letter store",
+			Duplicates:  DefaultProductDuplicates,
+			Subjects: []string{
+				subject,
+			},
+			Retention:   nats.LimitsPolicy,
+			MaxBytes:    maxStreamBytes,
+			MaxAge:      maxStreamAge,
+			Compression: nats.S2Compression,
+			Replicas:    3,
+		}
+
+		_, err := js.AddStream(sc)
+		if err != nil {
+
+			// for single node
+			sc.Replicas = 1
+			_, err := js.AddStream(sc)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (pm *ProductManager) deleteDeadLetterStream(name string) error {
+
+	js, err := pm.dispatcher.connector.GetClient().GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	streamName := fmt.Sprintf(deadLetterStream, pm.dispatcher.connector.GetDomain(), name)
+	err = js.DeleteStream(streamName)
+	if err != nil && err != nats.ErrStreamNotFound {
+		return err
+	}
+
+	return nil
+}
+
+func (m *Message) fail(stage string, rule *rule_manager.Rule, err error) {
+
+	m.Ignore = true
+	m.FailedRule = rule
+	m.FailedStage = stage
+	m.Error = err
+
+	// Failures of testing rules are expected
+	if m.Product != nil && m.Product.dryRun {
+		return
+	}
+
+	ruleName := ""
+	if rule != nil {
+		ruleName = rule.Name
+	}
+
+	logger.Error("Failed to process event",
+		zap.String("event", m.Event),
+		zap.String("rule", ruleName),
+		zap.String("stage", stage),
+		zap.Error(err),
+	)
+
+	if m.Product != nil {
+		metrics.ProcessingFailures.WithLabelValues(m.Product.Name, stage).Inc()
+	}
+}
+
+func (m *Message) dispatchDeadLetter(ctx context.Context) error {
+
+	if m.Publisher == nil {
+		return nil
+	}
+
+	if !m.Product.Enabled.Load() {
+		return nil
+	}
+
+	ruleName := ""
+	if m.FailedRule != nil {
+		ruleName = m.FailedRule.Name
+	}
+
+	var seq uint64
+	var stream string
+	if m.Msg != nil {
+		meta, err := m.Msg.Metadata()
+		if err == nil {
+			seq = meta.Sequence.Stream
+			stream = meta.Stream
+		}
+	}
+
+	msg := nats.NewMsg(fmt.Sprintf(deadLetterSubject, m.Product.Domain, m.Product.Name))
+	msg.Data = m.Raw
+	msg.Header.Set(DeadLetterHeaderEvent, m.Event)
+	msg.Header.Set(DeadLetterHeaderRule, ruleName)
+	msg.Header.Set(DeadLetterHeaderStage, m.FailedStage)
+	msg.Header.Set(DeadLetterHeaderError, deadLetterHeaderReplacer.Replace(m.Error.Error()))
+	msg.Header.Set(DeadLetterHeaderSourceSeq, strconv.FormatUint(seq, 10))
+
+	// Trace will be continued when event is replayed
+	tracing.Inject(ctx, msg.Header)
+
+	// Redelivered source event is deduplicated, but events without source message are always stored
+	opts := make([]nats.PubOpt, 0, 1)
+	if seq > 0 {
+		opts = append(opts, nats.MsgId(fmt.Sprintf("%s.%s.%d", m.Product.Name, stream, seq)))
+	}
+
+	// Publish to dead-letter stream
+	future, err := m.Publisher.PublishMsgAsync(msg, opts...)
+	if err != nil {
+		return err
+	}
+
+	m.AckFuture = future
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDeadLetter(t *testing.T) {
+
+	d := CreateTestDispatcher(t)
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = "dlq_test"
+	setting.Enabled = true
+	setting.Rules["testRule"] = CreateTestProductRule()
+	setting.Rules["testRule"].Product = setting.Name
+	setting.Rules["testRule"].HandlerConfig = &product_setting.HandlerConfig{
+		Type:   "script",
+		Script: `throw new Error("line1\nline2")`,
+	}
+
+	data, err := json.Marshal(setting)
+	require.Nil(t, err)
+
+	_, err = d.productConfigStore.Put(setting.Name, data)
+	require.Nil(t, err)
+
+	defer metrics.DeleteProduct("dlq_test")
+
+	require.Eventually(t, func() bool {
+		code, report := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK && report.Products["dlq_test"] != nil && report.Products["dlq_test"].Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	js, err := d.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	raw, _ := json.Marshal(MessageRawData{
+		Event:      "dataCreated",
+		RawPayload: []byte(`{"id":101,"name":"fred"}`),
+	})
+
+	publish := func(target string) {
+
+		msg := nats.NewMsg("$GVT.default.EVENT.dataCreated")
+		msg.Data = raw
+
+		if len(target) > 0 {
+			msg.Header.Set(DeadLetterHeaderTarget, target)
+		}
+
+		_, err := js.PublishMsg(msg)
+		require.Nil(t, err)
+	}
+
+	waitDeadLetters := func(count uint64) {
+		require.Eventually(t, func() bool {
+			info, err := js.StreamInfo("GVT_default_DLQ_dlq_test")
+			return err == nil && info.State.Msgs == count
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	// Failed event goes to dead-letter stream
+	publish("")
+	waitDeadLetters(1)
+
+	msg, err := js.GetMsg("GVT_default_DLQ_dlq_test", 1)
+	require.Nil(t, err)
+	assert.Equal(t, raw, msg.Data)
+	assert.Equal(t, DeadLetterStageTransform, msg.Header.Get(DeadLetterHeaderStage))
+	assert.Contains(t, msg.Header.Get(DeadLetterHeaderError), "line1 line2")
+	assert.False(t, strings.ContainsAny(msg.Header.Get(DeadLetterHeaderError), "\r\n"))
+
+	// Event which was replayed for another product is ignored
+	publish("other_product")
+	publish("dlq_test")
+	waitDeadLetters(2)
+
+	require.Eventually(t, func() bool {
+		ci, err := js.ConsumerInfo("GVT_default", "GVT_default_DP_dlq_test")
+		return err == nil && ci.AckFloor.Stream == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	info, err := js.StreamInfo("GVT_default_DLQ_dlq_test")
+	require.Nil(t, err)
+	assert.Equal(t, uint64(2), info.State.Msgs)
+
+	msg, err = js.GetMsg("GVT_default_DLQ_dlq_test", info.State.LastSeq)
+	require.Nil(t, err)
+	assert.Equal(t, "3", msg.Header.Get(DeadLetterHeaderSourceSeq))
+}
+
+func TestDeadLetterWithoutSource(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	client := CreateTestClient(t)
+	js, err := client.GetJetStream()
+	require.Nil(t, err)
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:       "GVT_default_DLQ_raw_test",
+		Subjects:   []string{"$GVT.default.DLQ.raw_test"},
+		Duplicates: time.Minute,
+	})
+	require.Nil(t, err)
+
+	p := NewProduct(nil)
+	p.Domain = "default"
+	p.Name = "raw_test"
+	p.Enabled.Store(true)
+
+	// Raw events which were not received from stream have no sequence, but none of them is deduplicated
+	for i := 0; i < 3; i++ {
+
+		m := NewMessage()
+		m.Publisher = js
+		m.Product = p
+		m.Event = "dataCreated"
+		m.Raw = []byte(`{"id":101}`)
+		m.FailedStage = DeadLetterStageTransform
+		m.Error = errors.New("failed")
+
+		require.Nil(t, m.dispatchDeadLetter(context.Background()))
+
+		select {
+		case <-m.AckFuture.Ok():
+		case err := <-m.AckFuture.Err():
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("dead-letter was not stored")
+		}
+	}
+
+	info, err := js.StreamInfo("GVT_default_DLQ_raw_test")
+	require.Nil(t, err)
+	assert.Equal(t, uint64(3), info.State.Msgs)
+}
@@ -2,19 +2,28 @@ package dispatcher
 
 import (
 	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/configs"
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/connector"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/http_server"
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/system"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/config_store"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
-	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
+const (
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
 var logger *zap.Logger
@@ -26,24 +35,34 @@ type Dispatcher struct {
 	connector          *connector.Connector
 	productConfigStore *config_store.ConfigStore
 	productManager     *ProductManager
+	coordinator        *Coordinator
+	system             *system.System
+	election           *system.Election
+	configStoreSynced  atomic.Bool
 }
 
-func New(lifecycle fx.Lifecycle, config *configs.Config, l *zap.Logger, c *connector.Connector, s *system.System) *Dispatcher {
+func New(lifecycle fx.Lifecycle, config *configs.Config, l *zap.Logger, c *connector.Connector, s *system.System, hs *http_server.HTTPServer) *Dispatcher {
 
 	logger = l.Named("Dispatcher")
 
 	d := &Dispatcher{
 		config:    config,
 		connector: c,
+		system:    s,
 	}
 
+	s.SetRuleTester(d)
+
+	hs.Handle("/healthz", http.HandlerFunc(d.healthzHandler))
+	hs.Handle("/readyz", http.HandlerFunc(d.readyzHandler))
+
 	lifecycle.Append(
 		fx.Hook{
 			OnStart: func(context.Context) error {
 				return d.initialize()
 			},
 			OnStop: func(ctx context.Context) error {
-				return nil
+				return d.shutdown(ctx)
 			},
 		},
 	)
@@ -57,6 +76,11 @@ func (d *Dispatcher) productSettingsUpdated(entry *config_store.ConfigEntry) {
 		zap.String("name", entry.Key),
 	)
 
+	// The last one of initial entries
+	if entry.Delta == 0 {
+		defer d.configStoreSynced.Store(true)
+	}
+
 	// Delete product
 	if entry.Operation == config_store.ConfigDelete {
 		logger.Info("Delete product",
@@ -67,7 +91,7 @@ func (d *Dispatcher) productSettingsUpdated(entry *config_store.ConfigEntry) {
 	}
 
 	// Parsing setting
-	var setting product_sdk.ProductSetting
+	var setting product_setting.ProductSetting
 	err := json.Unmarshal(entry.Value, &setting)
 	if err != nil {
 		logger.Error("Failed to sync:",
@@ -106,6 +130,24 @@ func (d *Dispatcher) initialize() error {
 	)
 	d.productManager = NewProductManager(d)
 
+	// Streams and consumers are provisioned by the leader of replicas
+	d.election = d.system.GetElection()
+
+	// Products are shared with other replicas
+	if d.config != nil && d.config.Replicas > 1 {
+
+		logger.Info("Initializing coordinator...",
+			zap.Int("replicas", d.config.Replicas),
+		)
+
+		d.coordinator = NewCoordinator(d.connector.GetClient(), d.connector.GetDomain(), d.productManager)
+		d.coordinator.provision = d.provision
+		err = d.coordinator.Init()
+		if err != nil {
+			return err
+		}
+	}
+
 	logger.Info("Initializing config store...")
 
 	err = d.productConfigStore.Init()
@@ -113,6 +155,144 @@ func (d *Dispatcher) initialize() error {
 		return err
 	}
 
+	err = d.checkConfigStoreSynced()
+	if err != nil {
+		return err
+	}
+
+	if d.coordinator != nil {
+		return d.coordinator.Start()
+	}
+
+	return nil
+}
+
+// provision creates resource if it doesn't exist, creation is serialized by the leader of replicas
+func (d *Dispatcher) provision(name string, check func() (bool, error), create func() error) error {
+
+	if d.election == nil {
+		return ensure(check, create)
+	}
+
+	return d.election.Provision(name, check, create)
+}
+
+// ensure creates resource if it doesn't exist
+func ensure(check func() (bool, error), create func() error) error {
+
+	exists, err := check()
+	if err != nil || exists {
+		return err
+	}
+
+	return create()
+}
+
+func streamExists(js nats.JetStreamContext, streamName string) (bool, error) {
+
+	_, err := js.StreamInfo(streamName)
+	if err != nil {
+		if err == nats.ErrStreamNotFound {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// assertKeyValue returns bucket, it's created by provision if it doesn't exist. Bucket with single replica
+// will be created if cluster is not available.
+func assertKeyValue(js nats.JetStreamContext, provision func(name string, check func() (bool, error), create func() error) error, cfg *nats.KeyValueConfig) (nats.KeyValue, error) {
+
+	check := func() (bool, error) {
+
+		_, err := js.KeyValue(cfg.Bucket)
+		if err != nil {
+			if err == nats.ErrBucketNotFound {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	create := func() error {
+
+		_, err := js.CreateKeyValue(cfg)
+		if err != nil {
+
+			// for single node
+			c := *cfg
+			c.Replicas = 1
+			_, err = js.CreateKeyValue(&c)
+		}
+
+		return err
+	}
+
+	var err error
+	if provision != nil {
+		err = provision(cfg.Bucket, check, create)
+	} else {
+		err = ensure(check, create)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return js.KeyValue(cfg.Bucket)
+}
+
+// GetShutdownTimeout returns how long to wait for events in progress when shutting down
+func GetShutdownTimeout() time.Duration {
+
+	viper.SetDefault("dispatcher.shutdown_timeout", DefaultShutdownTimeout)
+
+	return viper.GetDuration("dispatcher.shutdown_timeout")
+}
+
+func (d *Dispatcher) shutdown(ctx context.Context) error {
+
+	timeout := GetShutdownTimeout()
+
+	logger.Info("Shutting down...",
+		zap.Duration("timeout", timeout),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Hand over products to other replicas
+	if d.coordinator != nil {
+		d.coordinator.Leave(ctx)
+	}
+
+	// Stop receiving events and wait for events in progress to be stored and acked
+	if d.productManager != nil {
+		d.productManager.Drain(ctx)
+	}
+
+	// Make sure acks were sent to server before connection was closed
+	client := d.connector.GetClient()
+	if client != nil && client.GetConnection() != nil {
+		err := client.GetConnection().FlushWithContext(ctx)
+		if err != nil {
+			logger.Warn("Failed to flush acks",
+				zap.Error(err),
+			)
+		}
+	}
+
+	// Publishing is done
+	if d.publisher != nil {
+		d.publisher.Disconnect()
+	}
+
 	return nil
 }
 
@@ -0,0 +1,94 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownDrainsEvents(t *testing.T) {
+
+	d := CreateTestDispatcher(t)
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = "shutdown_test"
+	setting.Enabled = true
+	setting.Rules["testRule"] = CreateTestProductRule()
+	setting.Rules["testRule"].Product = setting.Name
+
+	data, err := json.Marshal(setting)
+	require.Nil(t, err)
+
+	_, err = d.productConfigStore.Put(setting.Name, data)
+	require.Nil(t, err)
+
+	defer metrics.DeleteProduct("shutdown_test")
+
+	require.Eventually(t, func() bool {
+		code, report := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK && report.Products["shutdown_test"] != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	js, err := d.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	// Publish events
+	total := 5000
+	for i := 1; i <= total; i++ {
+
+		raw, _ := json.Marshal(MessageRawData{
+			Event:      "dataCreated",
+			RawPayload: []byte(fmt.Sprintf(`{"id":%d,"name":"fred"}`, i)),
+		})
+
+		_, err := js.PublishAsync("$GVT.default.EVENT.dataCreated", raw)
+		require.Nil(t, err)
+	}
+
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+		t.Fatal("events were not published")
+	}
+
+	// Shutdown while events are in progress
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.EventsFetched.WithLabelValues("shutdown_test")) > 0
+	}, 5*time.Second, time.Millisecond)
+
+	require.Nil(t, d.shutdown(context.Background()))
+
+	p := d.productManager.GetProduct("shutdown_test")
+	assert.False(t, p.IsRunning.Load())
+	assert.False(t, p.watcher.IsRunning())
+	assert.Equal(t, 0, p.acks.Pending())
+
+	// Source messages were acked only if their events were stored
+	stream, err := js.StreamInfo("GVT_default_DP_shutdown_test")
+	require.Nil(t, err)
+	assert.Greater(t, stream.State.Msgs, uint64(0))
+
+	assert.Eventually(t, func() bool {
+		consumer, err := js.ConsumerInfo("GVT_default", "GVT_default_DP_shutdown_test")
+		require.Nil(t, err)
+		return consumer.AckFloor.Stream == stream.State.Msgs
+	}, time.Second, 10*time.Millisecond)
+
+	// Nothing will be fetched after shutdown
+	_, err = js.Publish("$GVT.default.EVENT.dataCreated", []byte(`{}`))
+	require.Nil(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+
+	info, err := js.StreamInfo("GVT_default_DP_shutdown_test")
+	require.Nil(t, err)
+	assert.Equal(t, stream.State.Msgs, info.State.Msgs)
+}
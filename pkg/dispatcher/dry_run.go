@@ -0,0 +1,129 @@
+package dispatcher
+
+import (
+	"fmt"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/rule_manager"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dry_run"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/BrobridgeOrg/schemer"
+)
+
+// TestRule processes sample events with rules of product setting, nothing will be published.
+func (d *Dispatcher) TestRule(setting *product_setting.ProductSetting, events []*dry_run.Event) ([]*dry_run.Result, error) {
+	return DryRun(d.connector.GetDomain(), setting, events)
+}
+
+// DryRun processes events in the same way as product does, then returns results instead of publishing them.
+func DryRun(domain string, setting *product_setting.ProductSetting, events []*dry_run.Event) ([]*dry_run.Result, error) {
+
+	p := &Product{
+		Domain: domain,
+		Name:   setting.Name,
+		dryRun: true,
+	}
+
+	p.Enabled.Store(true)
+	p.partitioner.Store(NewPartitioner(setting))
+
+	// Product schema
+	if setting.Schema != nil {
+		p.Schema = schemer.NewSchema()
+		err := schemer.Unmarshal(setting.Schema, p.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema of product: %w", err)
+		}
+	}
+
+	rm := rule_manager.NewRuleManager()
+	p.rules.Store(rm)
+
+	for _, r := range setting.Rules {
+		rule := rule_manager.NewRule(r)
+		rule.TargetSchema = p.Schema
+		err := rm.AddRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule \"%s\": %w", r.Name, err)
+		}
+	}
+
+	processor := &Processor{
+		domain: domain,
+	}
+
+	results := make([]*dry_run.Result, 0, len(events))
+	for _, e := range events {
+
+		raw, err := json.Marshal(MessageRawData{
+			Event:      e.Event,
+			RawPayload: e.Payload,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		m := NewMessage()
+		m.Event = e.Event
+		m.Product = p
+		m.Raw = raw
+
+		results = append(results, createDryRunResult(processor.process(m)))
+
+		m.Release()
+	}
+
+	return results, nil
+}
+
+func createDryRunResult(m *Message) *dry_run.Result {
+
+	result := &dry_run.Result{
+		Event:   m.Event,
+		Rules:   make([]string, 0, len(m.Rules)),
+		Outputs: make([]*dry_run.Output, 0, len(m.Outputs)),
+	}
+
+	for _, rule := range m.Rules {
+		result.Rules = append(result.Rules, rule.Name)
+	}
+
+	result.Matched = len(result.Rules) > 0
+
+	if m.Error != nil {
+
+		se := &dry_run.StageError{
+			Stage: m.FailedStage,
+			Error: m.Error.Error(),
+		}
+
+		if m.FailedRule != nil {
+			se.Rule = m.FailedRule.Name
+		}
+
+		result.Errors = append(result.Errors, se)
+	}
+
+	for _, output := range m.Outputs {
+
+		pe := output.ProductEvent
+
+		o := &dry_run.Output{
+			Subject:     output.Msg.Subject,
+			Partition:   output.Partition,
+			Event:       pe.EventName,
+			Method:      pe.Method.String(),
+			Table:       pe.Table,
+			PrimaryKeys: pe.PrimaryKeys,
+			PrimaryKey:  pe.PrimaryKey,
+		}
+
+		r, err := pe.GetContent()
+		if err == nil {
+			o.Payload = r.AsMap()
+		}
+
+		result.Outputs = append(result.Outputs, o)
+	}
+
+	return result
+}
@@ -0,0 +1,117 @@
+package dispatcher
+
+import (
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dry_run"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDryRun(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	setting := CreateTestProductSetting()
+	setting.Name = "dry_run_test"
+
+	rule := CreateTestProductRule()
+	rule.Product = "dry_run_test"
+	rule.Filter = &product_setting.Filter{
+		Conditions: []*product_setting.Condition{
+			{Field: "id", Operator: "gt", Value: 100},
+		},
+	}
+	rule.HandlerConfig = &product_setting.HandlerConfig{
+		Type:   "script",
+		Script: `if (source.name == 'bad') throw new Error('bad name'); return source`,
+	}
+
+	setting.Rules = map[string]*product_setting.Rule{
+		"testRule": rule,
+	}
+
+	results, err := DryRun("default", setting, []*dry_run.Event{
+		{Event: "dataCreated", Payload: []byte(`{"id":101,"name":"fred"}`)},
+		{Event: "dataCreated", Payload: []byte(`{"id":99,"name":"fred"}`)},
+		{Event: "dataCreated", Payload: []byte(`{"id":102,"name":"bad"}`)},
+		{Event: "dataCreated", Payload: []byte(`"broken"`)},
+		{Event: "dataUnknown", Payload: []byte(`{"id":101,"name":"fred"}`)},
+	})
+	require.Nil(t, err)
+	require.Len(t, results, 5)
+
+	// Matched
+	r := results[0]
+	assert.True(t, r.Matched)
+	assert.Equal(t, []string{"test_rule"}, r.Rules)
+	assert.Empty(t, r.Errors)
+	require.Len(t, r.Outputs, 1)
+
+	output := r.Outputs[0]
+	assert.Regexp(t, `^\$GVT\.default\.DP\.dry_run_test\.\d+\.EVENT\.dataCreated$`, output.Subject)
+	assert.Equal(t, "dataCreated", output.Event)
+	assert.Equal(t, "INSERT", output.Method)
+	assert.Equal(t, "dry_run_test", output.Table)
+	assert.Equal(t, []string{"id"}, output.PrimaryKeys)
+	assert.NotEmpty(t, output.PrimaryKey)
+	assert.Equal(t, int64(101), output.Payload["id"])
+	assert.Equal(t, "fred", output.Payload["name"])
+
+	// Same primary key goes to the same partition
+	again, err := DryRun("default", setting, []*dry_run.Event{
+		{Event: "dataCreated", Payload: []byte(`{"id":101,"name":"bob"}`)},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, output.Partition, again[0].Outputs[0].Partition)
+
+	// Filtered out
+	assert.False(t, results[1].Matched)
+	assert.Empty(t, results[1].Outputs)
+	assert.Empty(t, results[1].Errors)
+
+	// Failed to transform
+	assert.Empty(t, results[2].Outputs)
+	require.Len(t, results[2].Errors, 1)
+	assert.Equal(t, DeadLetterStageTransform, results[2].Errors[0].Stage)
+	assert.Equal(t, "test_rule", results[2].Errors[0].Rule)
+	assert.Contains(t, results[2].Errors[0].Error, "bad name")
+
+	// Failed to parse
+	require.Len(t, results[3].Errors, 1)
+	assert.Equal(t, DeadLetterStageParse, results[3].Errors[0].Stage)
+
+	// No rule for event
+	assert.False(t, results[4].Matched)
+	assert.Empty(t, results[4].Outputs)
+
+	// Testing doesn't affect metrics of product
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.EventsMatched.WithLabelValues("dry_run_test")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.ProcessingFailures.WithLabelValues("dry_run_test", DeadLetterStageTransform)))
+	metrics.DeleteProduct("dry_run_test")
+}
+
+func TestDryRunInvalidRule(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	setting := CreateTestProductSetting()
+
+	rule := CreateTestProductRule()
+	rule.HandlerConfig = &product_setting.HandlerConfig{
+		Type: "unknown",
+	}
+
+	setting.Rules = map[string]*product_setting.Rule{
+		"testRule": rule,
+	}
+
+	_, err := DryRun("default", setting, []*dry_run.Event{
+		{Event: "dataCreated", Payload: []byte(`{"id":101,"name":"fred"}`)},
+	})
+	assert.ErrorContains(t, err, "invalid rule \"test_rule\"")
+}
@@ -1,14 +1,24 @@
 package dispatcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/tracing"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
 	"github.com/nats-io/nats.go"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -25,6 +35,10 @@ const (
 	domainEventSubject = "$GVT.%s.EVENT.%s"
 )
 
+var (
+	ErrNoEventRegistered = errors.New("no event was registered")
+)
+
 type WatcherManager struct {
 	watchers map[string]*EventWatcher
 }
@@ -58,33 +72,46 @@ func NewEvent() *Event {
 type EventWatcher struct {
 	client  *core.Client
 	domain  string
+	product string
 	durable string
-	events  map[string]*Event
+	events  map[string]*Event // Registered events by subject
+	handler func(string, *nats.Msg)
 	sub     *nats.Subscription
-	running bool
+	running atomic.Bool
+	done    chan struct{}
+	mutex   sync.RWMutex
+
+	// Streams and consumers are created by provision if it's specified
+	provision func(name string, check func() (bool, error), create func() error) error
+
+	// Consumer is created by replica which holds lease of product instead of provision
+	leased bool
 }
 
-func NewEventWatcher(client *core.Client, domain string, durable string) *EventWatcher {
+func NewEventWatcher(client *core.Client, domain string, product string, durable string) *EventWatcher {
 	return &EventWatcher{
 		client:  client,
 		domain:  domain,
+		product: product,
 		durable: durable,
 		events:  make(map[string]*Event),
-		running: false,
 	}
 }
 
 func (ew *EventWatcher) RegisterEvent(name string) *Event {
 
-	if e, ok := ew.events[name]; ok {
+	subject := fmt.Sprintf(domainEventSubject, ew.domain, name)
+
+	ew.mutex.Lock()
+	defer ew.mutex.Unlock()
+
+	if e, ok := ew.events[subject]; ok {
 		return e
 	}
 
 	e := NewEvent()
 	e.Name = name
 
-	subject := fmt.Sprintf(domainEventSubject, ew.domain, name)
-
 	logger.Info("Registered event",
 		zap.String("subject", subject),
 	)
@@ -96,26 +123,51 @@ func (ew *EventWatcher) RegisterEvent(name string) *Event {
 
 func (ew *EventWatcher) UnregisterEvent(name string) {
 
-	if _, ok := ew.events[name]; !ok {
-		return
-	}
+	subject := fmt.Sprintf(domainEventSubject, ew.domain, name)
+
+	ew.mutex.Lock()
+	defer ew.mutex.Unlock()
 
-	delete(ew.events, name)
+	delete(ew.events, subject)
 }
 
 func (ew *EventWatcher) PurgeEvent() {
+
+	ew.mutex.Lock()
+	defer ew.mutex.Unlock()
+
 	ew.events = make(map[string]*Event)
 }
 
-func (ew *EventWatcher) GetEvent(name string) *Event {
+// GetEvent returns registered event by subject
+func (ew *EventWatcher) GetEvent(subject string) *Event {
+
+	ew.mutex.RLock()
+	defer ew.mutex.RUnlock()
 
-	if v, ok := ew.events[name]; ok {
+	if v, ok := ew.events[subject]; ok {
 		return v
 	}
 
 	return nil
 }
 
+// Subjects returns subjects of registered events in order
+func (ew *EventWatcher) Subjects() []string {
+
+	ew.mutex.RLock()
+	defer ew.mutex.RUnlock()
+
+	subjects := make([]string, 0, len(ew.events))
+	for subject := range ew.events {
+		subjects = append(subjects, subject)
+	}
+
+	sort.Strings(subjects)
+
+	return subjects
+}
+
 func (ew *EventWatcher) Init() error {
 
 	viper.SetDefault("eventwatcher.buffer_size", DefaultEventWatcherBufferSize)
@@ -153,24 +205,18 @@ func (ew *EventWatcher) Init() error {
 		zap.String("stream", streamName),
 	)
 
+	subject := fmt.Sprintf(domainEventSubject, ew.domain, "*")
+
 	// Check if the stream already exists
-	stream, err := js.StreamInfo(streamName)
-	if err != nil {
-		if err != nats.ErrStreamNotFound {
-			logger.Error("Failed to get stream information",
-				zap.Error(err),
-			)
-			return err
-		}
+	check := func() (bool, error) {
+		return streamExists(js, streamName)
+	}
+
+	err = ew.assert(streamName, check, func() error {
 
 		logger.Warn("event stream not found",
 			zap.String("stream", streamName),
 		)
-	}
-
-	subject := fmt.Sprintf(domainEventSubject, ew.domain, "*")
-
-	if stream == nil {
 
 		// Initializing stream
 		logger.Info("Creating stream...",
@@ -204,6 +250,14 @@ func (ew *EventWatcher) Init() error {
 				return err
 			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to initialize event stream",
+			zap.Error(err),
+		)
+		return err
 	}
 	/*
 		// Initializing consumer
@@ -218,10 +272,18 @@ func (ew *EventWatcher) Init() error {
 	return nil
 }
 
+// AssertConsumer creates consumer which receives registered events only, filter subjects of consumer are
+// updated in place if registered events were changed, so consumer keeps its position in domain stream.
 func (ew *EventWatcher) AssertConsumer() (*nats.ConsumerInfo, error) {
 
 	maxPendingCount := viper.GetInt("eventwatcher.max_pending_count")
 
+	// Consumer without filter subjects receives all events of domain
+	subjects := ew.Subjects()
+	if len(subjects) == 0 {
+		return nil, ErrNoEventRegistered
+	}
+
 	// Preparing JetStream
 	js, err := ew.client.GetJetStream()
 	if err != nil {
@@ -235,45 +297,112 @@ func (ew *EventWatcher) AssertConsumer() (*nats.ConsumerInfo, error) {
 		zap.String("consumer", ew.durable),
 	)
 
-	c, err := js.ConsumerInfo(streamName, ew.durable)
-	if err != nil {
-		if err != nats.ErrConsumerNotFound {
-			return nil, err
+	// Check if the consumer already exists
+	check := func() (bool, error) {
+
+		_, err := js.ConsumerInfo(streamName, ew.durable)
+		if err != nil {
+			if err == nats.ErrConsumerNotFound {
+				return false, nil
+			}
+
+			return false, err
 		}
 
-		subject := fmt.Sprintf(domainEventSubject, ew.domain, ">")
+		return true, nil
+	}
+
+	assert := ew.assert
+
+	// Only the replica which holds lease of product is able to use consumer
+	if ew.leased {
+		assert = func(name string, check func() (bool, error), create func() error) error {
+			return ensure(check, create)
+		}
+	}
+
+	err = assert(streamName+"."+ew.durable, check, func() error {
 
 		logger.Info("Creating a new consumer...",
 			zap.String("stream", streamName),
-			zap.String("subject", subject),
+			zap.Strings("subjects", subjects),
 			zap.Int("max_pending_count", maxPendingCount),
 		)
 
 		cfg := nats.ConsumerConfig{
 			Durable: ew.durable,
 			//			DeliverSubject: nats.NewInbox(),
-			FilterSubject: subject,
-			AckPolicy:     nats.AckAllPolicy,
-			MaxAckPending: maxPendingCount,
+			FilterSubjects: subjects,
+			AckPolicy:      nats.AckAllPolicy,
+			MaxAckPending:  maxPendingCount,
 		}
 
-		c, err := js.AddConsumer(streamName, &cfg)
+		_, err := js.AddConsumer(streamName, &cfg)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := js.ConsumerInfo(streamName, ew.durable)
+	if err != nil {
+		return nil, err
+	}
+
+	// Events of product were changed, or consumer was created by previous version with domain-wide subject
+	if !slices.Equal(getFilterSubjects(&c.Config), subjects) {
+
+		logger.Info("Updating filter subjects of consumer",
+			zap.String("stream", streamName),
+			zap.String("consumer", ew.durable),
+			zap.Strings("subjects", subjects),
+		)
+
+		cfg := c.Config
+		cfg.FilterSubject = ""
+		cfg.FilterSubjects = subjects
+
+		c, err = js.UpdateConsumer(streamName, &cfg)
 		if err != nil {
-			return c, err
+			return nil, err
 		}
-
-		return c, nil
 	}
 
-	logger.Info("Consumer exists already",
-		zap.String("stream", streamName),
-		zap.String("consumer", ew.durable),
-	)
+	metrics.ConsumerPending.WithLabelValues(ew.product).Set(float64(c.NumPending))
 
 	return c, nil
 }
 
-func (ew *EventWatcher) subscribe(subject string, fn func(string, *nats.Msg)) error {
+// getFilterSubjects returns filter subjects of consumer in order
+func getFilterSubjects(cfg *nats.ConsumerConfig) []string {
+
+	if len(cfg.FilterSubjects) == 0 {
+
+		if len(cfg.FilterSubject) == 0 {
+			return []string{}
+		}
+
+		return []string{cfg.FilterSubject}
+	}
+
+	subjects := slices.Clone(cfg.FilterSubjects)
+	sort.Strings(subjects)
+
+	return subjects
+}
+
+// assert creates resource if it doesn't exist, creation is serialized by the leader of replicas
+func (ew *EventWatcher) assert(name string, check func() (bool, error), create func() error) error {
+
+	if ew.provision != nil {
+		return ew.provision(name, check, create)
+	}
+
+	return ensure(check, create)
+}
+
+func (ew *EventWatcher) subscribe(fn func(string, *nats.Msg)) error {
 
 	bufferSize := viper.GetInt("eventwatcher.buffer_size")
 	maxPendingCount := viper.GetInt("eventwatcher.max_pending_count")
@@ -285,7 +414,9 @@ func (ew *EventWatcher) subscribe(subject string, fn func(string, *nats.Msg)) er
 		return err
 	}
 
-	sub, err := js.PullSubscribe(subject, ew.durable)
+	// Filter subjects are decided by consumer
+	streamName := fmt.Sprintf(domainStream, ew.domain)
+	sub, err := js.PullSubscribe("", ew.durable, nats.Bind(streamName, ew.durable))
 	if err != nil {
 		return err
 	}
@@ -294,21 +425,24 @@ func (ew *EventWatcher) subscribe(subject string, fn func(string, *nats.Msg)) er
 	ew.client.GetConnection().Flush()
 
 	ew.sub = sub
-	ew.running = true
+	ew.done = make(chan struct{})
 
-	go func() {
+	go func(done chan struct{}) {
+
+		defer close(done)
 
 		logger.Info("Waiting events...",
-			zap.String("subject", subject),
 			zap.String("durable", ew.durable),
 		)
 
-		for ew.running {
+		// Subscription is no longer valid if there is no event to watch
+		for ew.running.Load() && sub.IsValid() {
 
+			fetchedAt := time.Now()
 			msgs, err := sub.Fetch(maxPendingCount, nats.MaxWait(maxWait))
 			if err != nil {
 
-				if err == nats.ErrTimeout {
+				if err == nats.ErrTimeout || err == nats.ErrBadSubscription {
 					continue
 				}
 
@@ -320,24 +454,43 @@ func (ew *EventWatcher) subscribe(subject string, fn func(string, *nats.Msg)) er
 			}
 
 			logger.Info("received messages",
-				zap.String("subject", subject),
 				zap.String("durable", ew.durable),
 				zap.Int("count", len(msgs)),
 			)
 
+			// Span covers fetching and passing events to product
+			_, span := tracing.Tracer().Start(context.Background(), "EventWatcher.fetch",
+				trace.WithTimestamp(fetchedAt),
+				trace.WithAttributes(
+					attribute.String("gravity.product", ew.product),
+					attribute.String("gravity.durable", ew.durable),
+					attribute.Int("gravity.count", len(msgs)),
+				),
+			)
+
+			metrics.EventsFetched.WithLabelValues(ew.product).Add(float64(len(msgs)))
+
+			// Pending count of the last message is the latest
+			meta, err := msgs[len(msgs)-1].Metadata()
+			if err == nil {
+				metrics.ConsumerPending.WithLabelValues(ew.product).Set(float64(meta.NumPending))
+			}
+
 			for _, msg := range msgs {
 
-				// Ignore event
-				e, ok := ew.events[msg.Subject]
-				if !ok {
+				// Ignore event which was fetched before it was unregistered
+				e := ew.GetEvent(msg.Subject)
+				if e == nil {
 					fn("", msg)
 					continue
 				}
 
 				fn(e.Name, msg)
 			}
+
+			span.End()
 		}
-	}()
+	}(ew.done)
 
 	return nil
 }
@@ -345,68 +498,70 @@ func (ew *EventWatcher) subscribe(subject string, fn func(string, *nats.Msg)) er
 func (ew *EventWatcher) Watch(fn func(string, *nats.Msg)) error {
 
 	// Watching already
-	if ew.sub != nil {
+	if ew.running.Load() {
 		return nil
 	}
 
 	logger.Info("Start watching for events...")
-	/*
-		// Preparing JetStream
-		js, err := ew.client.GetJetStream()
-		if err != nil {
-			return err
-		}
-	*/
-	// Initializing consumer
-	_, err := ew.AssertConsumer()
-	if err != nil {
-		return err
-	}
 
-	subject := fmt.Sprintf(domainEventSubject, ew.domain, ">")
+	ew.handler = fn
+	ew.running.Store(true)
 
-	err = ew.subscribe(subject, fn)
+	err := ew.Refresh()
 	if err != nil {
 		logger.Error(err.Error())
+		ew.Stop()
 		return err
 	}
-	/*
-		//sub, err := js.PullSubscribe(subject, "DISPATCH", nats.PullMaxWaiting(128), nats.AckExplicit())
 
-		sub, err := js.Subscribe(subject, func(msg *nats.Msg) {
-			logger.Info("Received event",
-				zap.String("subject", msg.Subject),
-			)
+	return nil
+}
 
-			// Ignore event
-			e, ok := ew.events[msg.Subject]
-			if !ok {
-				fn("", msg)
-				return
-			}
+// Refresh applies registered events to consumer if watcher is running, it should be called after events were
+// changed.
+func (ew *EventWatcher) Refresh() error {
 
-			fn(e.Name, msg)
+	if !ew.running.Load() {
+		return nil
+	}
 
-			//}, nats.DeliverNew(), nats.AckAll(), nats.Durable(ew.durable), nats.OrderedConsumer())
-			//}, nats.OrderedConsumer())
-			//}, nats.MaxAckPending(20480), nats.AckAll(), nats.Durable(ew.durable))
-		}, nats.Durable(ew.durable))
-		if err != nil {
-			logger.Error(err.Error())
-			return err
-		}
-	*/
+	// Nothing to receive, watcher keeps running for events which will be registered
+	if len(ew.Subjects()) == 0 {
 
-	return nil
+		logger.Info("No event was registered",
+			zap.String("product", ew.product),
+		)
+
+		return ew.unsubscribe()
+	}
+
+	// Initializing consumer
+	_, err := ew.AssertConsumer()
+	if err != nil {
+		return err
+	}
+
+	if ew.sub != nil {
+		return nil
+	}
+
+	return ew.subscribe(ew.handler)
+}
+
+func (ew *EventWatcher) IsRunning() bool {
+	return ew.running.Load()
 }
 
 func (ew *EventWatcher) Stop() error {
 
-	if !ew.running {
+	if !ew.running.Swap(false) {
 		return nil
 	}
 
-	ew.running = false
+	return ew.unsubscribe()
+}
+
+func (ew *EventWatcher) unsubscribe() error {
 
 	if ew.sub == nil {
 		return nil
@@ -417,3 +572,18 @@ func (ew *EventWatcher) Stop() error {
 
 	return sub.Unsubscribe()
 }
+
+// Wait blocks until messages which were fetched already have been passed to handler after watcher was stopped
+func (ew *EventWatcher) Wait(ctx context.Context) error {
+
+	if ew.done == nil {
+		return nil
+	}
+
+	select {
+	case <-ew.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,116 @@
+package dispatcher
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventWatcherFilterSubjects(t *testing.T) {
+
+	d := CreateTestDispatcher(t)
+
+	js, err := d.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	// Consumer which was created by previous version receives all events of domain
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     "GVT_default",
+		Subjects: []string{"$GVT.default.EVENT.*"},
+	})
+	require.Nil(t, err)
+
+	_, err = js.AddConsumer("GVT_default", &nats.ConsumerConfig{
+		Durable:       "GVT_default_DP_filter_test",
+		FilterSubject: "$GVT.default.EVENT.>",
+		AckPolicy:     nats.AckAllPolicy,
+	})
+	require.Nil(t, err)
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = "filter_test"
+	setting.Enabled = true
+	setting.Rules["testRule"] = CreateTestProductRule()
+	setting.Rules["testRule"].Product = setting.Name
+
+	defer metrics.DeleteProduct("filter_test")
+
+	applySetting := func() {
+		data, err := json.Marshal(setting)
+		require.Nil(t, err)
+
+		_, err = d.productConfigStore.Put(setting.Name, data)
+		require.Nil(t, err)
+	}
+
+	applySetting()
+
+	require.Eventually(t, func() bool {
+		code, report := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK && report.Products["filter_test"] != nil && report.Products["filter_test"].Watching
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ci, err := js.ConsumerInfo("GVT_default", "GVT_default_DP_filter_test")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"$GVT.default.EVENT.dataCreated"}, getFilterSubjects(&ci.Config))
+
+	created := ci.Created
+
+	// Unregistered events are never delivered to product
+	publish := func(event string) {
+		raw, _ := json.Marshal(MessageRawData{
+			Event:      event,
+			RawPayload: []byte(`{"id":101,"name":"fred"}`),
+		})
+
+		_, err := js.Publish("$GVT.default.EVENT."+event, raw)
+		require.Nil(t, err)
+	}
+
+	publish("dataDeleted")
+	publish("dataCreated")
+
+	require.Eventually(t, func() bool {
+		stream, err := js.StreamInfo("GVT_default_DP_filter_test")
+		return err == nil && stream.State.Msgs == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ci, err = js.ConsumerInfo("GVT_default", "GVT_default_DP_filter_test")
+	require.Nil(t, err)
+	assert.Equal(t, uint64(1), ci.Delivered.Consumer)
+
+	// Filter subjects are updated in place after events were changed
+	rule := CreateTestProductRule()
+	rule.Name = "deleteRule"
+	rule.Event = "dataDeleted"
+	rule.Product = setting.Name
+	setting.Rules["deleteRule"] = rule
+
+	applySetting()
+
+	require.Eventually(t, func() bool {
+		ci, err := js.ConsumerInfo("GVT_default", "GVT_default_DP_filter_test")
+		return err == nil && len(getFilterSubjects(&ci.Config)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ci, err = js.ConsumerInfo("GVT_default", "GVT_default_DP_filter_test")
+	require.Nil(t, err)
+	assert.Equal(t, []string{
+		"$GVT.default.EVENT.dataCreated",
+		"$GVT.default.EVENT.dataDeleted",
+	}, getFilterSubjects(&ci.Config))
+	assert.Equal(t, created, ci.Created)
+
+	publish("dataDeleted")
+
+	require.Eventually(t, func() bool {
+		stream, err := js.StreamInfo("GVT_default_DP_filter_test")
+		return err == nil && stream.State.Msgs == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,214 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultHealthCheckTimeout = 3 * time.Second
+)
+
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+type HealthReport struct {
+	Status            string                    `json:"status"`
+	Connected         bool                      `json:"connected"`         // Connection of connector
+	PublisherReady    bool                      `json:"publisherReady"`    // Individual connection for publishing
+	JetStream         bool                      `json:"jetstream"`         // JetStream is available
+	DomainStream      bool                      `json:"domainStream"`      // Domain stream exists
+	ConfigStoreSynced bool                      `json:"configStoreSynced"` // All products were loaded and activated
+	Products          map[string]*ProductHealth `json:"products"`
+	Errors            []string                  `json:"errors,omitempty"`
+}
+
+type ProductHealth struct {
+	Enabled  bool   `json:"enabled"`
+	Standby  bool   `json:"standby"` // Product is dispatched by another replica
+	Running  bool   `json:"running"`
+	Watching bool   `json:"watching"`
+	Breaker  string `json:"breaker"`
+}
+
+func (d *Dispatcher) isConfigStoreSynced() bool {
+	return d.configStoreSynced.Load()
+}
+
+// checkConfigStoreSynced marks config store synced if there is no product at all, because no entry
+// will be delivered to indicate that initial products were loaded.
+func (d *Dispatcher) checkConfigStoreSynced() error {
+
+	keys, err := d.productConfigStore.Keys()
+	if err != nil && err != nats.ErrNoKeysFound {
+		return err
+	}
+
+	if len(keys) == 0 {
+		d.configStoreSynced.Store(true)
+	}
+
+	return nil
+}
+
+// CheckHealth reports state of connections, streams and products
+func (d *Dispatcher) CheckHealth(ctx context.Context) *HealthReport {
+
+	report := &HealthReport{
+		Status:            HealthStatusOK,
+		Products:          make(map[string]*ProductHealth),
+		ConfigStoreSynced: d.isConfigStoreSynced(),
+		Errors:            make([]string, 0),
+	}
+
+	client := d.connector.GetClient()
+	if client != nil && client.GetConnection() != nil {
+		report.Connected = client.GetConnection().IsConnected()
+	}
+
+	if d.publisher != nil && d.publisher.GetConnection() != nil {
+		report.PublisherReady = d.publisher.GetConnection().IsConnected()
+	}
+
+	if report.Connected {
+
+		js, err := client.GetJetStream()
+		if err == nil {
+			_, err = js.AccountInfo(nats.Context(ctx))
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("jetstream: %v", err))
+		} else {
+			report.JetStream = true
+		}
+	}
+
+	if report.JetStream {
+
+		js, _ := client.GetJetStream()
+		_, err := js.StreamInfo(fmt.Sprintf(domainStream, d.connector.GetDomain()), nats.Context(ctx))
+		if err != nil {
+			if err != nats.ErrStreamNotFound {
+				report.Errors = append(report.Errors, fmt.Sprintf("domain stream: %v", err))
+			}
+		} else {
+			report.DomainStream = true
+		}
+	}
+
+	if d.productManager != nil {
+		d.productManager.products.Range(func(key interface{}, value interface{}) bool {
+
+			p := value.(*Product)
+
+			ph := &ProductHealth{
+				Enabled: p.Enabled.Load(),
+				Standby: p.standby.Load(),
+				Running: p.IsRunning.Load(),
+				Breaker: p.breaker.State().Breaker,
+			}
+
+			if p.watcher != nil {
+				ph.Watching = p.watcher.IsRunning()
+			}
+
+			report.Products[key.(string)] = ph
+
+			return true
+		})
+	}
+
+	return report
+}
+
+// isAlive returns false only if the connection was closed and will never recover
+func (d *Dispatcher) isAlive() bool {
+
+	client := d.connector.GetClient()
+	if client == nil || client.GetConnection() == nil {
+		return false
+	}
+
+	return !client.GetConnection().IsClosed()
+}
+
+// IsReady returns true if dispatcher is able to handle events of all enabled products which are assigned to this replica
+func (report *HealthReport) IsReady() bool {
+
+	if !report.Connected || !report.PublisherReady || !report.JetStream || !report.ConfigStoreSynced {
+		return false
+	}
+
+	for _, ph := range report.Products {
+
+		// Product is handled by another replica
+		if !ph.Enabled || ph.Standby {
+			continue
+		}
+
+		// Domain stream is created by event watcher of product
+		if !report.DomainStream || !ph.Running || !ph.Watching {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d *Dispatcher) healthzHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), DefaultHealthCheckTimeout)
+	defer cancel()
+
+	report := d.CheckHealth(ctx)
+	if !d.isAlive() {
+		report.Status = HealthStatusUnavailable
+	}
+
+	writeHealthReport(w, report)
+}
+
+func (d *Dispatcher) readyzHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), DefaultHealthCheckTimeout)
+	defer cancel()
+
+	report := d.CheckHealth(ctx)
+	if !report.IsReady() {
+		report.Status = HealthStatusUnavailable
+	}
+
+	writeHealthReport(w, report)
+}
+
+func writeHealthReport(w http.ResponseWriter, report *HealthReport) {
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if report.Status != HealthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		logger.Warn("Failed to write health report",
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,187 @@
+package dispatcher
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/configs"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/connector"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/http_server"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/system"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func CreateTestServer(t *testing.T) *server.Server {
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.Nil(t, err)
+
+	go s.Start()
+
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server is not ready")
+	}
+
+	t.Cleanup(s.Shutdown)
+
+	viper.Set("gravity.domain", "default")
+	viper.Set("gravity.host", "127.0.0.1")
+	viper.Set("gravity.port", s.Addr().(*net.TCPAddr).Port)
+	viper.Set("http.enabled", false)
+
+	return s
+}
+
+// StartTestDispatcher starts a dispatcher which connects to the server of CreateTestServer
+func StartTestDispatcher(t *testing.T, config *configs.Config) *Dispatcher {
+
+	lc := fxtest.NewLifecycle(t)
+	c := connector.New(lc, zap.NewNop())
+	sys := system.New(lc, config, zap.NewNop(), c)
+	hs := http_server.New(lc, zap.NewNop())
+	d := New(lc, config, zap.NewNop(), c, sys, hs)
+	lc.RequireStart()
+	t.Cleanup(func() {
+		lc.RequireStop()
+	})
+
+	return d
+}
+
+func CreateTestDispatcher(t *testing.T) *Dispatcher {
+
+	CreateTestServer(t)
+
+	return StartTestDispatcher(t, &configs.Config{})
+}
+
+func RequestTestHealth(t *testing.T, handler http.HandlerFunc) (int, *HealthReport) {
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var report HealthReport
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &report))
+
+	return rec.Code, &report
+}
+
+func TestHealth(t *testing.T) {
+
+	d := CreateTestDispatcher(t)
+
+	// Nothing to be loaded
+	require.Eventually(t, func() bool {
+		code, _ := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	code, report := RequestTestHealth(t, d.healthzHandler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Connected)
+	assert.True(t, report.PublisherReady)
+	assert.True(t, report.JetStream)
+	assert.True(t, report.ConfigStoreSynced)
+
+	// Add a new product
+	setting := product_setting.NewProductSetting()
+	setting.Name = "health_test"
+	setting.Enabled = true
+	setting.Rules["testRule"] = CreateTestProductRule()
+
+	data, err := json.Marshal(setting)
+	require.Nil(t, err)
+
+	_, err = d.productConfigStore.Put(setting.Name, data)
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		code, report := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK && report.Products["health_test"] != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, report = RequestTestHealth(t, d.readyzHandler)
+	assert.True(t, report.DomainStream)
+	assert.Equal(t, &ProductHealth{
+		Enabled:  true,
+		Running:  true,
+		Watching: true,
+		Breaker:  "closed",
+	}, report.Products["health_test"])
+
+	// Product stopped working
+	require.Nil(t, d.productManager.GetProduct("health_test").Deactivate())
+
+	code, report = RequestTestHealth(t, d.readyzHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthStatusUnavailable, report.Status)
+	assert.False(t, report.Products["health_test"].Watching)
+
+	// Still alive
+	code, _ = RequestTestHealth(t, d.healthzHandler)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestHealthBeforeSynced(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	d := &Dispatcher{
+		connector: &connector.Connector{},
+	}
+
+	code, report := RequestTestHealth(t, d.readyzHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Connected)
+	assert.False(t, report.ConfigStoreSynced)
+
+	code, _ = RequestTestHealth(t, d.healthzHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestHealthWithStandbyProducts(t *testing.T) {
+
+	report := &HealthReport{
+		Status:            HealthStatusOK,
+		Connected:         true,
+		PublisherReady:    true,
+		JetStream:         true,
+		DomainStream:      true,
+		ConfigStoreSynced: true,
+		Products: map[string]*ProductHealth{
+			"assigned": {
+				Enabled:  true,
+				Running:  true,
+				Watching: true,
+				Breaker:  "closed",
+			},
+			"standby": {
+				Enabled: true,
+				Standby: true,
+				Breaker: "closed",
+			},
+		},
+	}
+
+	// Products which are dispatched by another replica are ignored
+	assert.True(t, report.IsReady())
+
+	report.Products["assigned"].Watching = false
+	assert.False(t, report.IsReady())
+}
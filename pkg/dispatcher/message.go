@@ -1,32 +1,48 @@
 package dispatcher
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/rule_manager"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/tracing"
 	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
 	"github.com/BrobridgeOrg/schemer"
 
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Message struct {
+	ID           string
+	Publisher    nats.JetStreamContext
+	Msg          *nats.Msg
+	AckFuture    nats.PubAckFuture
+	Event        string
+	Product      *Product
+	Rules        []*rule_manager.Rule
+	Data         *MessageRawData
+	Raw          []byte
+	Outputs      []*MessageOutput
+	TargetSchema *schemer.Schema
+	Ignore       bool
+	FailedRule   *rule_manager.Rule
+	FailedStage  string
+	Error        error
+	DispatchedAt time.Time
+	Context      context.Context // Trace context of event
+}
+
+type MessageOutput struct {
 	ID              string
-	Publisher       nats.JetStreamContext
-	Msg             *nats.Msg
-	AckFuture       nats.PubAckFuture
-	Event           string
-	Product         *Product
-	Rule            *rule_manager.Rule
-	Data            *MessageRawData
-	Raw             []byte
 	Partition       int32
 	ProductEvent    *gravity_sdk_types_product_event.ProductEvent
 	RawProductEvent []byte
-	TargetSchema    *schemer.Schema
-	OutputMsg       *nats.Msg
-	Ignore          bool
+	Msg             *nats.Msg
+	AckFuture       nats.PubAckFuture
 }
 
 type MessageRawData struct {
@@ -78,27 +94,32 @@ func (m *Message) Release() {
 
 func (m *Message) Reset() {
 
-	if m.ProductEvent != nil {
-		productEventPool.Put(m.ProductEvent)
-		m.ProductEvent = nil
-	}
+	for _, output := range m.Outputs {
+
+		if output.ProductEvent != nil {
+			productEventPool.Put(output.ProductEvent)
+		}
 
-	if m.OutputMsg != nil {
-		natsMsgPool.Put(m.OutputMsg)
-		m.OutputMsg = nil
+		if output.Msg != nil {
+			natsMsgPool.Put(output.Msg)
+		}
 	}
 
+	m.ID = ""
 	m.Msg = nil
 	m.AckFuture = nil
-	m.Rule = nil
+	m.Rules = m.Rules[:0]
 	m.Product = nil
-	m.ProductEvent = nil
-	m.OutputMsg = nil
+	m.Outputs = m.Outputs[:0]
 	m.TargetSchema = nil
 	m.Event = ""
 	m.Raw = []byte("")
-	m.RawProductEvent = []byte("")
 	m.Ignore = false
+	m.FailedRule = nil
+	m.FailedStage = ""
+	m.Error = nil
+	m.DispatchedAt = time.Time{}
+	m.Context = context.Background()
 	m.Data = &MessageRawData{
 		Payload: make(map[string]interface{}),
 	}
@@ -108,7 +129,22 @@ func (m *Message) Ack() error {
 	return m.Msg.Ack()
 }
 
-func (m *Message) Dispatch() error {
+func (m *Message) Dispatch() (err error) {
+
+	m.DispatchedAt = time.Now()
+
+	ctx, span := tracing.Start(m.Context, "Message.Dispatch",
+		attribute.String("gravity.event", m.Event),
+		attribute.Int("gravity.outputs", len(m.Outputs)),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	// Failed to process, so send it to dead-letter stream
+	if m.Error != nil {
+		return m.dispatchDeadLetter(ctx)
+	}
 
 	if m.Ignore {
 		return nil
@@ -118,30 +154,75 @@ func (m *Message) Dispatch() error {
 		return nil
 	}
 
-	if !m.Product.Enabled {
+	if !m.Product.Enabled.Load() {
 		return nil
 	}
 
 	// Publish to product stream
-	future, err := m.Publisher.PublishMsgAsync(m.OutputMsg, nats.MsgId(m.ID))
-	if err != nil {
-		return err
-	}
+	for _, output := range m.Outputs {
+
+		// Subscribers of product are able to continue the trace
+		if output.Msg.Header == nil {
+			output.Msg.Header = nats.Header{}
+		}
 
-	m.AckFuture = future
+		tracing.Inject(ctx, output.Msg.Header)
+
+		future, err := m.Publisher.PublishMsgAsync(output.Msg, nats.MsgId(output.ID))
+		if err != nil {
+			return err
+		}
+
+		output.AckFuture = future
+	}
 
 	return nil
 }
 
-func (m *Message) Wait() error {
+func (m *Message) Wait() (err error) {
 
-	if m.AckFuture == nil {
-		return nil
+	_, span := tracing.Start(m.Context, "Message.Wait")
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	published := false
+
+	if m.AckFuture != nil {
+		err := waitForAck(m.AckFuture)
+		if err != nil {
+			return err
+		}
+
+		published = true
+	}
+
+	for _, output := range m.Outputs {
+
+		if output.AckFuture == nil {
+			continue
+		}
+
+		err := waitForAck(output.AckFuture)
+		if err != nil {
+			return err
+		}
+
+		published = true
+	}
+
+	if published && m.Product != nil {
+		metrics.PublishLatency.WithLabelValues(m.Product.Name).Observe(time.Since(m.DispatchedAt).Seconds())
 	}
 
+	return nil
+}
+
+func waitForAck(future nats.PubAckFuture) error {
+
 	select {
-	case <-m.AckFuture.Ok():
-	case err := <-m.AckFuture.Err():
+	case <-future.Ok():
+	case err := <-future.Err():
 		return err
 	}
 
@@ -0,0 +1,121 @@
+package dispatcher
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestProcessorMetrics(t *testing.T) {
+
+	logger = zap.NewNop()
+	var wg sync.WaitGroup
+
+	// Preparing processor
+	p := NewProcessor(
+		WithOutputHandler(func(msg *Message) {
+			wg.Done()
+		}),
+	)
+	defer p.Close()
+
+	// Preparing product
+	setting := CreateTestProductSetting()
+	setting.Name = "MetricsProduct"
+
+	// Second rule fails to transform
+	failed := CreateTestProductRule()
+	failed.Event = "dataFailed"
+	failed.HandlerConfig = &product_setting.HandlerConfig{
+		Type:   "script",
+		Script: `throw new Error('failed')`,
+	}
+
+	setting.Rules = map[string]*product_setting.Rule{
+		"testRule":   CreateTestProductRule(),
+		"failedRule": failed,
+	}
+
+	product := NewProduct(nil)
+	product.onMessage = func(msg *Message) {
+		p.Push(msg)
+	}
+	product.ApplySettings(setting)
+
+	defer metrics.DeleteProduct("MetricsProduct")
+
+	events := []string{"dataCreated", "dataCreated", "dataUnknown", "dataFailed"}
+
+	wg.Add(len(events))
+	for _, event := range events {
+		raw, _ := json.Marshal(MessageRawData{
+			Event:      event,
+			RawPayload: []byte(`{"id":101,"name":"fred"}`),
+		})
+		product.HandleRawMessage(event, raw)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.EventsMatched.WithLabelValues("MetricsProduct")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.EventsIgnored.WithLabelValues("MetricsProduct")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ProcessingFailures.WithLabelValues("MetricsProduct", DeadLetterStageTransform)))
+}
+
+func TestDispatchMetrics(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	client := CreateTestClient(t)
+	js, err := client.GetJetStream()
+	require.Nil(t, err)
+
+	msgs := CreateTestSourceMessages(t, js, 2)
+
+	p := NewProduct(nil)
+	p.Name = "metrics_test"
+	p.Enabled.Store(true)
+	p.IsRunning.Store(true)
+	p.breaker.SetPolicy(NewRetryPolicy(&product_setting.RetryPolicy{
+		InitialInterval: "10ms",
+		MaxInterval:     "10ms",
+	}))
+
+	defer metrics.DeleteProduct("metrics_test")
+
+	chunk := CreateTestDispatchChunk(t, p, js, msgs)
+	for _, m := range chunk {
+		m.(*Message).Outputs[0].Msg.Subject = "$GVT.default.DP.metrics_test.0.EVENT.dataCreated"
+		p.dispatch(m.(*Message))
+	}
+
+	// Product stream doesn't exist
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.DispatchRetries.WithLabelValues("metrics_test")) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.BufferDepth.WithLabelValues("metrics_test")))
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     "GVT_default_DP_metrics_test",
+		Subjects: []string{"$GVT.default.DP.metrics_test.>"},
+	})
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		return GetTestAckFloor(t, js) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Series of product will be removed
+	count := testutil.CollectAndCount(metrics.PublishLatency, "gravity_dispatcher_publish_latency_seconds")
+	metrics.DeleteProduct("metrics_test")
+	assert.Equal(t, count-1, testutil.CollectAndCount(metrics.PublishLatency, "gravity_dispatcher_publish_latency_seconds"))
+}
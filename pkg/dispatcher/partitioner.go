@@ -0,0 +1,224 @@
+package dispatcher
+
+import (
+	"fmt"
+	"hash/crc64"
+	"sync/atomic"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/partitioning"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
+	"github.com/lithammer/go-jump-consistent-hash"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+const (
+	productPartitionBucket = "GVT_%s_PRODUCT_PARTITION"
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// Events are partitioned by primary key if product doesn't specify partitioning
+var defaultPartitioner = NewPartitioner(nil)
+
+// Partitioner decides which partition of product stream an event goes to
+type Partitioner struct {
+	partitions  int32
+	partitionBy string
+	field       string
+	counter     atomic.Uint64
+}
+
+func NewPartitioner(setting *product_setting.ProductSetting) *Partitioner {
+
+	p := &Partitioner{
+		partitions:  partitioning.DefaultPartitions,
+		partitionBy: partitioning.ByPrimaryKey,
+	}
+
+	if setting == nil {
+		return p
+	}
+
+	if setting.Partitions > 0 {
+		p.partitions = int32(setting.Partitions)
+	}
+
+	if len(setting.PartitionBy) > 0 {
+		p.partitionBy = setting.PartitionBy
+	}
+
+	p.field = setting.PartitionField
+
+	return p
+}
+
+// Range returns partitioning which can be recorded in history
+func (p *Partitioner) Range() *partitioning.Range {
+	return &partitioning.Range{
+		Partitions:  int(p.partitions),
+		PartitionBy: p.partitionBy,
+		Field:       p.field,
+	}
+}
+
+func (p *Partitioner) Partition(pe *gravity_sdk_types_product_event.ProductEvent) int32 {
+
+	switch p.partitionBy {
+	case partitioning.BySingle:
+		return 0
+	case partitioning.ByRoundRobin:
+		return int32((p.counter.Add(1) - 1) % uint64(p.partitions))
+	case partitioning.ByField:
+
+		// Events without the field are partitioned by primary key
+		key, ok := p.fieldKey(pe)
+		if ok {
+			return p.hash(key)
+		}
+	}
+
+	return p.hash(pe.PrimaryKey)
+}
+
+func (p *Partitioner) fieldKey(pe *gravity_sdk_types_product_event.ProductEvent) ([]byte, bool) {
+
+	r, err := pe.GetContent()
+	if err != nil {
+		return nil, false
+	}
+
+	v, err := r.GetValueDataByPath(p.field)
+	if err != nil || v == nil {
+		return nil, false
+	}
+
+	return StrToBytes(fmt.Sprintf("%v", v)), true
+}
+
+func (p *Partitioner) hash(key []byte) int32 {
+	return jump.Hash(crc64.Checksum(key, crc64Table), p.partitions)
+}
+
+func (pm *ProductManager) assertPartitionStore() error {
+
+	if pm.partitionStore != nil {
+		return nil
+	}
+
+	js, err := pm.dispatcher.connector.GetClient().GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	bucket := fmt.Sprintf(productPartitionBucket, pm.dispatcher.connector.GetDomain())
+
+	kv, err := assertKeyValue(js, pm.dispatcher.provision, &nats.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Gravity product partitioning",
+		History:     1,
+		Replicas:    3,
+	})
+	if err != nil {
+		return err
+	}
+
+	pm.partitionStore = kv
+
+	return nil
+}
+
+// recordPartitioning appends partitioning to history of product if it was changed, so subscribers are able to
+// know partitioning of events at any sequence of product stream. It should be called before dispatching.
+func (p *Product) recordPartitioning() error {
+
+	if p.manager == nil || p.manager.partitionStore == nil {
+		return nil
+	}
+
+	kv := p.manager.partitionStore
+
+	history := &partitioning.History{
+		Ranges: make([]*partitioning.Range, 0),
+	}
+
+	var rev uint64
+	entry, err := kv.Get(p.Name)
+	if err != nil {
+		if err != nats.ErrKeyNotFound {
+			return err
+		}
+	} else {
+		history, err = partitioning.Unmarshal(entry.Value())
+		if err != nil {
+			return err
+		}
+
+		rev = entry.Revision()
+	}
+
+	current := p.partitioner.Load().Range()
+
+	last := history.Current()
+	if last != nil && last.Equal(current) {
+		return nil
+	}
+
+	// Events in stream can be dispatched by another replica, so sequence must be read after it stopped
+	js, err := p.getConnector().GetClient().GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	streamName := p.stream
+	if len(streamName) == 0 {
+		streamName = fmt.Sprintf(productEventStream, p.Domain, p.Name)
+	}
+
+	info, err := js.StreamInfo(streamName)
+	if err != nil {
+		return err
+	}
+
+	// Events which were dispatched before history was kept
+	if last == nil && info.State.LastSeq > 0 {
+		history.Ranges = append(history.Ranges, &partitioning.Range{
+			Partitions:  partitioning.DefaultPartitions,
+			PartitionBy: partitioning.ByPrimaryKey,
+			StartSeq:    1,
+			CreatedAt:   time.Now(),
+		})
+
+		if history.Ranges[0].Equal(current) {
+			return p.savePartitioning(kv, history, rev)
+		}
+	}
+
+	current.StartSeq = info.State.LastSeq + 1
+	current.CreatedAt = time.Now()
+	history.Ranges = append(history.Ranges, current)
+
+	logger.Info("Partitioning of product was changed",
+		zap.String("product", p.Name),
+		zap.Int("partitions", current.Partitions),
+		zap.String("partitionBy", current.PartitionBy),
+		zap.Uint64("startSeq", current.StartSeq),
+	)
+
+	return p.savePartitioning(kv, history, rev)
+}
+
+func (p *Product) savePartitioning(kv nats.KeyValue, history *partitioning.History, rev uint64) error {
+
+	data, err := history.Marshal()
+	if err != nil {
+		return err
+	}
+
+	// History might be updated by another replica at the same time
+	_, err = kv.Update(p.Name, data, rev)
+
+	return err
+}
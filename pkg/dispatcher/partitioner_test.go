@@ -0,0 +1,320 @@
+package dispatcher
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/partitioning"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
+	record_type "github.com/BrobridgeOrg/gravity-sdk/v2/types/record"
+	"github.com/lithammer/go-jump-consistent-hash"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func CreateTestPartitionEvent(t *testing.T, pk string, payload map[string]interface{}) *gravity_sdk_types_product_event.ProductEvent {
+
+	r := record_type.NewRecord()
+	require.Nil(t, record_type.UnmarshalMapData(payload, r))
+
+	pe := &gravity_sdk_types_product_event.ProductEvent{
+		PrimaryKey: []byte(pk),
+	}
+	require.Nil(t, pe.SetContent(r))
+
+	return pe
+}
+
+func TestPartitioner(t *testing.T) {
+
+	pe := CreateTestPartitionEvent(t, "101", map[string]interface{}{"id": int64(101), "region": "tw"})
+
+	// Compatible with partitions of previous versions
+	p := NewPartitioner(nil)
+	assert.Equal(t, jump.HashString("101", 256, jump.NewCRC64()), p.Partition(pe))
+
+	// Single partition
+	setting := product_setting.NewProductSetting()
+	setting.Partitions = 8
+	setting.PartitionBy = partitioning.BySingle
+	p = NewPartitioner(setting)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, int32(0), p.Partition(pe))
+	}
+
+	// Round-robin
+	setting.PartitionBy = partitioning.ByRoundRobin
+	p = NewPartitioner(setting)
+	for i := 0; i < 16; i++ {
+		assert.Equal(t, int32(i%8), p.Partition(pe))
+	}
+
+	// Events with the same value of field go to the same partition
+	setting.PartitionBy = partitioning.ByField
+	setting.PartitionField = "region"
+	p = NewPartitioner(setting)
+
+	other := CreateTestPartitionEvent(t, "102", map[string]interface{}{"id": int64(102), "region": "tw"})
+	assert.Equal(t, p.Partition(pe), p.Partition(other))
+	assert.Equal(t, p.hash([]byte("tw")), p.Partition(pe))
+
+	// Primary key is used if field doesn't exist
+	keyless := CreateTestPartitionEvent(t, "103", map[string]interface{}{"id": int64(103)})
+	assert.Equal(t, p.hash([]byte("103")), p.Partition(keyless))
+	assert.Less(t, p.Partition(keyless), int32(8))
+}
+
+func TestPartitionerReplacement(t *testing.T) {
+
+	pe := CreateTestPartitionEvent(t, "101", map[string]interface{}{"id": int64(101), "region": "tw"})
+
+	p := &Product{}
+	processor := &Processor{}
+
+	// Default partitioner is used before settings are applied
+	assert.Equal(t, NewPartitioner(nil).Partition(pe), processor.calculatePartition(&Message{Product: p}, pe))
+
+	single := product_setting.NewProductSetting()
+	single.Partitions = 8
+	single.PartitionBy = partitioning.BySingle
+
+	// Partitioner is replaced while events are processed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 1000; i++ {
+			if i%2 == 0 {
+				p.partitioner.Store(NewPartitioner(single))
+			} else {
+				p.partitioner.Store(NewPartitioner(nil))
+			}
+		}
+	}()
+
+	msg := &Message{Product: p}
+	for i := 0; i < 1000; i++ {
+		partition := processor.calculatePartition(msg, pe)
+		assert.True(t, partition == 0 || partition == NewPartitioner(nil).Partition(pe))
+	}
+
+	<-done
+
+	p.partitioner.Store(NewPartitioner(single))
+	assert.Equal(t, int32(0), processor.calculatePartition(msg, pe))
+}
+
+func TestRepartitioning(t *testing.T) {
+
+	d := CreateTestDispatcher(t)
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = "partition_test"
+	setting.Enabled = true
+	setting.Rules["testRule"] = CreateTestProductRule()
+	setting.Rules["testRule"].Product = setting.Name
+
+	defer metrics.DeleteProduct("partition_test")
+
+	applySetting := func() {
+		data, err := json.Marshal(setting)
+		require.Nil(t, err)
+
+		_, err = d.productConfigStore.Put(setting.Name, data)
+		require.Nil(t, err)
+	}
+
+	applySetting()
+
+	require.Eventually(t, func() bool {
+		code, report := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK && report.Products["partition_test"] != nil && report.Products["partition_test"].Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	js, err := d.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	publish := func(from int, to int) {
+		for i := from; i <= to; i++ {
+
+			raw, _ := json.Marshal(MessageRawData{
+				Event:      "dataCreated",
+				RawPayload: []byte(fmt.Sprintf(`{"id":%d,"name":"fred"}`, i)),
+			})
+
+			_, err := js.Publish("$GVT.default.EVENT.dataCreated", raw)
+			require.Nil(t, err)
+		}
+
+		require.Eventually(t, func() bool {
+			stream, err := js.StreamInfo("GVT_default_DP_partition_test")
+			return err == nil && stream.State.LastSeq == uint64(to)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	getHistory := func() *partitioning.History {
+
+		entry, err := d.productManager.partitionStore.Get("partition_test")
+		require.Nil(t, err)
+
+		history, err := partitioning.Unmarshal(entry.Value())
+		require.Nil(t, err)
+
+		return history
+	}
+
+	// Initial partitioning
+	publish(1, 10)
+
+	history := getHistory()
+	require.Len(t, history.Ranges, 1)
+	assert.Equal(t, partitioning.DefaultPartitions, history.Ranges[0].Partitions)
+	assert.Equal(t, partitioning.ByPrimaryKey, history.Ranges[0].PartitionBy)
+	assert.Equal(t, uint64(1), history.Ranges[0].StartSeq)
+
+	// Repartition
+	setting.Partitions = 4
+	applySetting()
+
+	require.Eventually(t, func() bool {
+		return len(getHistory().Ranges) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	history = getHistory()
+	assert.Equal(t, 4, history.Ranges[1].Partitions)
+	assert.Equal(t, uint64(11), history.Ranges[1].StartSeq)
+	assert.Equal(t, history.Ranges[0], history.Find(10))
+	assert.Equal(t, history.Ranges[1], history.Find(11))
+
+	publish(11, 20)
+
+	// Events after repartitioning are stored in new partitions
+	for seq := uint64(11); seq <= 20; seq++ {
+
+		msg, err := js.GetMsg("GVT_default_DP_partition_test", seq)
+		require.Nil(t, err)
+
+		partition, err := strconv.Atoi(strings.Split(msg.Subject, ".")[4])
+		require.Nil(t, err)
+		assert.Less(t, partition, 4)
+	}
+}
+
+func TestRepartitioningDrainTimeout(t *testing.T) {
+
+	d := CreateTestDispatcher(t)
+
+	viper.Set("dispatcher.shutdown_timeout", 200*time.Millisecond)
+	t.Cleanup(func() {
+		viper.Set("dispatcher.shutdown_timeout", DefaultShutdownTimeout)
+	})
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = "drain_test"
+	setting.Enabled = true
+	setting.Rules["testRule"] = CreateTestProductRule()
+	setting.Rules["testRule"].Product = setting.Name
+	setting.RetryPolicy = &product_setting.RetryPolicy{
+		InitialInterval: "10ms",
+		MaxInterval:     "10ms",
+		Cooldown:        "10ms",
+	}
+
+	defer metrics.DeleteProduct("drain_test")
+
+	applySetting := func() {
+		data, err := json.Marshal(setting)
+		require.Nil(t, err)
+
+		_, err = d.productConfigStore.Put(setting.Name, data)
+		require.Nil(t, err)
+	}
+
+	isWatching := func() bool {
+		code, report := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK && report.Products["drain_test"] != nil && report.Products["drain_test"].Watching
+	}
+
+	getRanges := func() int {
+
+		entry, err := d.productManager.partitionStore.Get("drain_test")
+		require.Nil(t, err)
+
+		history, err := partitioning.Unmarshal(entry.Value())
+		require.Nil(t, err)
+
+		return len(history.Ranges)
+	}
+
+	applySetting()
+	require.Eventually(t, isWatching, 5*time.Second, 10*time.Millisecond)
+
+	js, err := d.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	publish := func(from int, to int) {
+		for i := from; i <= to; i++ {
+
+			raw, _ := json.Marshal(MessageRawData{
+				Event:      "dataCreated",
+				RawPayload: []byte(fmt.Sprintf(`{"id":%d,"name":"fred"}`, i)),
+			})
+
+			_, err := js.Publish("$GVT.default.EVENT.dataCreated", raw)
+			require.Nil(t, err)
+		}
+	}
+
+	waitEvents := func(count uint64) {
+		require.Eventually(t, func() bool {
+			stream, err := js.StreamInfo("GVT_default_DP_drain_test")
+			return err == nil && stream.State.Msgs == count
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	// Product stream accepts the first event only, so the rest are pending
+	info, err := js.StreamInfo("GVT_default_DP_drain_test")
+	require.Nil(t, err)
+
+	config := info.Config
+	config.MaxMsgs = 1
+	config.Discard = nats.DiscardNew
+	_, err = js.UpdateStream(&config)
+	require.Nil(t, err)
+
+	publish(1, 3)
+	waitEvents(1)
+
+	// Draining is timed out, so partitioning is not changed
+	setting.Partitions = 4
+	applySetting()
+
+	require.Never(t, func() bool {
+		return getRanges() != 1
+	}, time.Second, 50*time.Millisecond)
+
+	// Product keeps dispatching
+	require.Eventually(t, isWatching, 5*time.Second, 10*time.Millisecond)
+
+	config.MaxMsgs = -1
+	_, err = js.UpdateStream(&config)
+	require.Nil(t, err)
+
+	publish(4, 5)
+	waitEvents(5)
+
+	// Repartitioning works once events in progress were stored
+	applySetting()
+
+	require.Eventually(t, func() bool {
+		return getRanges() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
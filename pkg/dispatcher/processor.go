@@ -1,20 +1,23 @@
 package dispatcher
 
 import (
+	"context"
 	"fmt"
-	"hash"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/converter"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/rule_manager"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/tracing"
 	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
 	record_type "github.com/BrobridgeOrg/gravity-sdk/v2/types/record"
 	sequential_task_runner "github.com/BrobridgeOrg/sequential-task-runner"
-	"github.com/lithammer/go-jump-consistent-hash"
 	"github.com/nats-io/nats.go"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -39,14 +42,12 @@ type Processor struct {
 	runner        *sequential_task_runner.Runner
 	outputHandler func(*Message)
 	domain        string
-	hash          hash.Hash64
 }
 
 func NewProcessor(opts ...func(*Processor)) *Processor {
 
 	p := &Processor{
 		outputHandler: func(*Message) {},
-		hash:          jump.NewCRC64(),
 	}
 
 	// Apply options
@@ -117,8 +118,20 @@ func (p *Processor) process(msg *Message) *Message {
 		return msg
 	}
 
-	if msg.Rule == nil {
-		if !p.checkRule(msg) {
+	ctx, span := tracing.Start(msg.Context, "Processor.process",
+		attribute.String("gravity.event", msg.Event),
+	)
+	defer func() {
+		tracing.End(span, msg.Error)
+	}()
+
+	if len(msg.Rules) == 0 {
+		_, matchSpan := tracing.Start(ctx, "Processor.match")
+		matched := p.checkRule(msg)
+		matchSpan.SetAttributes(attribute.Int("gravity.rules", len(msg.Rules)))
+		matchSpan.End()
+
+		if !matched {
 			// No match found, so ignore
 			msg.Ignore = true
 			return msg
@@ -126,34 +139,53 @@ func (p *Processor) process(msg *Message) *Message {
 	}
 
 	// Parsing raw data
+	_, parseSpan := tracing.Start(ctx, "Processor.parse")
 	err := msg.ParseRawData()
+	tracing.End(parseSpan, err)
 	if err != nil {
-		logger.Error("Failed to parse message",
-			zap.Error(err),
-		)
+		msg.fail(DeadLetterStageParse, nil, err)
+		return msg
+	}
+
+	// Only rules whose filter matches the payload will be applied
+	if !p.filterRules(msg) {
+		span.SetAttributes(attribute.Bool("gravity.filtered", true))
 		msg.Ignore = true
 		return msg
 	}
 
 	//	p.calculatePrimaryKey(msg)
 
-	// Mapping and convert raw data to product_event object
-	product_event, err := p.convert(msg)
-	if err != nil {
-		// Failed to process payload
-		logger.Error("Failed to process payload",
-			zap.Error(err),
-		)
+	// Mapping and convert raw data to product_event objects for every rule
+	productEvents := make([]*gravity_sdk_types_product_event.ProductEvent, 0, len(msg.Rules))
+	outputIDs := make([]string, 0, len(msg.Rules))
+	for _, rule := range msg.Rules {
+
+		pes, err := p.convert(ctx, msg, rule)
+		if err != nil {
+
+			// Failed to process payload, so nothing would be output
+			for _, pe := range productEvents {
+				productEventPool.Put(pe)
+			}
+
+			return msg
+		}
+
+		// Rule ID is generated whenever rules are replaced, but rule name is unique in product and remains the same
+		for i := range pes {
+			outputIDs = append(outputIDs, rule.Name+"-"+strconv.Itoa(i))
+		}
+
+		productEvents = append(productEvents, pes...)
+	}
+
+	if len(productEvents) == 0 {
+		// Nothing to output
 		msg.Ignore = true
 		return msg
 	}
 
-	msg.ProductEvent = product_event
-
-	// Convert product_event to bytes
-	rawProductEvent, _ := gravity_sdk_types_product_event.Marshal(product_event)
-	msg.RawProductEvent = rawProductEvent
-
 	// Only avaialble if NATS message object exists
 	var header nats.Header
 	if msg.Msg != nil {
@@ -164,31 +196,63 @@ func (p *Processor) process(msg *Message) *Message {
 		header = msg.Msg.Header
 	}
 
-	// Calculate partion based on primary key
-	p.calculatePartition(msg)
+	for i, pe := range productEvents {
+		msg.Outputs = append(msg.Outputs, p.createOutput(msg, i, outputIDs[i], pe, header))
+	}
+
+	return msg
+}
+
+func (p *Processor) createOutput(msg *Message, index int, outputID string, pe *gravity_sdk_types_product_event.ProductEvent, header nats.Header) *MessageOutput {
+
+	// Every result has its own ID for deduplication, it depends on the rule which generated it rather than the
+	// order of matched rules, so a redelivered event has the same IDs after rules were changed.
+	output := &MessageOutput{
+		ID:           msg.ID + "-" + outputID,
+		ProductEvent: pe,
+	}
+
+	if index > 0 {
+
+		// Header would be modified while publishing so every output requires its own
+		if header != nil {
+			h := make(nats.Header, len(header))
+			for k, v := range header {
+				h[k] = append([]string(nil), v...)
+			}
+
+			header = h
+		}
+	}
+
+	// Convert product_event to bytes
+	output.RawProductEvent, _ = gravity_sdk_types_product_event.Marshal(pe)
+
+	// Calculate partion based on partitioning of product
+	output.Partition = p.calculatePartition(msg, pe)
 
 	// Output subject
 	subject := fmt.Sprintf("$GVT.%s.DP.%s.%d.EVENT.%s",
 		p.domain,
-		msg.ProductEvent.Table,
-		msg.Partition,
-		msg.ProductEvent.EventName,
+		pe.Table,
+		output.Partition,
+		pe.EventName,
 	)
 
 	// Prepare result object
-	msg.OutputMsg = natsMsgPool.Get().(*nats.Msg)
-	msg.OutputMsg.Subject = subject
-	msg.OutputMsg.Data = rawProductEvent
-	msg.OutputMsg.Header = header
+	output.Msg = natsMsgPool.Get().(*nats.Msg)
+	output.Msg.Subject = subject
+	output.Msg.Data = output.RawProductEvent
+	output.Msg.Header = header
 	/*
-		msg.OutputMsg = &nats.Msg{
+		output.Msg = &nats.Msg{
 			Subject: subject,
 			Data:    rawProductEvent,
 			Header:  header,
 		}
 	*/
 
-	return msg
+	return output
 }
 
 func (p *Processor) checkRule(msg *Message) bool {
@@ -197,16 +261,45 @@ func (p *Processor) checkRule(msg *Message) bool {
 		return false
 	}
 
-	rule := msg.Product.Rules.GetRuleByEvent(msg.Event)
-	if rule == nil {
+	rules := msg.Product.GetRules().GetRulesByEvent(msg.Event)
+	msg.Rules = append(msg.Rules, rules...)
+
+	if msg.Product.dryRun {
+		return len(msg.Rules) > 0
+	}
+
+	if len(msg.Rules) == 0 {
+		metrics.EventsIgnored.WithLabelValues(msg.Product.Name).Inc()
 		return false
 	}
 
-	msg.Rule = rule
+	metrics.EventsMatched.WithLabelValues(msg.Product.Name).Inc()
 
 	return true
 }
 
+func (p *Processor) filterRules(msg *Message) bool {
+
+	matched := msg.Rules[:0]
+	for _, rule := range msg.Rules {
+
+		if !rule.Match(msg.Data.Payload) {
+			continue
+		}
+
+		matched = append(matched, rule)
+
+		// Rules with lower priority will not be applied
+		if rule.StopOnMatch {
+			break
+		}
+	}
+
+	msg.Rules = matched
+
+	return len(msg.Rules) > 0
+}
+
 /*
 func (p *Processor) calculatePrimaryKey(msg *Message) {
 
@@ -225,36 +318,69 @@ func (p *Processor) calculatePrimaryKey(msg *Message) {
 		msg.Data.PrimaryKey = StrToBytes(pk)
 	}
 */
-func (p *Processor) calculatePartition(msg *Message) {
-	msg.Partition = jump.HashString(BytesToString(msg.ProductEvent.PrimaryKey), 256, p.hash)
-}
+func (p *Processor) calculatePartition(msg *Message, pe *gravity_sdk_types_product_event.ProductEvent) int32 {
 
-func (p *Processor) convert(msg *Message) (*gravity_sdk_types_product_event.ProductEvent, error) {
+	if msg.Product == nil {
+		return defaultPartitioner.Partition(pe)
+	}
 
-	// Prepare product_event
-	pe := productEventPool.Get().(*gravity_sdk_types_product_event.ProductEvent)
-	pe.Reset()
-	pe.EventName = msg.Data.Event
-	pe.Method = gravity_sdk_types_product_event.Method(gravity_sdk_types_product_event.Method_value[strings.ToUpper(msg.Rule.Method)])
-	pe.Table = msg.Rule.Product
-	pe.PrimaryKeys = msg.Rule.PrimaryKey
+	// Partitioner is replaced as a whole when settings are applied
+	partitioner := msg.Product.partitioner.Load()
+	if partitioner == nil {
+		return defaultPartitioner.Partition(pe)
+	}
+
+	return partitioner.Partition(pe)
+}
+
+func (p *Processor) convert(ctx context.Context, msg *Message, rule *rule_manager.Rule) ([]*gravity_sdk_types_product_event.ProductEvent, error) {
 
 	// Transforming
-	results, err := msg.Rule.Transform(nil, msg.Data.Payload)
+	_, transformSpan := tracing.Start(ctx, "Processor.transform",
+		attribute.String("gravity.rule", rule.Name),
+	)
+	results, err := rule.Transform(nil, msg.Data.Payload)
+	tracing.End(transformSpan, err)
 	if err != nil {
+		msg.fail(DeadLetterStageTransform, rule, err)
 		return nil, err
 	}
 
 	//fmt.Println(results)
 
-	if len(results) == 0 {
-		// Ignore
-		return nil, nil
+	_, convertSpan := tracing.Start(ctx, "Processor.convert",
+		attribute.String("gravity.rule", rule.Name),
+		attribute.Int("gravity.results", len(results)),
+	)
+
+	productEvents := make([]*gravity_sdk_types_product_event.ProductEvent, 0, len(results))
+	for _, result := range results {
+
+		pe, err := p.convertResult(msg, rule, result)
+		if err != nil {
+
+			// Release product events which were converted
+			for _, pe := range productEvents {
+				productEventPool.Put(pe)
+			}
+
+			tracing.End(convertSpan, err)
+			msg.fail(DeadLetterStageConvert, rule, err)
+			return nil, err
+		}
+
+		productEvents = append(productEvents, pe)
 	}
 
+	convertSpan.End()
+
+	return productEvents, nil
+}
+
+func (p *Processor) convertResult(msg *Message, rule *rule_manager.Rule, result map[string]interface{}) (*gravity_sdk_types_product_event.ProductEvent, error) {
+
 	// Fill product_event
-	result := results[0]
-	fields, err := converter.Convert(msg.Rule.Handler.GetDestinationSchema(), result)
+	fields, err := converter.Convert(rule.Handler.GetDestinationSchema(), result)
 	if err != nil {
 		return nil, err
 	}
@@ -263,11 +389,19 @@ func (p *Processor) convert(msg *Message) (*gravity_sdk_types_product_event.Prod
 	r.Payload.Map.Fields = fields
 
 	// Calcuate primary key
-	pk, err := r.CalculateKey(pe.PrimaryKeys)
+	pk, err := r.CalculateKey(rule.PrimaryKey)
 	if err != nil && err != record_type.ErrNotFoundKeyPath {
 		return nil, err
 	}
 
+	// Prepare product_event
+	pe := productEventPool.Get().(*gravity_sdk_types_product_event.ProductEvent)
+	pe.Reset()
+	pe.EventName = msg.Data.Event
+	pe.Method = gravity_sdk_types_product_event.Method(gravity_sdk_types_product_event.Method_value[strings.ToUpper(rule.Method)])
+	pe.Table = rule.Product
+	pe.PrimaryKeys = rule.PrimaryKey
+
 	if pk != nil {
 		pe.PrimaryKey = pk
 	}
@@ -2,19 +2,21 @@ package dispatcher
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/rule_manager"
-	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
 	record_type "github.com/BrobridgeOrg/gravity-sdk/v2/types/record"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
 func CreateTestRule() *rule_manager.Rule {
 
-	r := rule_manager.NewRule(product_sdk.NewRule())
+	r := rule_manager.NewRule(product_setting.NewRule())
 	r.Event = "dataCreated"
 	r.Product = "TestDataProduct"
 	r.PrimaryKey = []string{
@@ -56,7 +58,7 @@ func CreateTestMessage() *Message {
 	testRuleManager.AddRule(r)
 
 	msg := NewMessage()
-	msg.Rule = r
+	msg.Rules = []*rule_manager.Rule{r}
 
 	return msg
 }
@@ -80,10 +82,10 @@ func TestProcessorOutput(t *testing.T) {
 
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			assert.Equal(t, "dataCreated", msg.ProductEvent.EventName)
-			assert.Equal(t, "TestDataProduct", msg.ProductEvent.Table)
+			assert.Equal(t, "dataCreated", msg.Outputs[0].ProductEvent.EventName)
+			assert.Equal(t, "TestDataProduct", msg.Outputs[0].ProductEvent.Table)
 
-			r, err := msg.ProductEvent.GetContent()
+			r, err := msg.Outputs[0].ProductEvent.GetContent()
 			assert.Equal(t, nil, err)
 
 			for _, field := range r.Payload.Map.Fields {
@@ -122,10 +124,10 @@ func TestProcessor_UpdateNestedFields(t *testing.T) {
 
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			assert.Equal(t, "dataCreated", msg.ProductEvent.EventName)
-			assert.Equal(t, "TestDataProduct", msg.ProductEvent.Table)
+			assert.Equal(t, "dataCreated", msg.Outputs[0].ProductEvent.EventName)
+			assert.Equal(t, "TestDataProduct", msg.Outputs[0].ProductEvent.Table)
 
-			r, err := msg.ProductEvent.GetContent()
+			r, err := msg.Outputs[0].ProductEvent.GetContent()
 			if !assert.Nil(t, err) {
 				return
 			}
@@ -176,12 +178,12 @@ func TestProcessorOutputsWithMultipleInputs(t *testing.T) {
 
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			assert.Equal(t, "dataCreated", msg.ProductEvent.EventName)
-			assert.Equal(t, "TestDataProduct", msg.ProductEvent.Table)
+			assert.Equal(t, "dataCreated", msg.Outputs[0].ProductEvent.EventName)
+			assert.Equal(t, "TestDataProduct", msg.Outputs[0].ProductEvent.Table)
 
 			count++
 
-			r, err := msg.ProductEvent.GetContent()
+			r, err := msg.Outputs[0].ProductEvent.GetContent()
 			assert.Equal(t, nil, err)
 
 			for _, field := range r.Payload.Map.Fields {
@@ -268,14 +270,14 @@ func TestProcessorOutputsWithVariousInputs(t *testing.T) {
 
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			assert.Equal(t, "dataCreated", msg.ProductEvent.EventName)
-			assert.Equal(t, "TestDataProduct", msg.ProductEvent.Table)
+			assert.Equal(t, "dataCreated", msg.Outputs[0].ProductEvent.EventName)
+			assert.Equal(t, "TestDataProduct", msg.Outputs[0].ProductEvent.Table)
 
 			payload := payloads[int(count)]
 
 			count++
 
-			r, err := msg.ProductEvent.GetContent()
+			r, err := msg.Outputs[0].ProductEvent.GetContent()
 			assert.Equal(t, nil, err)
 			assert.Equal(t, len(payload), len(r.Payload.Map.Fields))
 
@@ -316,3 +318,363 @@ func TestProcessorOutputsWithVariousInputs(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestProcessor_DeadLetter(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	results := make(chan *Message)
+
+	p := NewProcessor(
+		WithOutputHandler(func(msg *Message) {
+			results <- msg
+		}),
+	)
+	defer p.Close()
+
+	// Invalid raw data
+	msg := CreateTestMessage()
+	msg.Raw = []byte(`{"event":"dataCreated"`)
+
+	p.Push(msg)
+
+	m := <-results
+	assert.True(t, m.Ignore)
+	assert.Equal(t, DeadLetterStageParse, m.FailedStage)
+	assert.NotNil(t, m.Error)
+
+	// Script throws an exception
+	testRuleManager := rule_manager.NewRuleManager()
+	r := CreateTestRule()
+	r.HandlerConfig = &product_setting.HandlerConfig{
+		Type:   "script",
+		Script: `throw new Error("failed")`,
+	}
+	testRuleManager.AddRule(r)
+
+	testData := MessageRawData{
+		Event:      "dataCreated",
+		RawPayload: []byte(`{"id":101,"name":"fred"}`),
+	}
+
+	msg = NewMessage()
+	msg.Rules = []*rule_manager.Rule{r}
+	msg.Raw, _ = json.Marshal(testData)
+
+	p.Push(msg)
+
+	m = <-results
+	assert.True(t, m.Ignore)
+	assert.Equal(t, DeadLetterStageTransform, m.FailedStage)
+	assert.NotNil(t, m.Error)
+}
+
+func TestProcessor_MultipleResults(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	results := make(chan *Message)
+
+	p := NewProcessor(
+		WithDomain("default"),
+		WithOutputHandler(func(msg *Message) {
+			results <- msg
+		}),
+	)
+	defer p.Close()
+
+	// Split one event into multiple records
+	testRuleManager := rule_manager.NewRuleManager()
+	r := CreateTestRule()
+	r.HandlerConfig = &product_setting.HandlerConfig{
+		Type: "script",
+		Script: `
+		return source.tags.map(function(tag, i) {
+			return {
+				id: source.id * 10 + i,
+				name: tag
+			}
+		})
+		`,
+	}
+	testRuleManager.AddRule(r)
+
+	testData := MessageRawData{
+		Event:      "dataCreated",
+		RawPayload: []byte(`{"id":101,"tags":["a","b","c"]}`),
+	}
+
+	msg := NewMessage()
+	msg.Rules = []*rule_manager.Rule{r}
+	msg.Raw, _ = json.Marshal(testData)
+
+	p.Push(msg)
+
+	m := <-results
+	if !assert.Len(t, m.Outputs, 3) {
+		return
+	}
+
+	ids := make(map[string]struct{})
+	for i, output := range m.Outputs {
+
+		ids[output.ID] = struct{}{}
+
+		r, err := output.ProductEvent.GetContent()
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		id, err := GetFieldValue(r, "id")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1010+i), id)
+
+		name, err := GetFieldValue(r, "name")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}[i], name)
+
+		assert.Equal(t, p.calculatePartition(m, output.ProductEvent), output.Partition)
+		assert.Equal(t, fmt.Sprintf("$GVT.default.DP.TestDataProduct.%d.EVENT.dataCreated", output.Partition), output.Msg.Subject)
+	}
+
+	// Deduplication IDs must be unique
+	assert.Len(t, ids, 3)
+}
+
+func TestProcessor_OutputIDs(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	results := make(chan *Message)
+
+	p := NewProcessor(
+		WithDomain("default"),
+		WithOutputHandler(func(msg *Message) {
+			results <- msg
+		}),
+	)
+	defer p.Close()
+
+	createRules := func() (*rule_manager.Rule, *rule_manager.Rule) {
+
+		testRuleManager := rule_manager.NewRuleManager()
+
+		split := CreateTestRule()
+		split.Name = "split"
+		split.HandlerConfig = &product_setting.HandlerConfig{
+			Type:   "script",
+			Script: `return [ { id: source.id, name: "a" }, { id: source.id, name: "b" } ]`,
+		}
+		require.Nil(t, testRuleManager.AddRule(split))
+
+		copied := CreateTestRule()
+		copied.Name = "copied"
+		require.Nil(t, testRuleManager.AddRule(copied))
+
+		return split, copied
+	}
+
+	process := func(rules ...*rule_manager.Rule) []string {
+
+		testData := MessageRawData{
+			Event:      "dataCreated",
+			RawPayload: []byte(`{"id":101,"name":"fred"}`),
+		}
+
+		msg := NewMessage()
+		msg.Rules = rules
+		msg.Raw, _ = json.Marshal(testData)
+
+		p.Push(msg)
+
+		m := <-results
+		require.Nil(t, m.Error)
+
+		ids := make([]string, 0)
+		for _, output := range m.Outputs {
+			ids = append(ids, output.ID)
+		}
+
+		return ids
+	}
+
+	split, copied := createRules()
+	assert.Equal(t, []string{"-split-0", "-split-1", "-copied-0"}, process(split, copied))
+
+	// Rules were replaced, outputs of the same rule have the same IDs
+	_, copied = createRules()
+	assert.Equal(t, []string{"-copied-0"}, process(copied))
+}
+
+func TestProcessor_Filter(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	results := make(chan *Message)
+
+	p := NewProcessor(
+		WithOutputHandler(func(msg *Message) {
+			results <- msg
+		}),
+	)
+	defer p.Close()
+
+	testRuleManager := rule_manager.NewRuleManager()
+	r := CreateTestRule()
+	r.Filter = &product_setting.Filter{
+		Conditions: []*product_setting.Condition{
+			{Field: "gender", Operator: "in", Value: []interface{}{"male", "female"}},
+			{Field: "id", Operator: "gte", Value: float64(100)},
+			{Field: "nested.nested_id", Operator: "exists"},
+		},
+	}
+	assert.Nil(t, testRuleManager.AddRule(r))
+
+	testCases := []struct {
+		payload string
+		matched bool
+	}{
+		{`{"id":101,"name":"fred","gender":"male","nested":{"nested_id":"n1"}}`, true},
+		{`{"id":99,"name":"fred","gender":"male","nested":{"nested_id":"n1"}}`, false},
+		{`{"id":101,"name":"fred","gender":"unknown","nested":{"nested_id":"n1"}}`, false},
+		{`{"id":101,"name":"fred","gender":"female"}`, false},
+	}
+
+	for i, tc := range testCases {
+
+		testData := MessageRawData{
+			Event:      "dataCreated",
+			RawPayload: []byte(tc.payload),
+		}
+
+		msg := NewMessage()
+		msg.Rules = []*rule_manager.Rule{r}
+		msg.Raw, _ = json.Marshal(testData)
+
+		p.Push(msg)
+
+		m := <-results
+		assert.Equal(t, !tc.matched, m.Ignore, fmt.Sprintf("case %d", i))
+		assert.Nil(t, m.Error)
+
+		if tc.matched {
+			assert.Equal(t, 1, len(m.Outputs))
+		} else {
+			assert.Equal(t, 0, len(m.Outputs))
+		}
+	}
+
+	// Invalid operator
+	r = CreateTestRule()
+	r.Filter = &product_setting.Filter{
+		Conditions: []*product_setting.Condition{
+			{Field: "gender", Operator: "like", Value: "m%"},
+		},
+	}
+	assert.ErrorIs(t, testRuleManager.AddRule(r), rule_manager.ErrInvalidFilterOperator)
+}
+
+func TestProcessor_NativeHandler(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	results := make(chan *Message)
+
+	p := NewProcessor(
+		WithOutputHandler(func(msg *Message) {
+			results <- msg
+		}),
+	)
+	defer p.Close()
+
+	testCases := []struct {
+		config   *product_setting.HandlerConfig
+		expected map[string]interface{}
+	}{
+		{
+			config: &product_setting.HandlerConfig{
+				Type: "mapping",
+				Mapping: []*product_setting.FieldMapping{
+					{Action: "copy", Source: "name", Target: "gender"},
+					{Action: "drop", Source: "tags"},
+				},
+			},
+			expected: map[string]interface{}{
+				"id":     int64(101),
+				"name":   "fred",
+				"gender": "fred",
+			},
+		},
+		{
+			config: &product_setting.HandlerConfig{
+				Type: "constant",
+				Constants: map[string]interface{}{
+					"gender": "male",
+				},
+			},
+			expected: map[string]interface{}{
+				"id":     int64(101),
+				"name":   "fred",
+				"gender": "male",
+			},
+		},
+		{
+			config: &product_setting.HandlerConfig{
+				Type: "cast",
+			},
+			expected: map[string]interface{}{
+				"id":   int64(101),
+				"name": "fred",
+			},
+		},
+	}
+
+	testData := MessageRawData{
+		Event:      "dataCreated",
+		RawPayload: []byte(`{"id":"101","name":"fred","tags":["a","b"]}`),
+	}
+
+	for _, tc := range testCases {
+
+		testRuleManager := rule_manager.NewRuleManager()
+		r := CreateTestRule()
+		r.HandlerConfig = tc.config
+		assert.Nil(t, testRuleManager.AddRule(r))
+		assert.Nil(t, r.Handler.Transformer)
+
+		msg := NewMessage()
+		msg.Rules = []*rule_manager.Rule{r}
+		msg.Raw, _ = json.Marshal(testData)
+
+		p.Push(msg)
+
+		m := <-results
+		if !assert.Equal(t, 1, len(m.Outputs), tc.config.Type) {
+			continue
+		}
+
+		record, err := m.Outputs[0].ProductEvent.GetContent()
+		assert.Nil(t, err)
+
+		for name, value := range tc.expected {
+			v, err := GetFieldValue(record, name)
+			assert.Nil(t, err, name)
+			assert.Equal(t, value, v, tc.config.Type)
+		}
+
+		if tc.config.Type == "mapping" {
+			_, err := GetFieldValue(record, "tags")
+			assert.NotNil(t, err)
+		}
+	}
+
+	// Invalid mapping
+	r := CreateTestRule()
+	r.HandlerConfig = &product_setting.HandlerConfig{
+		Type: "mapping",
+		Mapping: []*product_setting.FieldMapping{
+			{Action: "rename", Source: "name"},
+		},
+	}
+	assert.ErrorIs(t, rule_manager.NewRuleManager().AddRule(r), rule_manager.ErrInvalidFieldMapping)
+}
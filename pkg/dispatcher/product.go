@@ -1,19 +1,27 @@
 package dispatcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/connector"
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/rule_manager"
-	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/tracing"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dispatch_state"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
 	"github.com/BrobridgeOrg/schemer"
 	buffered_input "github.com/cfsghost/buffered-input"
 	"github.com/google/uuid"
 	"github.com/klauspost/compress/s2"
 	"github.com/nats-io/nats.go"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -22,12 +30,14 @@ const (
 	DefaultProductMaxStreamBytes   = 8 * 1024 * 1024 * 1024 // 8GB
 	DefaultProductMaxStreamAge     = 7 * 24 * time.Hour     // 1 week
 	DefaultProductDuplicates       = 5 * time.Minute        // 5 minutes
+	DefaultProductDrainInterval    = 10 * time.Millisecond
 )
 
 const (
 	productEventStream  = "GVT_%s_DP_%s"
 	productEventSubject = "$GVT.%s.DP.%s.*.EVENT.>"
 	domainEventConsumer = "GVT_%s_DP_%s"
+	productStateBucket  = "GVT_%s_PRODUCT_STATE"
 )
 
 type ProductSetting struct {
@@ -38,8 +48,10 @@ type ProductSetting struct {
 }
 
 type ProductManager struct {
-	dispatcher *Dispatcher
-	products   sync.Map
+	dispatcher     *Dispatcher
+	products       sync.Map
+	stateStore     nats.KeyValue
+	partitionStore nats.KeyValue
 }
 
 func NewProductManager(d *Dispatcher) *ProductManager {
@@ -79,19 +91,16 @@ func (pm *ProductManager) assertProductStream(name string, streamName string) er
 	)
 
 	// Check if the stream already exists
-	stream, err := js.StreamInfo(streamName)
-	if err != nil {
-		if err != nats.ErrStreamNotFound {
-			return err
-		}
+	check := func() (bool, error) {
+		return streamExists(js, streamName)
+	}
+
+	return pm.dispatcher.provision(streamName, check, func() error {
 
 		logger.Warn("Product stream is not ready",
 			zap.String("product", name),
 			zap.String("stream", streamName),
 		)
-	}
-
-	if stream == nil {
 
 		// Event subject
 		subject := fmt.Sprintf(productEventSubject, pm.dispatcher.connector.GetDomain(), name)
@@ -130,10 +139,57 @@ func (pm *ProductManager) assertProductStream(name string, streamName string) er
 				return err
 			}
 		}
+
+		return nil
+	})
+}
+
+func (pm *ProductManager) assertStateStore() error {
+
+	if pm.stateStore != nil {
+		return nil
+	}
+
+	js, err := pm.dispatcher.connector.GetClient().GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	bucket := fmt.Sprintf(productStateBucket, pm.dispatcher.connector.GetDomain())
+
+	kv, err := assertKeyValue(js, pm.dispatcher.provision, &nats.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Gravity product state",
+		History:     1,
+		Replicas:    3,
+	})
+	if err != nil {
+		return err
 	}
 
+	pm.stateStore = kv
+
 	return nil
+}
+
+func (pm *ProductManager) updateDispatchState(name string, s *dispatch_state.State) {
+
+	if pm.stateStore == nil {
+		return
+	}
 
+	data, err := s.Marshal()
+	if err != nil {
+		return
+	}
+
+	_, err = pm.stateStore.Put(name, data)
+	if err != nil {
+		logger.Warn("Failed to update dispatch state",
+			zap.String("product", name),
+			zap.Error(err),
+		)
+	}
 }
 
 func (pm *ProductManager) CreateProduct(name string, streamName string) *Product {
@@ -148,9 +204,37 @@ func (pm *ProductManager) CreateProduct(name string, streamName string) *Product
 		return nil
 	}
 
+	// Assert dead-letter stream
+	err = pm.assertDeadLetterStream(name)
+	if err != nil {
+		logger.Error("Failed to create dead-letter stream",
+			zap.Error(err),
+		)
+
+		return nil
+	}
+
+	// State is not essential for dispatching
+	err = pm.assertStateStore()
+	if err != nil {
+		logger.Warn("Failed to initialize state store",
+			zap.Error(err),
+		)
+	}
+
+	err = pm.assertPartitionStore()
+	if err != nil {
+		logger.Warn("Failed to initialize partition store",
+			zap.Error(err),
+		)
+	}
+
 	p := NewProduct(pm)
-	p.Domain = pm.dispatcher.connector.GetDomain()
 	p.Name = name
+	p.stream = streamName
+
+	// Product will be dispatched after replica acquired it
+	p.standby.Store(pm.dispatcher.coordinator != nil)
 
 	// Generate ID
 	id, _ := uuid.NewUUID()
@@ -173,6 +257,17 @@ func (pm *ProductManager) DeleteProduct(name string) error {
 	p := v.(*Product)
 	p.StopEventWatcher()
 
+	pm.triggerCoordinator()
+
+	metrics.DeleteProduct(name)
+
+	err := p.deleteSnapshot()
+	if err != nil {
+		logger.Warn("Failed to delete snapshot",
+			zap.Error(err),
+		)
+	}
+
 	js, err := pm.dispatcher.connector.GetClient().GetJetStream()
 	if err != nil {
 		return err
@@ -188,9 +283,84 @@ func (pm *ProductManager) DeleteProduct(name string) error {
 		return nil
 	}
 
+	if pm.stateStore != nil {
+		err = pm.stateStore.Delete(name)
+		if err != nil && err != nats.ErrKeyNotFound {
+			logger.Warn("Failed to delete dispatch state",
+				zap.Error(err),
+			)
+		}
+	}
+
+	if pm.partitionStore != nil {
+		err = pm.partitionStore.Delete(name)
+		if err != nil && err != nats.ErrKeyNotFound {
+			logger.Warn("Failed to delete partitioning history",
+				zap.Error(err),
+			)
+		}
+	}
+
+	err = pm.deleteDeadLetterStream(name)
+	if err != nil {
+		logger.Warn("Failed to delete dead-letter stream",
+			zap.Error(err),
+		)
+
+		return nil
+	}
+
 	return nil
 }
 
+// Drain stops all products after events in progress were stored. Events which can not be stored before
+// context is done will be redelivered next time.
+func (pm *ProductManager) Drain(ctx context.Context) {
+
+	var wg sync.WaitGroup
+
+	pm.products.Range(func(key interface{}, value interface{}) bool {
+
+		p := value.(*Product)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := p.Drain(ctx)
+			if err != nil {
+				logger.Warn("Failed to drain product",
+					zap.String("product", p.Name),
+					zap.Int("pending", p.acks.Pending()),
+					zap.Error(err),
+				)
+			}
+
+			err = p.deactivate()
+			if err != nil {
+				logger.Error("Failed to deactivate product",
+					zap.String("product", p.Name),
+					zap.Error(err),
+				)
+			}
+
+			if p.snapshot != nil {
+				err = p.snapshot.Stop()
+				if err != nil {
+					logger.Error("Failed to stop snapshot",
+						zap.String("product", p.Name),
+						zap.Error(err),
+					)
+				}
+			}
+		}()
+
+		return true
+	})
+
+	wg.Wait()
+}
+
 func (pm *ProductManager) GetProduct(name string) *Product {
 
 	v, ok := pm.products.Load(name)
@@ -201,7 +371,7 @@ func (pm *ProductManager) GetProduct(name string) *Product {
 	return v.(*Product)
 }
 
-func (pm *ProductManager) ApplySettings(name string, setting *product_sdk.ProductSetting) error {
+func (pm *ProductManager) ApplySettings(name string, setting *product_setting.ProductSetting) error {
 
 	ruleCount := 0
 	if setting.Rules != nil {
@@ -224,7 +394,7 @@ func (pm *ProductManager) ApplySettings(name string, setting *product_sdk.Produc
 		// New dataProduct
 		p := pm.CreateProduct(name, setting.Stream)
 
-		return p.ApplySettings(setting)
+		return pm.applyProductSettings(p, setting)
 	}
 
 	logger.Info("Update product",
@@ -233,32 +403,154 @@ func (pm *ProductManager) ApplySettings(name string, setting *product_sdk.Produc
 
 	// Apply new settings
 	p := v.(*Product)
+	return pm.applyProductSettings(p, setting)
+}
+
+func (pm *ProductManager) applyProductSettings(p *Product, setting *product_setting.ProductSetting) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Product might be enabled or disabled, so assignment of replicas should be updated
+	defer pm.triggerCoordinator()
+
 	return p.ApplySettings(setting)
 }
 
+func (pm *ProductManager) triggerCoordinator() {
+
+	if pm.dispatcher == nil || pm.dispatcher.coordinator == nil {
+		return
+	}
+
+	pm.dispatcher.coordinator.Trigger()
+}
+
+// Assignable returns products which have to be dispatched by one of replicas
+func (pm *ProductManager) Assignable() []string {
+
+	names := make([]string, 0)
+
+	pm.products.Range(func(key interface{}, value interface{}) bool {
+
+		p := value.(*Product)
+
+		p.mutex.Lock()
+		enabled := p.Enabled.Load()
+		p.mutex.Unlock()
+
+		if enabled {
+			names = append(names, key.(string))
+		}
+
+		return true
+	})
+
+	return names
+}
+
+// Acquired starts dispatching product which was assigned to this replica
+func (pm *ProductManager) Acquired(name string) error {
+
+	p := pm.GetProduct(name)
+	if p == nil {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.standby.Store(false)
+
+	err := p.Activate()
+	if err != nil {
+		return err
+	}
+
+	return p.applySnapshot(p.enabledSnapshot)
+}
+
+// Released stops dispatching product which was assigned to another replica. Events which can not be stored
+// before context is done will be redelivered to the new owner.
+func (pm *ProductManager) Released(ctx context.Context, name string) {
+
+	p := pm.GetProduct(name)
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.standby.Store(true)
+
+	err := p.Drain(ctx)
+	if err != nil {
+		logger.Warn("Failed to drain product",
+			zap.String("product", name),
+			zap.Int("pending", p.acks.Pending()),
+			zap.Error(err),
+		)
+	}
+
+	err = p.deactivate()
+	if err != nil {
+		logger.Error("Failed to deactivate product",
+			zap.String("product", name),
+			zap.Error(err),
+		)
+	}
+
+	err = p.applySnapshot(p.enabledSnapshot)
+	if err != nil {
+		logger.Error("Failed to stop snapshot",
+			zap.String("product", name),
+			zap.Error(err),
+		)
+	}
+}
+
 type Product struct {
 	ID        string
 	Domain    string
-	Name      string
-	Enabled   bool
-	Rules     *rule_manager.RuleManager
-	Schema    *schemer.Schema
-	IsRunning bool
+	Name      string // Never changed after product was created, workers read it without lock
+	Enabled   atomic.Bool
+	Schema    *schemer.Schema // Guarded by mutex, workers read schema from rules which are replaced atomically
+	IsRunning atomic.Bool
 
 	processor        *Processor
 	dispatcherBuffer *buffered_input.BufferedInput
 	manager          *ProductManager
 	watcher          *EventWatcher
+	acks             *AckTracker
+	breaker          *CircuitBreaker
+	snapshot         *Snapshot
+	partitioner      atomic.Pointer[Partitioner]
+	rules            atomic.Pointer[rule_manager.RuleManager]
+	stream           string
 	onMessage        func(msg *Message)
+	dryRun           bool        // Events are processed for testing rules only
+	standby          atomic.Bool // Product is dispatched by another replica
+	enabledSnapshot  bool
+	mutex            sync.Mutex
 }
 
 func NewProduct(pm *ProductManager) *Product {
 
 	p := &Product{
-		Rules:   rule_manager.NewRuleManager(),
 		manager: pm,
 	}
 
+	// Processor publishes events to domain of product
+	if pm != nil && pm.dispatcher != nil {
+		p.Domain = pm.dispatcher.connector.GetDomain()
+	}
+
+	p.rules.Store(rule_manager.NewRuleManager())
+	p.acks = NewAckTracker()
+	p.breaker = NewCircuitBreaker(NewRetryPolicy(nil), p.updateDispatchState)
+	p.partitioner.Store(NewPartitioner(nil))
+
 	p.reset()
 	p.onMessage = p.dispatch
 
@@ -296,6 +588,11 @@ func (p *Product) reset() {
 	)
 }
 
+// GetRules returns rules in use, rules are replaced as a whole when settings are applied
+func (p *Product) GetRules() *rule_manager.RuleManager {
+	return p.rules.Load()
+}
+
 func (p *Product) getConnector() *connector.Connector {
 	return p.manager.dispatcher.connector
 }
@@ -308,8 +605,11 @@ func (p *Product) init() error {
 	p.watcher = NewEventWatcher(
 		connector.GetClient(),
 		p.Domain,
+		p.Name,
 		fmt.Sprintf(domainEventConsumer, connector.GetDomain(), p.Name),
 	)
+	p.watcher.provision = p.manager.dispatcher.provision
+	p.watcher.leased = p.manager.dispatcher.coordinator != nil
 
 	err := p.watcher.Init()
 	if err != nil {
@@ -325,87 +625,127 @@ func (p *Product) emit(msg *Message) {
 
 func (p *Product) dispatcherBufferHandler(chunk []interface{}) {
 
-	doneCount := 0
-	var prev *Message
-	msgs := make([]*Message, 0)
+	metrics.BufferDepth.WithLabelValues(p.Name).Sub(float64(len(chunk)))
+
+	msgs := make([]*Message, len(chunk))
 	for i, v := range chunk {
+		msgs[i] = v.(*Message)
+	}
 
-		if !p.IsRunning {
+	for len(msgs) > 0 {
+
+		if !p.IsRunning.Load() {
 			return
 		}
 
-		m := v.(*Message)
+		count, err := p.publish(msgs)
+		if count > 0 {
 
-		/*
-			fmt.Println("Dispatching message", m.Event)
-			fmt.Println(string(m.Data.RawPayload))
-			fmt.Println(m.Data.Payload)
-		*/
-		err := m.Dispatch()
-		if err != nil {
-
-			// Ack for the last message
-			if prev != nil {
-				prev.Ack()
-				prev.Release()
-				doneCount = i
-
-				logger.Info("Messages were dispatched",
-					zap.String("product", p.Name),
-					zap.Int("count", i),
-				)
+			// Events were stored, so source messages can be acked
+			for _, m := range msgs[:count] {
+				p.acks.Done(m.Msg)
+				m.Release()
 			}
 
-			logger.Error("Failed to dispatch",
-				zap.Error(err),
+			logger.Info("Messages were dispatched",
+				zap.String("product", p.Name),
+				zap.Int("count", count),
 			)
 
-			// Retry
-			for {
-				time.Sleep(time.Second)
+			p.breaker.Success()
+			msgs = msgs[count:]
+		}
 
-				if !p.IsRunning {
-					return
-				}
+		if err == nil {
+			continue
+		}
 
-				logger.Info("Retrying to ack",
-					zap.String("product", p.Name),
-				)
+		delay := p.breaker.Failure(err)
+		state := p.breaker.State()
 
-				err := m.Dispatch()
-				if err == nil {
-					// Success
-					break
-				}
-			}
+		metrics.DispatchRetries.WithLabelValues(p.Name).Inc()
+
+		logger.Error("Failed to dispatch",
+			zap.String("product", p.Name),
+			zap.String("breaker", state.Breaker),
+			zap.Int("failures", state.Failures),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		// Retry with rest of messages
+		if !p.sleep(delay) {
+			return
 		}
 
-		msgs = append(msgs, m)
-		prev = m
+		p.breaker.Probe()
+
+		logger.Info("Retrying to dispatch",
+			zap.String("product", p.Name),
+			zap.Int("count", len(msgs)),
+		)
+	}
+}
+
+// publish dispatches messages and waits for acks. It returns the number of leading messages which were stored,
+// messages after that have to be published again because publishing is deduplicated by message ID.
+func (p *Product) publish(msgs []*Message) (int, error) {
+
+	count := len(msgs)
+
+	var dispatchErr error
+	for i, m := range msgs {
+		err := m.Dispatch()
+		if err != nil {
+			count = i
+			dispatchErr = err
+			break
+		}
 	}
 
 	// Wait for all messages to be dispatched
-	for _, m := range msgs {
+	for i, m := range msgs[:count] {
 		err := m.Wait()
 		if err != nil {
-			logger.Error("Failed to wait for ack",
-				zap.Error(err),
-			)
+			return i, err
 		}
 	}
 
-	if doneCount < len(chunk) {
-		prev.Ack()
-		prev.Release()
+	return count, dispatchErr
+}
 
-		logger.Info("Messages were dispatched",
-			zap.String("product", p.Name),
-			zap.Int("count", len(chunk)-doneCount),
-		)
+// sleep returns false if product was stopped while sleeping
+func (p *Product) sleep(d time.Duration) bool {
+
+	deadline := time.Now().Add(d)
+	for p.IsRunning.Load() {
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return true
+		}
+
+		if remaining > 100*time.Millisecond {
+			remaining = 100 * time.Millisecond
+		}
+
+		time.Sleep(remaining)
+	}
+
+	return false
+}
+
+func (p *Product) updateDispatchState(s *dispatch_state.State) {
+
+	if p.manager == nil {
+		return
 	}
+
+	p.manager.updateDispatchState(p.Name, s)
 }
 
 func (p *Product) dispatch(msg *Message) {
+	metrics.BufferDepth.WithLabelValues(p.Name).Inc()
 	p.dispatcherBuffer.Push(msg)
 }
 
@@ -413,6 +753,12 @@ func (p *Product) handleMessage(eventName string, msg *nats.Msg) {
 
 	data := msg.Data
 
+	// Event was replayed from dead-letter stream of another product
+	target := msg.Header.Get(DeadLetterHeaderTarget)
+	if len(target) > 0 && target != p.Name {
+		eventName = ""
+	}
+
 	// Decompress message
 	if msg.Header.Get("Content-Encoding") == "s2" {
 		decompressedMessage, err := s2.Decode(nil, msg.Data)
@@ -427,7 +773,19 @@ func (p *Product) handleMessage(eventName string, msg *nats.Msg) {
 		data = decompressedMessage
 	}
 
+	// Message will be acked after events were stored
+	p.acks.Track(msg)
+
+	// Continue trace from source
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), msg.Header), "Product.handleMessage",
+		attribute.String("gravity.product", p.Name),
+		attribute.String("gravity.event", eventName),
+		attribute.String("messaging.destination.name", msg.Subject),
+	)
+	defer span.End()
+
 	m := NewMessage()
+	m.Context = ctx
 	m.Publisher = p.manager.dispatcher.publisherJSCtx
 	m.Event = eventName
 	m.Msg = msg
@@ -453,72 +811,166 @@ func (p *Product) HandleRawMessage(eventName string, raw []byte) {
 	p.processor.Push(m)
 }
 
-func (p *Product) ApplySettings(setting *product_sdk.ProductSetting) error {
+func (p *Product) ApplySettings(setting *product_setting.ProductSetting) error {
 
-	err := p.deactivate()
-	if err != nil {
-		return err
+	// Product schema
+	schema := p.Schema
+	if setting.Schema != nil {
+		schema = schemer.NewSchema()
+		err := schemer.Unmarshal(setting.Schema, schema)
+		if err != nil {
+			return err
+		}
 	}
 
-	p.PurgeTasks()
+	// Events in progress have to be stored before partitioning is changed
+	partitioner := NewPartitioner(setting)
+	repartitioning := !partitioner.Range().Equal(p.partitioner.Load().Range())
+	if repartitioning {
 
-	p.Name = setting.Name
-	p.Enabled = setting.Enabled
+		ctx, cancel := context.WithTimeout(context.Background(), GetShutdownTimeout())
+		err := p.Drain(ctx)
+		cancel()
+		if err != nil {
 
-	// Product schema
-	if setting.Schema != nil {
-		p.Schema = schemer.NewSchema()
-		err := schemer.Unmarshal(setting.Schema, p.Schema)
+			logger.Warn("Failed to drain product before repartitioning",
+				zap.String("product", p.Name),
+				zap.Int("pending", p.acks.Pending()),
+				zap.Error(err),
+			)
+
+			// Keep dispatching with previous partitioning, product is stopped if it's unable to resume
+			watchErr := p.StartEventWatcher()
+			if watchErr != nil {
+				p.deactivate()
+				return errors.Join(err, watchErr)
+			}
+
+			return err
+		}
+
+		p.partitioner.Store(partitioner)
+	}
+
+	// Product is restarted only if it was enabled, disabled or moved to another stream, otherwise rules are
+	// replaced while events are still being dispatched.
+	if setting.Enabled != p.Enabled.Load() || setting.Stream != p.stream {
+
+		err := p.deactivate()
 		if err != nil {
 			return err
 		}
+
+		p.PurgeTasks()
+
+		err = p.applyStream(setting.Stream)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Product which was created without manager is named by its first settings, it's never renamed while running
+	if len(p.Name) == 0 {
+		p.Name = setting.Name
 	}
 
-	//TODO: do nothing if only snapshot settings was changed
+	p.Enabled.Store(setting.Enabled)
+	p.Schema = schema
+	p.breaker.SetPolicy(NewRetryPolicy(setting.RetryPolicy))
 
 	// Apply new rules
-	rules := make([]*product_sdk.Rule, 0)
+	rules := make([]*product_setting.Rule, 0)
 	for _, rule := range setting.Rules {
 		rules = append(rules, rule)
 	}
-	p.ApplyRules(rules)
+	err := p.ApplyRules(rules)
+	if err != nil {
+		logger.Error("Invalid rules were ignored",
+			zap.String("product", p.Name),
+			zap.Error(err),
+		)
+	}
 
 	err = p.Activate()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	p.enabledSnapshot = setting.EnabledSnapshot
+
+	return p.applySnapshot(p.enabledSnapshot)
+}
+
+// applyStream asserts product stream if it was changed
+func (p *Product) applyStream(streamName string) error {
+
+	if streamName == p.stream {
+		return nil
+	}
+
+	if p.manager != nil {
+		err := p.manager.assertProductStream(p.Name, streamName)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.stream = streamName
+
+	// Snapshot consumes events from previous stream
+	if p.snapshot == nil {
+		return nil
+	}
+
+	err := p.snapshot.Stop()
+	p.snapshot = nil
+
+	return err
 }
 
-func (p *Product) ApplyRules(rules []*product_sdk.Rule) error {
+func (p *Product) ApplyRules(rules []*product_setting.Rule) error {
 
 	// Preparing new rules
 	rm := rule_manager.NewRuleManager()
 
+	// Rules which failed to be prepared will not be registered
+	errs := make([]error, 0)
 	for _, r := range rules {
 		rule := rule_manager.NewRule(r)
 		rule.TargetSchema = p.Schema
-		rm.AddRule(rule)
+		err := rm.AddRule(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule \"%s\": %w", r.Name, err))
+		}
 	}
 
-	// Replace old rule manager
-	p.Rules = rm
+	// Replace old rule manager, events in progress keep rules which were matched already
+	p.rules.Store(rm)
 
 	if p.watcher == nil {
-		return nil
+		return errors.Join(errs...)
 	}
 
+	subjects := p.watcher.Subjects()
+
 	// Purge events
 	p.watcher.PurgeEvent()
 
 	// Registering events
-	events := p.Rules.GetEvents()
+	events := rm.GetEvents()
 	for _, event := range events {
 		p.watcher.RegisterEvent(event)
 	}
 
-	return nil
+	// Consumer receives registered events only
+	if !slices.Equal(subjects, p.watcher.Subjects()) {
+		err := p.watcher.Refresh()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func (p *Product) PurgeTasks() error {
@@ -537,12 +989,15 @@ func (p *Product) PurgeTasks() error {
 
 	p.reset()
 
+	// Messages in buffer were dropped
+	metrics.BufferDepth.WithLabelValues(p.Name).Set(0)
+
 	return nil
 }
 
 func (p *Product) deactivate() error {
 
-	p.IsRunning = false
+	p.IsRunning.Store(false)
 
 	// Stop receiving events
 	err := p.StopEventWatcher()
@@ -550,6 +1005,53 @@ func (p *Product) deactivate() error {
 		return err
 	}
 
+	// Messages in progress will be dropped, so they have to be redelivered before new messages are acked
+	p.acks.NakAll()
+
+	return nil
+}
+
+// Drain stops receiving events and waits until events in progress were stored and their source messages
+// were acked.
+func (p *Product) Drain(ctx context.Context) error {
+
+	if !p.IsRunning.Load() {
+		return nil
+	}
+
+	logger.Info("Draining product",
+		zap.String("product", p.Name),
+		zap.Int("pending", p.acks.Pending()),
+	)
+
+	// Stop fetching but keep dispatching
+	err := p.StopEventWatcher()
+	if err != nil {
+		return err
+	}
+
+	if p.watcher != nil {
+		err = p.watcher.Wait(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(DefaultProductDrainInterval)
+	defer ticker.Stop()
+
+	for p.acks.Pending() > 0 {
+
+		// Dispatch immediately without waiting for buffer timeout
+		p.dispatcherBuffer.Flush()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
 	return nil
 }
 
@@ -564,18 +1066,27 @@ func (p *Product) Deactivate() error {
 
 func (p *Product) Activate() error {
 
-	// Product is disabled
-	if !p.Enabled {
+	// Product is disabled or dispatched by another replica
+	if !p.Enabled.Load() || p.standby.Load() {
 		return nil
 	}
 
-	p.IsRunning = true
+	// Subscribers have to know which partitioning was applied to new events
+	err := p.recordPartitioning()
+	if err != nil {
+		logger.Error("Failed to record partitioning",
+			zap.String("product", p.Name),
+			zap.Error(err),
+		)
+	}
+
+	p.IsRunning.Store(true)
 
 	logger.Info("Activating product",
 		zap.String("product", p.Name),
 	)
 
-	err := p.StartEventWatcher()
+	err = p.StartEventWatcher()
 	if err != nil {
 		return err
 	}
@@ -583,6 +1094,68 @@ func (p *Product) Activate() error {
 	return nil
 }
 
+func (p *Product) applySnapshot(enabled bool) error {
+
+	if !enabled || !p.Enabled.Load() || p.standby.Load() {
+
+		if p.snapshot == nil {
+			return nil
+		}
+
+		// Keep materialized records for the next time
+		return p.snapshot.Stop()
+	}
+
+	if p.manager == nil {
+		return nil
+	}
+
+	if p.snapshot == nil {
+
+		s := p.newSnapshot()
+		err := s.Init()
+		if err != nil {
+			return err
+		}
+
+		p.snapshot = s
+	}
+
+	return p.snapshot.Start()
+}
+
+func (p *Product) newSnapshot() *Snapshot {
+
+	connector := p.getConnector()
+
+	s := NewSnapshot(connector.GetClient(), connector.GetDomain(), p.Name, p.stream)
+
+	// Snapshot store is created by replica which holds lease of product if products are shared
+	if p.manager.dispatcher.coordinator == nil {
+		s.provision = p.manager.dispatcher.provision
+	}
+
+	return s
+}
+
+func (p *Product) deleteSnapshot() error {
+
+	if p.snapshot == nil {
+
+		// Snapshot might be created by previous process
+		return p.newSnapshot().Delete()
+	}
+
+	err := p.snapshot.Delete()
+	if err != nil {
+		return err
+	}
+
+	p.snapshot = nil
+
+	return nil
+}
+
 func (p *Product) StartEventWatcher() error {
 
 	if p.watcher == nil {
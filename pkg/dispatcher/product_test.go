@@ -1,16 +1,24 @@
 package dispatcher
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
-	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/rule_manager"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
 	record_type "github.com/BrobridgeOrg/gravity-sdk/v2/types/record"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
-func CreateTestProductSetting() *product_sdk.ProductSetting {
+func CreateTestProductSetting() *product_setting.ProductSetting {
 
 	// Product schema
 	productSchemaSource := `{
@@ -25,19 +33,18 @@ func CreateTestProductSetting() *product_sdk.ProductSetting {
 	json.Unmarshal([]byte(productSchemaSource), &productSchema)
 
 	// Preparing product setting
-	setting := &product_sdk.ProductSetting{
-		Name:        "TestProduct",
-		Description: "Product description",
-		Enabled:     false,
-		Schema:      productSchema,
-	}
+	setting := product_setting.NewProductSetting()
+	setting.Name = "TestProduct"
+	setting.Description = "Product description"
+	setting.Enabled = false
+	setting.Schema = productSchema
 
 	return setting
 }
 
-func CreateTestProductRule() *product_sdk.Rule {
+func CreateTestProductRule() *product_setting.Rule {
 
-	r := product_sdk.NewRule()
+	r := product_setting.NewRule()
 	r.Name = "test_rule"
 	r.Event = "dataCreated"
 	r.Product = "TestDataProduct"
@@ -71,10 +78,10 @@ func TestProductMessageHandler(t *testing.T) {
 	// Preparing processor
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			assert.Equal(t, "dataCreated", msg.ProductEvent.EventName)
-			assert.Equal(t, "TestDataProduct", msg.ProductEvent.Table)
+			assert.Equal(t, "dataCreated", msg.Outputs[0].ProductEvent.EventName)
+			assert.Equal(t, "TestDataProduct", msg.Outputs[0].ProductEvent.Table)
 
-			r, err := msg.ProductEvent.GetContent()
+			r, err := msg.Outputs[0].ProductEvent.GetContent()
 			assert.Equal(t, nil, err)
 
 			for _, field := range r.Payload.Map.Fields {
@@ -96,7 +103,7 @@ func TestProductMessageHandler(t *testing.T) {
 	// Preapring rule
 	r := CreateTestProductRule()
 
-	setting.Rules = map[string]*product_sdk.Rule{
+	setting.Rules = map[string]*product_setting.Rule{
 		"testRule": r,
 	}
 
@@ -128,10 +135,10 @@ func TestProductTransformerSrcipt(t *testing.T) {
 	// Preparing processor
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			assert.Equal(t, "dataCreated", msg.ProductEvent.EventName)
-			assert.Equal(t, "TestDataProduct", msg.ProductEvent.Table)
+			assert.Equal(t, "dataCreated", msg.Outputs[0].ProductEvent.EventName)
+			assert.Equal(t, "TestDataProduct", msg.Outputs[0].ProductEvent.Table)
 
-			r, err := msg.ProductEvent.GetContent()
+			r, err := msg.Outputs[0].ProductEvent.GetContent()
 			assert.Equal(t, nil, err)
 
 			for _, field := range r.Payload.Map.Fields {
@@ -152,7 +159,7 @@ func TestProductTransformerSrcipt(t *testing.T) {
 
 	// Preapring rule
 	r := CreateTestProductRule()
-	r.HandlerConfig = &product_sdk.HandlerConfig{
+	r.HandlerConfig = &product_setting.HandlerConfig{
 		Type: "script",
 		Script: `
 		return {
@@ -162,7 +169,7 @@ func TestProductTransformerSrcipt(t *testing.T) {
 		`,
 	}
 
-	setting.Rules = map[string]*product_sdk.Rule{
+	setting.Rules = map[string]*product_setting.Rule{
 		"testRule": r,
 	}
 
@@ -193,7 +200,7 @@ func TestProductMessageHandler_StressTest(t *testing.T) {
 	// Preparing processor
 	p := NewProcessor(
 		WithOutputHandler(func(msg *Message) {
-			r, err := msg.ProductEvent.GetContent()
+			r, err := msg.Outputs[0].ProductEvent.GetContent()
 			if !assert.Nil(t, err) {
 				return
 			}
@@ -209,7 +216,7 @@ func TestProductMessageHandler_StressTest(t *testing.T) {
 	// Preapring rule
 	r := CreateTestProductRule()
 
-	setting.Rules = map[string]*product_sdk.Rule{
+	setting.Rules = map[string]*product_setting.Rule{
 		"testRule": r,
 	}
 
@@ -265,3 +272,218 @@ func TestProductMessageHandler_StressTest(t *testing.T) {
 
 	assert.Equal(t, counter, targetNum)
 }
+
+func TestProductMultipleRules(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	testData := MessageRawData{
+		Event:      "dataCreated",
+		RawPayload: []byte(`{"id":101,"name":"fred"}`),
+	}
+
+	createRule := func(name string, priority int, suffix string) *product_setting.Rule {
+		r := CreateTestProductRule()
+		r.Name = name
+		r.Priority = priority
+		r.HandlerConfig = &product_setting.HandlerConfig{
+			Type: "script",
+			Script: `
+			return {
+				id: source.id,
+				name: source.name + '` + suffix + `'
+			}
+			`,
+		}
+
+		return r
+	}
+
+	run := func(setting *product_setting.ProductSetting) []string {
+
+		results := make(chan *Message)
+
+		product := NewProduct(nil)
+		product.onMessage = func(msg *Message) {
+			results <- msg
+		}
+		product.ApplySettings(setting)
+
+		raw, _ := json.Marshal(testData)
+		product.HandleRawMessage(testData.Event, raw)
+
+		msg := <-results
+
+		names := make([]string, 0)
+		for _, output := range msg.Outputs {
+			r, err := output.ProductEvent.GetContent()
+			if !assert.Nil(t, err) {
+				continue
+			}
+
+			name, _ := GetFieldValue(r, "name")
+			names = append(names, name.(string))
+		}
+
+		return names
+	}
+
+	// All rules will be applied by priority
+	setting := CreateTestProductSetting()
+	setting.Rules = map[string]*product_setting.Rule{
+		"low":  createRule("low", 1, "L"),
+		"high": createRule("high", 10, "H"),
+	}
+
+	assert.Equal(t, []string{"fredH", "fredL"}, run(setting))
+
+	// Rules with lower priority will be ignored
+	setting = CreateTestProductSetting()
+	setting.Rules = map[string]*product_setting.Rule{
+		"low":  createRule("low", 1, "L"),
+		"high": createRule("high", 10, "H"),
+	}
+	setting.Rules["high"].StopOnMatch = true
+
+	assert.Equal(t, []string{"fredH"}, run(setting))
+}
+
+func TestProductApplyInvalidRules(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	valid := CreateTestProductRule()
+	valid.Name = "valid"
+
+	invalid := CreateTestProductRule()
+	invalid.Name = "invalid"
+	invalid.Event = "dataUpdated"
+	invalid.HandlerConfig = &product_setting.HandlerConfig{
+		Type:   "script",
+		Script: `return {`,
+	}
+
+	product := NewProduct(nil)
+
+	err := product.ApplyRules([]*product_setting.Rule{valid, invalid})
+	assert.ErrorContains(t, err, "rule \"invalid\"")
+	assert.ErrorIs(t, err, rule_manager.ErrInvalidScript)
+
+	// Invalid rule is not registered
+	assert.Equal(t, []string{"dataCreated"}, product.GetRules().GetEvents())
+	assert.Len(t, product.GetRules().GetRules(), 1)
+}
+
+func TestProductLiveRuleUpdate(t *testing.T) {
+
+	d := CreateTestDispatcher(t)
+
+	createRule := func(suffix string) *product_setting.Rule {
+		r := CreateTestProductRule()
+		r.Name = "testRule"
+		r.Product = "live_rule_test"
+		r.HandlerConfig = &product_setting.HandlerConfig{
+			Type:   "script",
+			Script: `return { id: source.id, name: source.name + '` + suffix + `' }`,
+		}
+
+		return r
+	}
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = "live_rule_test"
+	setting.Enabled = true
+	setting.Rules["testRule"] = createRule("A")
+
+	defer metrics.DeleteProduct("live_rule_test")
+
+	applySetting := func() {
+		data, err := json.Marshal(setting)
+		require.Nil(t, err)
+
+		_, err = d.productConfigStore.Put(setting.Name, data)
+		require.Nil(t, err)
+	}
+
+	applySetting()
+
+	require.Eventually(t, func() bool {
+		code, report := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK && report.Products["live_rule_test"] != nil && report.Products["live_rule_test"].Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	js, err := d.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	publish := func(from int, to int) {
+		for i := from; i <= to; i++ {
+
+			raw, _ := json.Marshal(MessageRawData{
+				Event:      "dataCreated",
+				RawPayload: []byte(fmt.Sprintf(`{"id":%d,"name":"fred"}`, i)),
+			})
+
+			_, err := js.PublishAsync("$GVT.default.EVENT.dataCreated", raw)
+			require.Nil(t, err)
+		}
+
+		select {
+		case <-js.PublishAsyncComplete():
+		case <-time.After(5 * time.Second):
+			t.Fatal("events were not published")
+		}
+	}
+
+	p := d.productManager.GetProduct("live_rule_test")
+	processor := p.processor
+	rules := p.GetRules()
+
+	// Update rules while events are in progress
+	publish(1, 1000)
+
+	setting.Description = "Rules were updated"
+	setting.Rules["testRule"] = createRule("B")
+	applySetting()
+
+	require.Eventually(t, func() bool {
+		return p.GetRules() != rules
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Product was not restarted
+	assert.Same(t, processor, p.processor)
+	assert.True(t, p.IsRunning.Load())
+	assert.True(t, p.watcher.IsRunning())
+
+	publish(1001, 1001)
+
+	// Events in progress were not dropped
+	require.Eventually(t, func() bool {
+		stream, err := js.StreamInfo("GVT_default_DP_live_rule_test")
+		return err == nil && stream.State.Msgs == 1001
+	}, 10*time.Second, 10*time.Millisecond)
+
+	getName := func(seq uint64) string {
+
+		msg, err := js.GetMsg("GVT_default_DP_live_rule_test", seq)
+		require.Nil(t, err)
+
+		var pe gravity_sdk_types_product_event.ProductEvent
+		require.Nil(t, gravity_sdk_types_product_event.Unmarshal(msg.Data, &pe))
+
+		r, err := pe.GetContent()
+		require.Nil(t, err)
+
+		name, err := GetFieldValue(r, "name")
+		require.Nil(t, err)
+
+		return name.(string)
+	}
+
+	for seq := uint64(1); seq <= 1000; seq++ {
+		name := getName(seq)
+		assert.True(t, strings.HasSuffix(name, "A") || strings.HasSuffix(name, "B"), name)
+	}
+
+	// Events after update are handled by new rules
+	assert.Equal(t, "fredB", getName(1001))
+}
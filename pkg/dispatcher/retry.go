@@ -0,0 +1,264 @@
+package dispatcher
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dispatch_state"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultRetryMaxAttempts     = 10
+	DefaultRetryInitialInterval = 500 * time.Millisecond
+	DefaultRetryMaxInterval     = 30 * time.Second
+	DefaultRetryMultiplier      = 2.0
+	DefaultRetryJitter          = 0.2
+	DefaultRetryCooldown        = 30 * time.Second
+)
+
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+	Cooldown        time.Duration
+}
+
+// NewRetryPolicy creates a retry policy with settings of product, default values will be used for missing options.
+func NewRetryPolicy(setting *product_setting.RetryPolicy) *RetryPolicy {
+
+	viper.SetDefault("product.retry.max_attempts", DefaultRetryMaxAttempts)
+	viper.SetDefault("product.retry.initial_interval", DefaultRetryInitialInterval)
+	viper.SetDefault("product.retry.max_interval", DefaultRetryMaxInterval)
+	viper.SetDefault("product.retry.multiplier", DefaultRetryMultiplier)
+	viper.SetDefault("product.retry.jitter", DefaultRetryJitter)
+	viper.SetDefault("product.retry.cooldown", DefaultRetryCooldown)
+
+	rp := &RetryPolicy{
+		MaxAttempts:     viper.GetInt("product.retry.max_attempts"),
+		InitialInterval: viper.GetDuration("product.retry.initial_interval"),
+		MaxInterval:     viper.GetDuration("product.retry.max_interval"),
+		Multiplier:      viper.GetFloat64("product.retry.multiplier"),
+		Jitter:          viper.GetFloat64("product.retry.jitter"),
+		Cooldown:        viper.GetDuration("product.retry.cooldown"),
+	}
+
+	if setting == nil {
+		return rp
+	}
+
+	if setting.MaxAttempts > 0 {
+		rp.MaxAttempts = setting.MaxAttempts
+	}
+
+	rp.InitialInterval = parseRetryDuration("initialInterval", setting.InitialInterval, rp.InitialInterval)
+	rp.MaxInterval = parseRetryDuration("maxInterval", setting.MaxInterval, rp.MaxInterval)
+	rp.Cooldown = parseRetryDuration("cooldown", setting.Cooldown, rp.Cooldown)
+
+	if setting.Multiplier >= 1 {
+		rp.Multiplier = setting.Multiplier
+	}
+
+	if setting.Jitter > 0 && setting.Jitter <= 1 {
+		rp.Jitter = setting.Jitter
+	}
+
+	return rp
+}
+
+func parseRetryDuration(name string, value string, defaultValue time.Duration) time.Duration {
+
+	if len(value) == 0 {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		logger.Warn("Invalid option of retry policy, use default value instead",
+			zap.String("option", name),
+			zap.String("value", value),
+			zap.Duration("default", defaultValue),
+		)
+
+		return defaultValue
+	}
+
+	return d
+}
+
+// Backoff returns delay before specific attempt. Attempt starts from 1.
+func (rp *RetryPolicy) Backoff(attempt int) time.Duration {
+
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	d := float64(rp.InitialInterval) * math.Pow(rp.Multiplier, float64(attempt-1))
+	if d > float64(rp.MaxInterval) || math.IsInf(d, 0) {
+		d = float64(rp.MaxInterval)
+	}
+
+	// Randomize delay to avoid all products retrying at the same time
+	if rp.Jitter > 0 {
+		d -= d * rp.Jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// CircuitBreaker tracks failures of publishing. It's opened after max attempts of retry policy, and
+// the next attempt after cooldown is a probe which closes breaker if it works.
+// onChange is called in order in background only when breaker is switched to another state.
+type CircuitBreaker struct {
+	policy   *RetryPolicy
+	mutex    sync.RWMutex
+	state    dispatch_state.State
+	onChange func(*dispatch_state.State)
+
+	notifyMutex sync.Mutex
+	pending     []*dispatch_state.State
+	notifying   bool
+}
+
+func NewCircuitBreaker(policy *RetryPolicy, onChange func(*dispatch_state.State)) *CircuitBreaker {
+	return &CircuitBreaker{
+		policy: policy,
+		state: dispatch_state.State{
+			Breaker:   dispatch_state.BreakerClosed,
+			UpdatedAt: time.Now(),
+		},
+		onChange: onChange,
+	}
+}
+
+func (cb *CircuitBreaker) SetPolicy(policy *RetryPolicy) {
+	cb.mutex.Lock()
+	cb.policy = policy
+	cb.mutex.Unlock()
+}
+
+func (cb *CircuitBreaker) State() *dispatch_state.State {
+
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	s := cb.state
+
+	return &s
+}
+
+// Success closes breaker and resets failures.
+func (cb *CircuitBreaker) Success() {
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state.Breaker == dispatch_state.BreakerClosed && cb.state.Failures == 0 {
+		return
+	}
+
+	changed := cb.state.Breaker != dispatch_state.BreakerClosed
+
+	cb.state = dispatch_state.State{
+		Breaker:   dispatch_state.BreakerClosed,
+		UpdatedAt: time.Now(),
+	}
+
+	if changed {
+		cb.notify()
+	}
+}
+
+// Failure records a failure and returns delay before the next attempt.
+func (cb *CircuitBreaker) Failure(err error) time.Duration {
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := time.Now()
+	prev := cb.state.Breaker
+
+	cb.state.Failures++
+	cb.state.LastError = err.Error()
+	cb.state.UpdatedAt = now
+
+	delay := cb.policy.Backoff(cb.state.Failures)
+
+	// Probe was failed or too many attempts
+	if cb.state.Breaker == dispatch_state.BreakerHalfOpen ||
+		(cb.policy.MaxAttempts > 0 && cb.state.Failures >= cb.policy.MaxAttempts) {
+		cb.state.Breaker = dispatch_state.BreakerOpen
+		cb.state.OpenedAt = now
+		delay = cb.policy.Cooldown
+	}
+
+	if cb.state.Breaker != prev {
+		cb.notify()
+	}
+
+	return delay
+}
+
+// Probe turns open breaker into half-open state before the next attempt.
+func (cb *CircuitBreaker) Probe() {
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state.Breaker != dispatch_state.BreakerOpen {
+		return
+	}
+
+	cb.state.Breaker = dispatch_state.BreakerHalfOpen
+	cb.state.UpdatedAt = time.Now()
+
+	cb.notify()
+}
+
+// notify queues current state for onChange. It must be called with lock held to keep order of changes.
+func (cb *CircuitBreaker) notify() {
+
+	if cb.onChange == nil {
+		return
+	}
+
+	s := cb.state
+
+	cb.notifyMutex.Lock()
+	defer cb.notifyMutex.Unlock()
+
+	cb.pending = append(cb.pending, &s)
+
+	if cb.notifying {
+		return
+	}
+
+	// Publishing state might be slow, so it shouldn't block dispatching
+	cb.notifying = true
+	go cb.flush()
+}
+
+func (cb *CircuitBreaker) flush() {
+
+	for {
+		cb.notifyMutex.Lock()
+
+		if len(cb.pending) == 0 {
+			cb.notifying = false
+			cb.notifyMutex.Unlock()
+			return
+		}
+
+		s := cb.pending[0]
+		cb.pending = cb.pending[1:]
+		cb.notifyMutex.Unlock()
+
+		cb.onChange(s)
+	}
+}
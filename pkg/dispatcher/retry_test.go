@@ -0,0 +1,205 @@
+package dispatcher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dispatch_state"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	rp := NewRetryPolicy(&product_setting.RetryPolicy{
+		InitialInterval: "100ms",
+		MaxInterval:     "1s",
+		Multiplier:      2,
+		Jitter:          0.5,
+		Cooldown:        "invalid",
+	})
+
+	assert.Equal(t, DefaultRetryCooldown, rp.Cooldown)
+
+	for i := 0; i < 100; i++ {
+		d := rp.Backoff(1)
+		assert.True(t, d > 50*time.Millisecond && d <= 100*time.Millisecond, d)
+
+		d = rp.Backoff(3)
+		assert.True(t, d > 200*time.Millisecond && d <= 400*time.Millisecond, d)
+
+		// Capped by max interval
+		d = rp.Backoff(100)
+		assert.True(t, d > 500*time.Millisecond && d <= time.Second, d)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	rp := NewRetryPolicy(&product_setting.RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: "10ms",
+		Cooldown:        "1m",
+	})
+
+	changes := make(chan string, 10)
+	cb := NewCircuitBreaker(rp, func(s *dispatch_state.State) {
+		changes <- s.Breaker
+	})
+
+	err := errors.New("failure")
+
+	assert.True(t, cb.Failure(err) < time.Minute)
+	assert.True(t, cb.Failure(err) < time.Minute)
+
+	// Too many attempts
+	assert.Equal(t, time.Minute, cb.Failure(err))
+	assert.Equal(t, dispatch_state.BreakerOpen, cb.State().Breaker)
+	assert.Equal(t, 3, cb.State().Failures)
+	assert.Equal(t, "failure", cb.State().LastError)
+
+	// Probe was failed
+	cb.Probe()
+	assert.Equal(t, dispatch_state.BreakerHalfOpen, cb.State().Breaker)
+	assert.Equal(t, time.Minute, cb.Failure(err))
+	assert.Equal(t, dispatch_state.BreakerOpen, cb.State().Breaker)
+
+	// Probe works
+	cb.Probe()
+	cb.Success()
+	assert.Equal(t, dispatch_state.BreakerClosed, cb.State().Breaker)
+	assert.Equal(t, 0, cb.State().Failures)
+
+	// Only changes of breaker state are notified
+	for _, expected := range []string{
+		dispatch_state.BreakerOpen,
+		dispatch_state.BreakerHalfOpen,
+		dispatch_state.BreakerOpen,
+		dispatch_state.BreakerHalfOpen,
+		dispatch_state.BreakerClosed,
+	} {
+		select {
+		case s := <-changes:
+			assert.Equal(t, expected, s)
+		case <-time.After(time.Second):
+			require.Fail(t, "no state change was notified", expected)
+		}
+	}
+
+	// Failures without opening breaker are not notified
+	assert.True(t, cb.Failure(err) < time.Minute)
+	cb.Success()
+
+	select {
+	case s := <-changes:
+		assert.Fail(t, "unexpected state change", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCircuitBreakerAsyncNotify(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	rp := NewRetryPolicy(&product_setting.RetryPolicy{
+		MaxAttempts: 1,
+		Cooldown:    "1m",
+	})
+
+	release := make(chan struct{})
+	cb := NewCircuitBreaker(rp, func(s *dispatch_state.State) {
+		<-release
+	})
+
+	// Slow notification doesn't block breaker
+	done := make(chan struct{})
+	go func() {
+		cb.Failure(errors.New("failure"))
+		cb.Probe()
+		cb.Success()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail(t, "breaker was blocked by notification")
+	}
+
+	close(release)
+}
+
+func TestProductRepublishAfterAckFailure(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	client := CreateTestClient(t)
+	js, err := client.GetJetStream()
+	require.Nil(t, err)
+
+	p := NewProduct(nil)
+	p.Name = "retry_test"
+	p.Enabled.Store(true)
+	p.IsRunning.Store(true)
+	p.breaker.SetPolicy(NewRetryPolicy(&product_setting.RetryPolicy{
+		InitialInterval: "10ms",
+		MaxInterval:     "10ms",
+	}))
+
+	subject := "$GVT.default.DP.retry_test.0.EVENT.dataCreated"
+
+	chunk := make([]interface{}, 0)
+	for _, id := range []string{"1", "2", "3"} {
+
+		output := &MessageOutput{
+			ID:  id,
+			Msg: nats.NewMsg(subject),
+		}
+		output.Msg.Data = []byte(id)
+
+		m := NewMessage()
+		m.Publisher = js
+		m.Product = p
+		m.Msg = nats.NewMsg("source")
+		m.Outputs = append(m.Outputs, output)
+
+		chunk = append(chunk, m)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.dispatcherBufferHandler(chunk)
+		close(done)
+	}()
+
+	// Product stream is not ready, so publishing acks are failed
+	require.Eventually(t, func() bool {
+		return p.breaker.State().Failures > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:       "GVT_default_DP_retry_test",
+		Subjects:   []string{"$GVT.default.DP.retry_test.>"},
+		Duplicates: time.Minute,
+	})
+	require.Nil(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages were not dispatched")
+	}
+
+	info, err := js.StreamInfo("GVT_default_DP_retry_test")
+	require.Nil(t, err)
+	assert.Equal(t, uint64(3), info.State.Msgs)
+	assert.Equal(t, dispatch_state.BreakerClosed, p.breaker.State().Breaker)
+}
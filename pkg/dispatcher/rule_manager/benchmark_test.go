@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"testing"
 
-	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
 	"github.com/BrobridgeOrg/schemer"
 )
 
-func BenchmarkHandler(b *testing.B) {
+func createBenchmarkSchema() *schemer.Schema {
 
 	// Product schema
 	schemaSource := `{
@@ -25,9 +25,12 @@ func BenchmarkHandler(b *testing.B) {
 	schema := schemer.NewSchema()
 	schemer.Unmarshal(schemaMap, schema)
 
-	config := &product_sdk.HandlerConfig{}
-	config.Type = "script"
-	config.Script = `return source`
+	return schema
+}
+
+func runBenchmarkHandler(b *testing.B, config *product_setting.HandlerConfig) {
+
+	schema := createBenchmarkSchema()
 
 	h := NewHandler(config, schema, schema)
 
@@ -40,3 +43,52 @@ func BenchmarkHandler(b *testing.B) {
 		h.Run(nil, data)
 	}
 }
+
+func BenchmarkHandler(b *testing.B) {
+
+	config := &product_setting.HandlerConfig{}
+	config.Type = "script"
+	config.Script = `return source`
+
+	runBenchmarkHandler(b, config)
+}
+
+func BenchmarkHandler_Script(b *testing.B) {
+
+	config := &product_setting.HandlerConfig{}
+	config.Type = "script"
+	config.Script = `return { id: source.id, name: source.type, type: source.type, phone: source.phone }`
+
+	runBenchmarkHandler(b, config)
+}
+
+func BenchmarkHandler_Mapping(b *testing.B) {
+
+	config := &product_setting.HandlerConfig{}
+	config.Type = "mapping"
+	config.Mapping = []*product_setting.FieldMapping{
+		{Action: "copy", Source: "type", Target: "name"},
+		{Action: "drop", Source: "address"},
+	}
+
+	runBenchmarkHandler(b, config)
+}
+
+func BenchmarkHandler_Constant(b *testing.B) {
+
+	config := &product_setting.HandlerConfig{}
+	config.Type = "constant"
+	config.Constants = map[string]interface{}{
+		"type": "member",
+	}
+
+	runBenchmarkHandler(b, config)
+}
+
+func BenchmarkHandler_Cast(b *testing.B) {
+
+	config := &product_setting.HandlerConfig{}
+	config.Type = "cast"
+
+	runBenchmarkHandler(b, config)
+}
@@ -0,0 +1,277 @@
+package rule_manager
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+)
+
+type FilterOperator int32
+
+const (
+	FILTER_EQ FilterOperator = iota
+	FILTER_NE
+	FILTER_GT
+	FILTER_GTE
+	FILTER_LT
+	FILTER_LTE
+	FILTER_IN
+	FILTER_NIN
+	FILTER_EXISTS
+	FILTER_NOT_EXISTS
+)
+
+var FilterOperators = map[string]FilterOperator{
+	"eq":        FILTER_EQ,
+	"ne":        FILTER_NE,
+	"gt":        FILTER_GT,
+	"gte":       FILTER_GTE,
+	"lt":        FILTER_LT,
+	"lte":       FILTER_LTE,
+	"in":        FILTER_IN,
+	"nin":       FILTER_NIN,
+	"exists":    FILTER_EXISTS,
+	"notExists": FILTER_NOT_EXISTS,
+}
+
+var (
+	ErrInvalidFilterMatch    = errors.New("invalid filter match mode")
+	ErrInvalidFilterOperator = errors.New("invalid filter operator")
+	ErrInvalidFilterField    = errors.New("filter field is required")
+	ErrInvalidFilterValue    = errors.New("invalid filter value")
+)
+
+type Filter struct {
+	Any        bool
+	Conditions []*Condition
+}
+
+type Condition struct {
+	Path     []string
+	Operator FilterOperator
+	Value    interface{}
+	Values   []interface{}
+}
+
+func NewFilter(config *product_setting.Filter) (*Filter, error) {
+
+	f := &Filter{
+		Conditions: make([]*Condition, 0, len(config.Conditions)),
+	}
+
+	switch config.Match {
+	case "", "all":
+	case "any":
+		f.Any = true
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFilterMatch, config.Match)
+	}
+
+	for _, cc := range config.Conditions {
+
+		c, err := NewCondition(cc)
+		if err != nil {
+			return nil, err
+		}
+
+		f.Conditions = append(f.Conditions, c)
+	}
+
+	return f, nil
+}
+
+func NewCondition(config *product_setting.Condition) (*Condition, error) {
+
+	if len(config.Field) == 0 {
+		return nil, ErrInvalidFilterField
+	}
+
+	op, ok := FilterOperators[config.Operator]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFilterOperator, config.Operator)
+	}
+
+	c := &Condition{
+		Path:     strings.Split(config.Field, "."),
+		Operator: op,
+		Value:    config.Value,
+	}
+
+	// Value of "in" and "nin" must be a list
+	if op == FILTER_IN || op == FILTER_NIN {
+		values, ok := config.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: %s requires a list", ErrInvalidFilterValue, config.Operator)
+		}
+
+		c.Values = values
+	}
+
+	return c, nil
+}
+
+// Match returns true if payload satisfies conditions of filter. Filter without conditions matches everything.
+func (f *Filter) Match(data map[string]interface{}) bool {
+
+	if len(f.Conditions) == 0 {
+		return true
+	}
+
+	for _, c := range f.Conditions {
+
+		matched := c.Match(data)
+
+		if f.Any && matched {
+			return true
+		}
+
+		if !f.Any && !matched {
+			return false
+		}
+	}
+
+	return !f.Any
+}
+
+func (c *Condition) Match(data map[string]interface{}) bool {
+
+	v, exists := lookupField(data, c.Path)
+
+	switch c.Operator {
+	case FILTER_EXISTS:
+		return exists
+	case FILTER_NOT_EXISTS:
+		return !exists
+	}
+
+	if !exists {
+		return c.Operator == FILTER_NE || c.Operator == FILTER_NIN
+	}
+
+	switch c.Operator {
+	case FILTER_EQ:
+		return equalValues(v, c.Value)
+	case FILTER_NE:
+		return !equalValues(v, c.Value)
+	case FILTER_IN:
+		return containsValue(c.Values, v)
+	case FILTER_NIN:
+		return !containsValue(c.Values, v)
+	}
+
+	result, ok := compareValues(v, c.Value)
+	if !ok {
+		return false
+	}
+
+	switch c.Operator {
+	case FILTER_GT:
+		return result > 0
+	case FILTER_GTE:
+		return result >= 0
+	case FILTER_LT:
+		return result < 0
+	case FILTER_LTE:
+		return result <= 0
+	}
+
+	return false
+}
+
+func lookupField(data map[string]interface{}, path []string) (interface{}, bool) {
+
+	var cur interface{} = data
+	for _, key := range path {
+
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		cur, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+
+	return 0, false
+}
+
+func equalValues(a interface{}, b interface{}) bool {
+
+	// Numbers are compared by value regardless of types
+	if _, ok := toFloat(a); ok {
+		result, ok := compareValues(a, b)
+		return ok && result == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func compareValues(a interface{}, b interface{}) (int, bool) {
+
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+
+		return 0, true
+	}
+
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+
+		return strings.Compare(x, y), true
+	}
+
+	return 0, false
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+
+	for _, value := range values {
+		if equalValues(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,188 @@
+package rule_manager
+
+import (
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionMatch(t *testing.T) {
+
+	data := map[string]interface{}{
+		"id":     int64(101),
+		"score":  float64(3.5),
+		"name":   "fred",
+		"active": true,
+		"user": map[string]interface{}{
+			"region": "tw",
+		},
+	}
+
+	cases := []struct {
+		name     string
+		field    string
+		operator string
+		value    interface{}
+		expected bool
+	}{
+		// eq
+		{"eq int", "id", "eq", int64(101), true},
+		{"eq int and float", "id", "eq", float64(101), true},
+		{"eq string", "name", "eq", "fred", true},
+		{"eq different string", "name", "eq", "armani", false},
+		{"eq bool", "active", "eq", true, true},
+		{"eq nested", "user.region", "eq", "tw", true},
+		{"eq number and string", "id", "eq", "101", false},
+		{"eq string and number", "name", "eq", 101, false},
+		{"eq missing", "missing", "eq", "fred", false},
+
+		// ne
+		{"ne equal", "id", "ne", 101, false},
+		{"ne different", "id", "ne", 102, true},
+		{"ne number and string", "id", "ne", "101", true},
+		{"ne missing", "missing", "ne", "fred", true},
+
+		// gt
+		{"gt greater", "id", "gt", 100, true},
+		{"gt equal", "id", "gt", 101, false},
+		{"gt float", "score", "gt", 3, true},
+		{"gt string", "name", "gt", "armani", true},
+		{"gt number and string", "id", "gt", "100", false},
+		{"gt bool", "active", "gt", false, false},
+		{"gt missing", "missing", "gt", 0, false},
+
+		// gte
+		{"gte equal", "id", "gte", 101, true},
+		{"gte less", "score", "gte", 3.6, false},
+		{"gte string", "name", "gte", "fred", true},
+		{"gte mismatched type", "name", "gte", 1, false},
+
+		// lt
+		{"lt less", "id", "lt", 102, true},
+		{"lt equal", "id", "lt", 101, false},
+		{"lt string", "name", "lt", "george", true},
+		{"lt mismatched type", "score", "lt", "4", false},
+
+		// lte
+		{"lte equal", "score", "lte", float32(3.5), true},
+		{"lte greater", "id", "lte", uint64(100), false},
+		{"lte mismatched type", "id", "lte", nil, false},
+
+		// in
+		{"in list", "id", "in", []interface{}{float64(100), float64(101)}, true},
+		{"in list of strings", "name", "in", []interface{}{"fred", "armani"}, true},
+		{"in not listed", "name", "in", []interface{}{"armani"}, false},
+		{"in mismatched type", "id", "in", []interface{}{"101"}, false},
+		{"in missing", "missing", "in", []interface{}{"fred"}, false},
+
+		// nin
+		{"nin list", "id", "nin", []interface{}{float64(101)}, false},
+		{"nin not listed", "name", "nin", []interface{}{"armani"}, true},
+		{"nin mismatched type", "id", "nin", []interface{}{"101"}, true},
+		{"nin missing", "missing", "nin", []interface{}{"fred"}, true},
+
+		// exists
+		{"exists", "name", "exists", nil, true},
+		{"exists nested", "user.region", "exists", nil, true},
+		{"exists missing", "missing", "exists", nil, false},
+		{"exists under non-object", "name.first", "exists", nil, false},
+
+		// notExists
+		{"notExists", "name", "notExists", nil, false},
+		{"notExists missing", "user.city", "notExists", nil, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			condition, err := NewCondition(&product_setting.Condition{
+				Field:    c.field,
+				Operator: c.operator,
+				Value:    c.value,
+			})
+			require.Nil(t, err)
+
+			assert.Equal(t, c.expected, condition.Match(data))
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+
+	data := map[string]interface{}{
+		"id":   float64(101),
+		"name": "fred",
+	}
+
+	conditions := []*product_setting.Condition{
+		{Field: "id", Operator: "gt", Value: float64(100)},
+		{Field: "name", Operator: "eq", Value: "armani"},
+	}
+
+	// All conditions must be satisfied by default
+	f, err := NewFilter(&product_setting.Filter{Conditions: conditions})
+	require.Nil(t, err)
+	assert.False(t, f.Match(data))
+
+	f, err = NewFilter(&product_setting.Filter{Match: "all", Conditions: conditions[:1]})
+	require.Nil(t, err)
+	assert.True(t, f.Match(data))
+
+	// Any of conditions
+	f, err = NewFilter(&product_setting.Filter{Match: "any", Conditions: conditions})
+	require.Nil(t, err)
+	assert.True(t, f.Match(data))
+
+	f, err = NewFilter(&product_setting.Filter{Match: "any", Conditions: conditions[1:]})
+	require.Nil(t, err)
+	assert.False(t, f.Match(data))
+
+	// Filter without conditions matches everything
+	f, err = NewFilter(&product_setting.Filter{Match: "any"})
+	require.Nil(t, err)
+	assert.True(t, f.Match(data))
+}
+
+func TestFilterConfigErrors(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		config   *product_setting.Filter
+		expected error
+	}{
+		{
+			"invalid match",
+			&product_setting.Filter{Match: "none"},
+			ErrInvalidFilterMatch,
+		},
+		{
+			"invalid operator",
+			&product_setting.Filter{Conditions: []*product_setting.Condition{{Field: "id", Operator: "like"}}},
+			ErrInvalidFilterOperator,
+		},
+		{
+			"missing field",
+			&product_setting.Filter{Conditions: []*product_setting.Condition{{Operator: "eq", Value: 1}}},
+			ErrInvalidFilterField,
+		},
+		{
+			"in without list",
+			&product_setting.Filter{Conditions: []*product_setting.Condition{{Field: "id", Operator: "in", Value: 1}}},
+			ErrInvalidFilterValue,
+		},
+		{
+			"nin without list",
+			&product_setting.Filter{Conditions: []*product_setting.Condition{{Field: "id", Operator: "nin", Value: "fred"}}},
+			ErrInvalidFilterValue,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewFilter(c.config)
+			assert.ErrorIs(t, err, c.expected)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package rule_manager
 
 import (
-	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"errors"
+	"fmt"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
 	"github.com/BrobridgeOrg/schemer"
 	goja_runtime "github.com/BrobridgeOrg/schemer/runtime/goja"
 )
@@ -10,22 +13,80 @@ type HandlerType int32
 
 const (
 	HANDLER_SCRIPT HandlerType = iota
+	HANDLER_MAPPING
+	HANDLER_CONSTANT
+	HANDLER_CAST
 )
 
 var HandlerTypes = map[string]HandlerType{
-	"script": HANDLER_SCRIPT,
+	"script":   HANDLER_SCRIPT,
+	"mapping":  HANDLER_MAPPING,
+	"constant": HANDLER_CONSTANT,
+	"cast":     HANDLER_CAST,
+}
+
+type MappingAction int32
+
+const (
+	MAPPING_RENAME MappingAction = iota
+	MAPPING_COPY
+	MAPPING_DROP
+)
+
+var MappingActions = map[string]MappingAction{
+	"":       MAPPING_RENAME,
+	"rename": MAPPING_RENAME,
+	"copy":   MAPPING_COPY,
+	"drop":   MAPPING_DROP,
+}
+
+var (
+	ErrInvalidHandlerType   = errors.New("invalid handler type")
+	ErrInvalidHandlerConfig = errors.New("invalid handler config")
+	ErrInvalidFieldMapping  = errors.New("invalid field mapping")
+	ErrInvalidScript        = errors.New("invalid script")
+)
+
+type FieldMapping struct {
+	Action MappingAction
+	Source string
+	Target string
 }
 
 type Handler struct {
-	Type        HandlerType
-	Script      string
-	Transformer *schemer.Transformer
+	Type         HandlerType
+	Script       string
+	Transformer  *schemer.Transformer
+	Mapping      []*FieldMapping
+	Constants    map[string]interface{}
+	sourceSchema *schemer.Schema
+	targetSchema *schemer.Schema
 }
 
-func NewHandler(config *product_sdk.HandlerConfig, sourceSchema *schemer.Schema, targetSchema *schemer.Schema) *Handler {
+func NewHandler(config *product_setting.HandlerConfig, sourceSchema *schemer.Schema, targetSchema *schemer.Schema) *Handler {
 
 	handler := &Handler{
-		Type: HandlerTypes["script"],
+		Type:         HandlerTypes["script"],
+		sourceSchema: sourceSchema,
+		targetSchema: targetSchema,
+	}
+
+	if config != nil {
+		if t, ok := HandlerTypes[config.Type]; ok {
+			handler.Type = t
+		}
+	}
+
+	// Native handlers are executed without script runtime
+	switch handler.Type {
+	case HANDLER_MAPPING:
+		handler.Mapping = parseFieldMapping(config.Mapping)
+		return handler
+	case HANDLER_CONSTANT:
+		handler.Constants = config.Constants
+		return handler
+	case HANDLER_CAST:
+		return handler
 	}
 
 	handler.Transformer = schemer.NewTransformer(
@@ -35,10 +96,6 @@ func NewHandler(config *product_sdk.HandlerConfig, sourceSchema *schemer.Schema,
 	)
 
 	if config != nil {
-		if t, ok := HandlerTypes[config.Type]; ok {
-			handler.Type = t
-		}
-
 		handler.Script = config.Script
 		handler.Transformer.SetScript(config.Script)
 	}
@@ -46,10 +103,180 @@ func NewHandler(config *product_sdk.HandlerConfig, sourceSchema *schemer.Schema,
 	return handler
 }
 
+// CheckHandlerConfig returns error if handler type, field mapping or script is invalid, or there are options
+// which are not supported by the type of handler.
+func CheckHandlerConfig(config *product_setting.HandlerConfig) error {
+
+	// Handler without type was a script handler before native handlers were supported
+	handlerType := config.Type
+	if len(handlerType) == 0 {
+		handlerType = "script"
+	}
+
+	t, ok := HandlerTypes[handlerType]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidHandlerType, config.Type)
+	}
+
+	if t != HANDLER_SCRIPT && len(config.Script) > 0 {
+		return fmt.Errorf("%w: script is not supported by %s handler", ErrInvalidHandlerConfig, handlerType)
+	}
+
+	if t != HANDLER_MAPPING && len(config.Mapping) > 0 {
+		return fmt.Errorf("%w: mapping is not supported by %s handler", ErrInvalidHandlerConfig, handlerType)
+	}
+
+	if t != HANDLER_CONSTANT && len(config.Constants) > 0 {
+		return fmt.Errorf("%w: constants are not supported by %s handler", ErrInvalidHandlerConfig, handlerType)
+	}
+
+	if t == HANDLER_SCRIPT {
+		return CheckScript(config.Script)
+	}
+
+	if t != HANDLER_MAPPING {
+		return nil
+	}
+
+	for _, m := range config.Mapping {
+
+		action, ok := MappingActions[m.Action]
+		if !ok {
+			return fmt.Errorf("%w: unknown action %s", ErrInvalidFieldMapping, m.Action)
+		}
+
+		if len(m.Source) == 0 {
+			return fmt.Errorf("%w: source is required", ErrInvalidFieldMapping)
+		}
+
+		if action != MAPPING_DROP && len(m.Target) == 0 {
+			return fmt.Errorf("%w: target is required for %s", ErrInvalidFieldMapping, m.Source)
+		}
+	}
+
+	return nil
+}
+
+// CheckScript compiles script to find syntax errors before events are handled.
+func CheckScript(script string) error {
+
+	transformer := schemer.NewTransformer(nil, nil, schemer.WithRuntime(goja_runtime.NewRuntime()))
+
+	err := transformer.SetScript(script)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidScript, err)
+	}
+
+	return nil
+}
+
+func parseFieldMapping(configs []*product_setting.FieldMapping) []*FieldMapping {
+
+	mapping := make([]*FieldMapping, 0, len(configs))
+	for _, c := range configs {
+		mapping = append(mapping, &FieldMapping{
+			Action: MappingActions[c.Action],
+			Source: c.Source,
+			Target: c.Target,
+		})
+	}
+
+	return mapping
+}
+
 func (e *Handler) Run(env map[string]interface{}, data map[string]interface{}) ([]map[string]interface{}, error) {
-	return e.Transformer.Transform(env, data)
+
+	if e.Transformer != nil {
+		return e.Transformer.Transform(env, data)
+	}
+
+	return e.runNative(data)
+}
+
+func (e *Handler) runNative(input map[string]interface{}) ([]map[string]interface{}, error) {
+
+	dest := e.GetDestinationSchema()
+
+	var data map[string]interface{}
+	switch e.Type {
+	case HANDLER_MAPPING:
+		data = e.applyMapping(input)
+	case HANDLER_CONSTANT:
+		data = e.applyConstants(input)
+	default:
+
+		// Normalization creates a new object already
+		if dest != nil {
+			return []map[string]interface{}{dest.Normalize(input)}, nil
+		}
+
+		data = copyData(input, 0)
+	}
+
+	// Type coercion based on schema
+	if dest != nil {
+		data = dest.Normalize(data)
+	}
+
+	return []map[string]interface{}{data}, nil
+}
+
+// copyData returns a shallow copy because input data might be shared by multiple rules
+func copyData(input map[string]interface{}, extra int) map[string]interface{} {
+
+	data := make(map[string]interface{}, len(input)+extra)
+	for k, v := range input {
+		data[k] = v
+	}
+
+	return data
+}
+
+func (e *Handler) applyMapping(input map[string]interface{}) map[string]interface{} {
+
+	data := copyData(input, 0)
+
+	for _, m := range e.Mapping {
+
+		v, ok := data[m.Source]
+		if !ok {
+			continue
+		}
+
+		switch m.Action {
+		case MAPPING_RENAME:
+			delete(data, m.Source)
+			data[m.Target] = v
+		case MAPPING_COPY:
+			data[m.Target] = v
+		case MAPPING_DROP:
+			delete(data, m.Source)
+		}
+	}
+
+	return data
+}
+
+func (e *Handler) applyConstants(input map[string]interface{}) map[string]interface{} {
+
+	data := copyData(input, len(e.Constants))
+
+	for k, v := range e.Constants {
+		data[k] = v
+	}
+
+	return data
 }
 
 func (e *Handler) GetDestinationSchema() *schemer.Schema {
-	return e.Transformer.GetDestinationSchema()
+
+	if e.Transformer != nil {
+		return e.Transformer.GetDestinationSchema()
+	}
+
+	if e.targetSchema != nil {
+		return e.targetSchema
+	}
+
+	return e.sourceSchema
 }
@@ -0,0 +1,293 @@
+package rule_manager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/BrobridgeOrg/schemer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestSchema(t *testing.T, source string) *schemer.Schema {
+
+	var schemaMap map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(source), &schemaMap))
+
+	schema := schemer.NewSchema()
+	require.Nil(t, schemer.Unmarshal(schemaMap, schema))
+
+	return schema
+}
+
+func runTestHandler(t *testing.T, handler *Handler, data map[string]interface{}) map[string]interface{} {
+
+	results, err := handler.Run(nil, data)
+	require.Nil(t, err)
+	require.Len(t, results, 1)
+
+	return results[0]
+}
+
+func TestMappingHandler(t *testing.T) {
+
+	handler := NewHandler(&product_setting.HandlerConfig{
+		Type: "mapping",
+		Mapping: []*product_setting.FieldMapping{
+			{Source: "uid", Target: "id"},
+			{Action: "copy", Source: "name", Target: "displayName"},
+			{Action: "drop", Source: "password"},
+			{Source: "missing", Target: "other"},
+		},
+	}, nil, nil)
+
+	assert.Equal(t, HANDLER_MAPPING, handler.Type)
+	assert.Nil(t, handler.Transformer)
+
+	input := map[string]interface{}{
+		"uid":      101,
+		"name":     "fred",
+		"password": "secret",
+	}
+
+	result := runTestHandler(t, handler, input)
+	assert.Equal(t, map[string]interface{}{
+		"id":          101,
+		"name":        "fred",
+		"displayName": "fred",
+	}, result)
+
+	// Input might be shared by other rules
+	assert.Len(t, input, 3)
+	assert.Equal(t, 101, input["uid"])
+	assert.Equal(t, "secret", input["password"])
+
+	// Operations are applied in order
+	handler = NewHandler(&product_setting.HandlerConfig{
+		Type: "mapping",
+		Mapping: []*product_setting.FieldMapping{
+			{Source: "a", Target: "b"},
+			{Source: "b", Target: "c"},
+		},
+	}, nil, nil)
+
+	result = runTestHandler(t, handler, map[string]interface{}{"a": 1})
+	assert.Equal(t, map[string]interface{}{"c": 1}, result)
+}
+
+func TestMappingHandlerWithSchema(t *testing.T) {
+
+	source := createTestSchema(t, `{ "uid": { "type": "string" }, "name": { "type": "string" } }`)
+	target := createTestSchema(t, `{ "id": { "type": "int" }, "name": { "type": "string" } }`)
+
+	handler := NewHandler(&product_setting.HandlerConfig{
+		Type: "mapping",
+		Mapping: []*product_setting.FieldMapping{
+			{Source: "uid", Target: "id"},
+		},
+	}, source, target)
+
+	// Renamed field is converted by target schema
+	result := runTestHandler(t, handler, map[string]interface{}{"uid": "101", "name": "fred"})
+	assert.EqualValues(t, 101, result["id"])
+	assert.Equal(t, "fred", result["name"])
+	assert.NotContains(t, result, "uid")
+}
+
+func TestConstantHandler(t *testing.T) {
+
+	handler := NewHandler(&product_setting.HandlerConfig{
+		Type: "constant",
+		Constants: map[string]interface{}{
+			"source": "erp",
+			"name":   "overridden",
+		},
+	}, nil, nil)
+
+	assert.Equal(t, HANDLER_CONSTANT, handler.Type)
+
+	input := map[string]interface{}{
+		"id":   101,
+		"name": "fred",
+	}
+
+	result := runTestHandler(t, handler, input)
+	assert.Equal(t, map[string]interface{}{
+		"id":     101,
+		"name":   "overridden",
+		"source": "erp",
+	}, result)
+
+	assert.Equal(t, "fred", input["name"])
+	assert.NotContains(t, input, "source")
+}
+
+func TestCastHandler(t *testing.T) {
+
+	schema := createTestSchema(t, `{
+	"id": { "type": "int" },
+	"name": { "type": "string" },
+	"score": { "type": "float" },
+	"active": { "type": "bool" }
+}`)
+
+	handler := NewHandler(&product_setting.HandlerConfig{
+		Type: "cast",
+	}, schema, nil)
+
+	assert.Equal(t, HANDLER_CAST, handler.Type)
+	assert.Equal(t, schema, handler.GetDestinationSchema())
+
+	result := runTestHandler(t, handler, map[string]interface{}{
+		"id":     "101",
+		"name":   5,
+		"score":  "1.5",
+		"active": "true",
+		"extra":  "dropped",
+	})
+	assert.EqualValues(t, 101, result["id"])
+	assert.Equal(t, "5", result["name"])
+	assert.EqualValues(t, 1.5, result["score"])
+	assert.Equal(t, true, result["active"])
+	assert.NotContains(t, result, "extra")
+
+	// Values which failed to be cast become zero values
+	result = runTestHandler(t, handler, map[string]interface{}{
+		"id":     "abc",
+		"score":  "x",
+		"active": "maybe",
+	})
+	assert.EqualValues(t, 0, result["id"])
+	assert.EqualValues(t, 0, result["score"])
+	assert.Equal(t, false, result["active"])
+	assert.NotContains(t, result, "name")
+
+	// Null is kept
+	result = runTestHandler(t, handler, map[string]interface{}{"id": nil})
+	assert.Contains(t, result, "id")
+	assert.Nil(t, result["id"])
+}
+
+func TestCheckHandlerConfig(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		config   *product_setting.HandlerConfig
+		expected error
+	}{
+		{"script", &product_setting.HandlerConfig{Type: "script", Script: "return source"}, nil},
+		{"invalid script", &product_setting.HandlerConfig{Type: "script", Script: "return {"}, ErrInvalidScript},
+		{"constant", &product_setting.HandlerConfig{Type: "constant"}, nil},
+		{"cast", &product_setting.HandlerConfig{Type: "cast"}, nil},
+		{"unknown type", &product_setting.HandlerConfig{Type: "unknown"}, ErrInvalidHandlerType},
+		{"script without type", &product_setting.HandlerConfig{Script: "return source"}, nil},
+		{"invalid script without type", &product_setting.HandlerConfig{Script: "return {"}, ErrInvalidScript},
+		{"script with mapping", &product_setting.HandlerConfig{Script: "return source", Mapping: []*product_setting.FieldMapping{{Source: "a", Target: "b"}}}, ErrInvalidHandlerConfig},
+		{"constant with mapping", &product_setting.HandlerConfig{Type: "constant", Mapping: []*product_setting.FieldMapping{{Source: "a", Target: "b"}}}, ErrInvalidHandlerConfig},
+		{"cast with constants", &product_setting.HandlerConfig{Type: "cast", Constants: map[string]interface{}{"a": 1}}, ErrInvalidHandlerConfig},
+		{"mapping with constants", &product_setting.HandlerConfig{Type: "mapping", Constants: map[string]interface{}{"a": 1}}, ErrInvalidHandlerConfig},
+		{"mapping with script", &product_setting.HandlerConfig{Type: "mapping", Script: "return source"}, ErrInvalidHandlerConfig},
+		{
+			"mapping",
+			&product_setting.HandlerConfig{Type: "mapping", Mapping: []*product_setting.FieldMapping{
+				{Source: "a", Target: "b"},
+				{Action: "rename", Source: "c", Target: "d"},
+				{Action: "copy", Source: "e", Target: "f"},
+				{Action: "drop", Source: "g"},
+			}},
+			nil,
+		},
+		{
+			"unknown mapping action",
+			&product_setting.HandlerConfig{Type: "mapping", Mapping: []*product_setting.FieldMapping{
+				{Action: "move", Source: "a", Target: "b"},
+			}},
+			ErrInvalidFieldMapping,
+		},
+		{
+			"mapping without source",
+			&product_setting.HandlerConfig{Type: "mapping", Mapping: []*product_setting.FieldMapping{
+				{Target: "b"},
+			}},
+			ErrInvalidFieldMapping,
+		},
+		{
+			"rename without target",
+			&product_setting.HandlerConfig{Type: "mapping", Mapping: []*product_setting.FieldMapping{
+				{Source: "a"},
+			}},
+			ErrInvalidFieldMapping,
+		},
+		{
+			"copy without target",
+			&product_setting.HandlerConfig{Type: "mapping", Mapping: []*product_setting.FieldMapping{
+				{Action: "copy", Source: "a"},
+			}},
+			ErrInvalidFieldMapping,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			err := CheckHandlerConfig(c.config)
+			if c.expected == nil {
+				assert.Nil(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, c.expected)
+		})
+	}
+}
+
+func TestHandlerTypeOnlyAppliesItsOwnOptions(t *testing.T) {
+
+	config := &product_setting.HandlerConfig{
+		Mapping: []*product_setting.FieldMapping{
+			{Source: "name", Target: "displayName"},
+		},
+		Constants: map[string]interface{}{
+			"source": "erp",
+		},
+	}
+
+	input := map[string]interface{}{"id": 101, "name": "fred"}
+
+	config.Type = "constant"
+	result := runTestHandler(t, NewHandler(config, nil, nil), input)
+	assert.Equal(t, map[string]interface{}{"id": 101, "name": "fred", "source": "erp"}, result)
+
+	config.Type = "mapping"
+	result = runTestHandler(t, NewHandler(config, nil, nil), input)
+	assert.Equal(t, map[string]interface{}{"id": 101, "displayName": "fred"}, result)
+
+	config.Type = "cast"
+	result = runTestHandler(t, NewHandler(config, nil, nil), input)
+	assert.Equal(t, input, result)
+}
+
+func TestRuleWithoutHandlerType(t *testing.T) {
+
+	// Rule which was stored before handler types were supported
+	r := product_setting.NewRule()
+	r.Name = "legacy"
+	r.Event = "dataCreated"
+	r.SchemaConfig = map[string]interface{}{
+		"id":     map[string]interface{}{"type": "int"},
+		"legacy": map[string]interface{}{"type": "bool"},
+	}
+	r.HandlerConfig = &product_setting.HandlerConfig{
+		Script: `return { id: source.id, legacy: true }`,
+	}
+
+	rule := NewRule(r)
+	require.Nil(t, NewRuleManager().AddRule(rule))
+	assert.Equal(t, HANDLER_SCRIPT, rule.Handler.Type)
+
+	results, err := rule.Handler.Run(nil, map[string]interface{}{"id": 101})
+	require.Nil(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, true, results[0]["legacy"])
+}
@@ -3,19 +3,20 @@ package rule_manager
 import (
 	"sync"
 
-	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
 	"github.com/BrobridgeOrg/schemer"
 )
 
 type Rule struct {
-	product_sdk.Rule
+	product_setting.Rule
 	handlerPool  sync.Pool
+	filter       *Filter
 	Handler      *Handler
 	Schema       *schemer.Schema
 	TargetSchema *schemer.Schema
 }
 
-func NewRule(rule *product_sdk.Rule) *Rule {
+func NewRule(rule *product_setting.Rule) *Rule {
 
 	r := &Rule{
 		Rule: *rule,
@@ -41,20 +42,45 @@ func (r *Rule) applyConfigs() error {
 
 	r.Schema = schema
 
+	// Preparing filter
+	if r.Rule.Filter != nil {
+		filter, err := NewFilter(r.Rule.Filter)
+		if err != nil {
+			return err
+		}
+
+		r.filter = filter
+	}
+
 	// Preparing handler
 	if r.HandlerConfig == nil {
-		r.HandlerConfig = &product_sdk.HandlerConfig{
+		r.HandlerConfig = &product_setting.HandlerConfig{
 			Type:   "script",
 			Script: "return source",
 		}
 	}
 
+	err = CheckHandlerConfig(r.HandlerConfig)
+	if err != nil {
+		return err
+	}
+
 	r.Handler = NewHandler(r.HandlerConfig, r.Schema, r.TargetSchema)
 	r.handlerPool.Put(r.Handler)
 
 	return nil
 }
 
+// Match returns true if data should be handled by this rule.
+func (r *Rule) Match(data map[string]interface{}) bool {
+
+	if r.filter == nil {
+		return true
+	}
+
+	return r.filter.Match(data)
+}
+
 func (r *Rule) Transform(env map[string]interface{}, data map[string]interface{}) ([]map[string]interface{}, error) {
 	handler := r.handlerPool.Get()
 	defer r.handlerPool.Put(handler)
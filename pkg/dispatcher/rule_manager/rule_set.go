@@ -1,21 +1,51 @@
 package rule_manager
 
+import "sort"
+
 type RuleSet struct {
-	rules map[string]*Rule
+	rules   map[string]*Rule
+	ordered []*Rule
 }
 
 func NewRuleSet() *RuleSet {
 	return &RuleSet{
-		rules: make(map[string]*Rule),
+		rules:   make(map[string]*Rule),
+		ordered: make([]*Rule, 0),
 	}
 }
 
 func (rm *RuleSet) Set(id string, rule *Rule) {
 	rm.rules[id] = rule
+	rm.sort()
 }
 
 func (rm *RuleSet) Delete(id string) {
 	delete(rm.rules, id)
+	rm.sort()
+}
+
+func (rm *RuleSet) sort() {
+
+	rules := make([]*Rule, 0, len(rm.rules))
+	for _, rule := range rm.rules {
+		rules = append(rules, rule)
+	}
+
+	// Higher priority first, then order by name for deterministic evaluation
+	sort.SliceStable(rules, func(i, j int) bool {
+
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+
+		if rules[i].Name != rules[j].Name {
+			return rules[i].Name < rules[j].Name
+		}
+
+		return rules[i].ID < rules[j].ID
+	})
+
+	rm.ordered = rules
 }
 
 func (rm *RuleSet) Get(id string) *Rule {
@@ -27,22 +57,16 @@ func (rm *RuleSet) Get(id string) *Rule {
 	return nil
 }
 
+// List returns rules in evaluation order. The returned slice is shared, so callers must not modify it.
 func (rm *RuleSet) List() []*Rule {
-
-	rules := make([]*Rule, 0, len(rm.rules))
-
-	for _, rule := range rm.rules {
-		rules = append(rules, rule)
-	}
-
-	return rules
+	return rm.ordered
 }
 
 func (rm *RuleSet) First() *Rule {
 
-	for _, rule := range rm.rules {
-		return rule
+	if len(rm.ordered) == 0 {
+		return nil
 	}
 
-	return nil
+	return rm.ordered[0]
 }
@@ -0,0 +1,376 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/snapshot_record"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultSnapshotMaxPendingCount = 1024
+	DefaultSnapshotMaxWait         = time.Second
+	DefaultSnapshotRetryDelay      = time.Second
+)
+
+const (
+	snapshotBucket   = "GVT_%s_SS_%s"
+	snapshotConsumer = "GVT_%s_SS_%s"
+)
+
+var (
+	ErrSnapshotPrimaryKeyRequired = errors.New("primary key is required for snapshot")
+)
+
+// Snapshot materializes the latest state of every primary key of a product into a KV bucket.
+type Snapshot struct {
+	client  *core.Client
+	domain  string
+	product string
+	stream  string
+	durable string
+	kv      nats.KeyValue
+	sub     *nats.Subscription
+	running atomic.Bool
+	wg      sync.WaitGroup
+
+	// Snapshot store is created by provision if it's specified
+	provision func(name string, check func() (bool, error), create func() error) error
+}
+
+func NewSnapshot(client *core.Client, domain string, product string, stream string) *Snapshot {
+
+	if len(stream) == 0 {
+		stream = fmt.Sprintf(productEventStream, domain, product)
+	}
+
+	return &Snapshot{
+		client:  client,
+		domain:  domain,
+		product: product,
+		stream:  stream,
+		durable: fmt.Sprintf(snapshotConsumer, domain, product),
+	}
+}
+
+func (s *Snapshot) Init() error {
+
+	js, err := s.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	bucket := fmt.Sprintf(snapshotBucket, s.domain, s.product)
+
+	kv, err := assertKeyValue(js, s.provision, &nats.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "Gravity product snapshot",
+		History:     1,
+		Replicas:    3,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.kv = kv
+
+	return nil
+}
+
+func (s *Snapshot) assertConsumer() error {
+
+	viper.SetDefault("snapshot.max_pending_count", DefaultSnapshotMaxPendingCount)
+
+	maxPendingCount := viper.GetInt("snapshot.max_pending_count")
+
+	js, err := s.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	_, err = js.ConsumerInfo(s.stream, s.durable)
+	if err == nil {
+		return nil
+	}
+
+	if err != nats.ErrConsumerNotFound {
+		return err
+	}
+
+	subject := fmt.Sprintf(productEventSubject, s.domain, s.product)
+
+	logger.Info("Creating a new snapshot consumer...",
+		zap.String("stream", s.stream),
+		zap.String("consumer", s.durable),
+		zap.String("subject", subject),
+	)
+
+	_, err = js.AddConsumer(s.stream, &nats.ConsumerConfig{
+		Durable:       s.durable,
+		FilterSubject: subject,
+		AckPolicy:     nats.AckExplicitPolicy,
+		DeliverPolicy: nats.DeliverAllPolicy,
+		MaxAckPending: maxPendingCount,
+	})
+
+	return err
+}
+
+func (s *Snapshot) Start() error {
+
+	// Running already
+	if s.sub != nil {
+		return nil
+	}
+
+	viper.SetDefault("snapshot.max_pending_count", DefaultSnapshotMaxPendingCount)
+	viper.SetDefault("snapshot.max_wait", DefaultSnapshotMaxWait)
+
+	maxPendingCount := viper.GetInt("snapshot.max_pending_count")
+	maxWait := viper.GetDuration("snapshot.max_wait")
+
+	err := s.assertConsumer()
+	if err != nil {
+		return err
+	}
+
+	js, err := s.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	sub, err := js.PullSubscribe(fmt.Sprintf(productEventSubject, s.domain, s.product), s.durable, nats.BindStream(s.stream))
+	if err != nil {
+		return err
+	}
+
+	s.sub = sub
+	s.running.Store(true)
+	s.wg.Add(1)
+
+	logger.Info("Materializing snapshot...",
+		zap.String("product", s.product),
+		zap.String("consumer", s.durable),
+	)
+
+	go func() {
+
+		defer s.wg.Done()
+
+		for s.running.Load() {
+
+			msgs, err := sub.Fetch(maxPendingCount, nats.MaxWait(maxWait))
+			if err != nil {
+
+				if err == nats.ErrTimeout {
+					continue
+				}
+
+				if !s.running.Load() {
+					return
+				}
+
+				logger.Error("Failed to fetch events for snapshot",
+					zap.String("product", s.product),
+					zap.Error(err),
+				)
+
+				time.Sleep(DefaultSnapshotRetryDelay)
+				continue
+			}
+
+			for _, msg := range msgs {
+				s.handleMessage(msg)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *Snapshot) Stop() error {
+
+	if !s.running.Swap(false) {
+		return nil
+	}
+
+	if s.sub == nil {
+		return nil
+	}
+
+	sub := s.sub
+	s.sub = nil
+
+	err := sub.Unsubscribe()
+
+	// Waiting for fetching loop to exit, so no event is applied after stopped
+	s.wg.Wait()
+
+	return err
+}
+
+// Delete removes snapshot store and its consumer
+func (s *Snapshot) Delete() error {
+
+	err := s.Stop()
+	if err != nil {
+		return err
+	}
+
+	js, err := s.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	err = js.DeleteConsumer(s.stream, s.durable)
+	if err != nil && err != nats.ErrConsumerNotFound && err != nats.ErrStreamNotFound {
+		return err
+	}
+
+	err = js.DeleteKeyValue(fmt.Sprintf(snapshotBucket, s.domain, s.product))
+	if err != nil && err != nats.ErrBucketNotFound && err != nats.ErrStreamNotFound {
+		return err
+	}
+
+	s.kv = nil
+
+	return nil
+}
+
+func (s *Snapshot) handleMessage(msg *nats.Msg) {
+
+	meta, err := msg.Metadata()
+	if err != nil {
+		logger.Error("Failed to get metadata of product event",
+			zap.String("product", s.product),
+			zap.Error(err),
+		)
+
+		msg.Term()
+		return
+	}
+
+	var pe gravity_sdk_types_product_event.ProductEvent
+	err = gravity_sdk_types_product_event.Unmarshal(msg.Data, &pe)
+	if err != nil {
+		logger.Error("Failed to parse product event for snapshot",
+			zap.String("product", s.product),
+			zap.Error(err),
+		)
+
+		// Event is never applicable
+		msg.Term()
+		return
+	}
+
+	// Events must be applied in order, so retry until it works
+	for {
+
+		err = s.apply(&pe, meta.Sequence.Stream)
+		if err == nil {
+			break
+		}
+
+		if err == ErrSnapshotPrimaryKeyRequired {
+			logger.Warn("Ignored event without primary key for snapshot",
+				zap.String("product", s.product),
+				zap.String("event", pe.EventName),
+			)
+
+			break
+		}
+
+		logger.Error("Failed to apply event to snapshot",
+			zap.String("product", s.product),
+			zap.String("event", pe.EventName),
+			zap.Uint64("seq", meta.Sequence.Stream),
+			zap.Error(err),
+		)
+
+		time.Sleep(DefaultSnapshotRetryDelay)
+
+		if !s.running.Load() {
+			return
+		}
+	}
+
+	msg.Ack()
+}
+
+func (s *Snapshot) apply(pe *gravity_sdk_types_product_event.ProductEvent, seq uint64) error {
+
+	if pe.Method == gravity_sdk_types_product_event.Method_TRUNCATE {
+		return s.truncate()
+	}
+
+	if len(pe.PrimaryKey) == 0 {
+		return ErrSnapshotPrimaryKeyRequired
+	}
+
+	key := snapshot_record.EncodeKey(pe.PrimaryKey)
+
+	// Getting current state
+	var orig *snapshot_record.Record
+	if pe.Method == gravity_sdk_types_product_event.Method_UPDATE {
+
+		entry, err := s.kv.Get(key)
+		if err != nil && err != nats.ErrKeyNotFound {
+			return err
+		}
+
+		if entry != nil {
+			orig, err = snapshot_record.Unmarshal(entry.Value())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	r, err := snapshot_record.Apply(orig, pe, seq)
+	if err != nil {
+		return err
+	}
+
+	// Deleted
+	if r == nil {
+		return s.kv.Delete(key)
+	}
+
+	data, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.kv.Put(key, data)
+
+	return err
+}
+
+func (s *Snapshot) truncate() error {
+
+	keys, err := s.kv.Keys()
+	if err != nil {
+		if err == nats.ErrNoKeysFound {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, key := range keys {
+		err := s.kv.Purge(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/snapshot_record"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
+	record_type "github.com/BrobridgeOrg/gravity-sdk/v2/types/record"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func CreateTestClient(t *testing.T) *core.Client {
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.Nil(t, err)
+
+	go s.Start()
+
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server is not ready")
+	}
+
+	t.Cleanup(s.Shutdown)
+
+	client := core.NewClient()
+	err = client.Connect(s.ClientURL(), core.NewOptions())
+	require.Nil(t, err)
+
+	t.Cleanup(client.Disconnect)
+
+	return client
+}
+
+func PublishTestProductEvent(t *testing.T, js nats.JetStreamContext, product string, method gravity_sdk_types_product_event.Method, pk string, payload map[string]interface{}) {
+
+	r := record_type.NewRecord()
+	err := record_type.UnmarshalMapData(payload, r)
+	require.Nil(t, err)
+
+	pe := &gravity_sdk_types_product_event.ProductEvent{
+		EventName:   "dataChanged",
+		Table:       product,
+		Method:      method,
+		PrimaryKeys: []string{"id"},
+		PrimaryKey:  []byte(pk),
+	}
+
+	err = pe.SetContent(r)
+	require.Nil(t, err)
+
+	data, err := gravity_sdk_types_product_event.Marshal(pe)
+	require.Nil(t, err)
+
+	_, err = js.Publish(fmt.Sprintf("$GVT.default.DP.%s.0.EVENT.dataChanged", product), data)
+	require.Nil(t, err)
+}
+
+func GetTestSnapshotRecord(t *testing.T, kv nats.KeyValue, pk string) map[string]interface{} {
+
+	entry, err := kv.Get(snapshot_record.EncodeKey([]byte(pk)))
+	if err != nil {
+		return nil
+	}
+
+	r, err := snapshot_record.Unmarshal(entry.Value())
+	require.Nil(t, err)
+
+	pe, err := r.GetProductEvent()
+	require.Nil(t, err)
+
+	content, err := pe.GetContent()
+	require.Nil(t, err)
+
+	return content.AsMap()
+}
+
+func TestSnapshot(t *testing.T) {
+
+	logger = zap.NewNop()
+
+	client := CreateTestClient(t)
+	js, err := client.GetJetStream()
+	require.Nil(t, err)
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     fmt.Sprintf(productEventStream, "default", "TestSnapshot"),
+		Subjects: []string{fmt.Sprintf(productEventSubject, "default", "TestSnapshot")},
+	})
+	require.Nil(t, err)
+
+	s := NewSnapshot(client, "default", "TestSnapshot", "")
+	require.Nil(t, s.Init())
+	require.Nil(t, s.Start())
+	t.Cleanup(func() {
+		s.Stop()
+	})
+
+	PublishTestProductEvent(t, js, "TestSnapshot", gravity_sdk_types_product_event.Method_INSERT, "1", map[string]interface{}{"id": int64(1), "name": "fred", "type": "A"})
+	PublishTestProductEvent(t, js, "TestSnapshot", gravity_sdk_types_product_event.Method_INSERT, "2", map[string]interface{}{"id": int64(2), "name": "armani"})
+	PublishTestProductEvent(t, js, "TestSnapshot", gravity_sdk_types_product_event.Method_UPDATE, "1", map[string]interface{}{"name": "bob"})
+	PublishTestProductEvent(t, js, "TestSnapshot", gravity_sdk_types_product_event.Method_DELETE, "2", map[string]interface{}{"id": int64(2)})
+	PublishTestProductEvent(t, js, "TestSnapshot", gravity_sdk_types_product_event.Method_UPDATE, "3", map[string]interface{}{"id": int64(3), "name": "cathy"})
+
+	// Waiting for all events to be applied
+	require.Eventually(t, func() bool {
+		return GetTestSnapshotRecord(t, s.kv, "3") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Changes were merged into existing record
+	record := GetTestSnapshotRecord(t, s.kv, "1")
+	assert.Equal(t, "bob", record["name"])
+	assert.Equal(t, "A", record["type"])
+	assert.EqualValues(t, 1, record["id"])
+
+	// Deleted
+	assert.Nil(t, GetTestSnapshotRecord(t, s.kv, "2"))
+
+	// Update for a new key
+	assert.Equal(t, "cathy", GetTestSnapshotRecord(t, s.kv, "3")["name"])
+
+	// Truncate
+	PublishTestProductEvent(t, js, "TestSnapshot", gravity_sdk_types_product_event.Method_TRUNCATE, "", map[string]interface{}{})
+
+	require.Eventually(t, func() bool {
+		_, err := s.kv.Keys()
+		return err == nats.ErrNoKeysFound
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Fetching loop is gone once stopped
+	require.Nil(t, s.Stop())
+	require.Nil(t, s.Stop())
+
+	PublishTestProductEvent(t, js, "TestSnapshot", gravity_sdk_types_product_event.Method_INSERT, "4", map[string]interface{}{"id": int64(4), "name": "dave"})
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, GetTestSnapshotRecord(t, s.kv, "4"))
+
+	// Pending events are applied after restarted
+	require.Nil(t, s.Start())
+
+	require.Eventually(t, func() bool {
+		return GetTestSnapshotRecord(t, s.kv, "4") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Delete snapshot store
+	require.Nil(t, s.Delete())
+
+	_, err = js.KeyValue(fmt.Sprintf(snapshotBucket, "default", "TestSnapshot"))
+	assert.Equal(t, nats.ErrBucketNotFound, err)
+}
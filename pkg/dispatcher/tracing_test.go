@@ -0,0 +1,116 @@
+package dispatcher
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/tracing"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracePropagation(t *testing.T) {
+
+	// Record spans in memory
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+	})
+
+	d := CreateTestDispatcher(t)
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = "trace_test"
+	setting.Enabled = true
+	setting.Rules["testRule"] = CreateTestProductRule()
+	setting.Rules["testRule"].Product = setting.Name
+
+	data, err := json.Marshal(setting)
+	require.Nil(t, err)
+
+	_, err = d.productConfigStore.Put(setting.Name, data)
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		code, report := RequestTestHealth(t, d.readyzHandler)
+		return code == http.StatusOK && report.Products["trace_test"] != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	js, err := d.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	// Event comes from a traced adapter
+	raw, _ := json.Marshal(MessageRawData{
+		Event:      "dataCreated",
+		RawPayload: []byte(`{"id":101,"name":"fred"}`),
+	})
+
+	msg := nats.NewMsg("$GVT.default.EVENT.dataCreated")
+	msg.Data = raw
+	msg.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	_, err = js.PublishMsg(msg)
+	require.Nil(t, err)
+
+	sub, err := js.SubscribeSync("$GVT.default.DP.trace_test.>", nats.OrderedConsumer())
+	require.Nil(t, err)
+	defer sub.Unsubscribe()
+
+	output, err := sub.NextMsg(5 * time.Second)
+	require.Nil(t, err)
+
+	// Downstream subscribers are able to continue the trace
+	ctx := tracing.Extract(t.Context(), output.Header)
+	sc := trace.SpanContextFromContext(ctx)
+	require.True(t, sc.IsValid())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+
+	require.Eventually(t, func() bool {
+		for _, s := range recorder.Ended() {
+			if s.Name() == "Message.Wait" {
+				return true
+			}
+		}
+
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+
+	for _, name := range []string{
+		"EventWatcher.fetch",
+		"Product.handleMessage",
+		"Processor.process",
+		"Processor.match",
+		"Processor.parse",
+		"Processor.transform",
+		"Processor.convert",
+		"Message.Dispatch",
+		"Message.Wait",
+	} {
+		require.Contains(t, spans, name)
+	}
+
+	// Spans of event belong to the trace of source
+	for _, name := range []string{"Product.handleMessage", "Processor.transform", "Message.Dispatch"} {
+		assert.Equal(t, sc.TraceID(), spans[name].SpanContext().TraceID(), name)
+	}
+
+	// Output was published with context of dispatching
+	assert.Equal(t, spans["Message.Dispatch"].SpanContext().SpanID(), sc.SpanID())
+	assert.Equal(t, spans["Product.handleMessage"].SpanContext().SpanID(), spans["Processor.process"].Parent().SpanID())
+}
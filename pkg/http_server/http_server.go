@@ -0,0 +1,106 @@
+package http_server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var logger *zap.Logger
+
+const (
+	DefaultEnabled         = true
+	DefaultAddress         = ":8080"
+	DefaultShutdownTimeout = 5 * time.Second
+)
+
+// HTTPServer serves endpoints for monitoring
+type HTTPServer struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+func New(lifecycle fx.Lifecycle, l *zap.Logger) *HTTPServer {
+
+	logger = l.Named("HTTPServer")
+
+	hs := &HTTPServer{
+		mux: http.NewServeMux(),
+	}
+
+	hs.mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+
+	lifecycle.Append(
+		fx.Hook{
+			OnStart: func(context.Context) error {
+				return hs.start()
+			},
+			OnStop: func(ctx context.Context) error {
+				return hs.stop(ctx)
+			},
+		},
+	)
+
+	return hs
+}
+
+// Handle registers handler for specific path
+func (hs *HTTPServer) Handle(pattern string, handler http.Handler) {
+	hs.mux.Handle(pattern, handler)
+}
+
+func (hs *HTTPServer) start() error {
+
+	viper.SetDefault("http.enabled", DefaultEnabled)
+	viper.SetDefault("http.address", DefaultAddress)
+
+	if !viper.GetBool("http.enabled") {
+		return nil
+	}
+
+	address := viper.GetString("http.address")
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Starting HTTP server...",
+		zap.String("address", ln.Addr().String()),
+	)
+
+	hs.server = &http.Server{
+		Handler:           hs.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := hs.server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("HTTP server was stopped",
+				zap.Error(err),
+			)
+		}
+	}()
+
+	return nil
+}
+
+func (hs *HTTPServer) stop(ctx context.Context) error {
+
+	if hs.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultShutdownTimeout)
+	defer cancel()
+
+	return hs.server.Shutdown(ctx)
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const (
+	namespace = "gravity"
+	subsystem = "dispatcher"
+)
+
+// Registry contains all collectors of dispatcher
+var Registry = prometheus.NewRegistry()
+
+var (
+	EventsFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "events_fetched_total",
+		Help:      "Number of domain events fetched by event watcher.",
+	}, []string{"product"})
+
+	EventsMatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "events_matched_total",
+		Help:      "Number of events which matched rules of product.",
+	}, []string{"product"})
+
+	EventsIgnored = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "events_ignored_total",
+		Help:      "Number of events which matched no rule of product.",
+	}, []string{"product"})
+
+	ProcessingFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "processing_failures_total",
+		Help:      "Number of events which were failed to be processed, by stage (parse, transform or convert).",
+	}, []string{"product", "stage"})
+
+	PublishLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "publish_latency_seconds",
+		Help:      "Time from publishing events to receiving acks of product stream.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"product"})
+
+	DispatchRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "dispatch_retries_total",
+		Help:      "Number of retries for dispatching events to product stream.",
+	}, []string{"product"})
+
+	BufferDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "buffer_depth",
+		Help:      "Number of messages waiting in dispatcher buffer.",
+	}, []string{"product"})
+
+	ConsumerPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "consumer_pending",
+		Help:      "Number of domain events which were not delivered to consumer of product yet.",
+	}, []string{"product"})
+)
+
+var productCollectors = []interface {
+	DeletePartialMatch(prometheus.Labels) int
+}{
+	EventsFetched,
+	EventsMatched,
+	EventsIgnored,
+	ProcessingFailures,
+	PublishLatency,
+	DispatchRetries,
+	BufferDepth,
+	ConsumerPending,
+}
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		EventsFetched,
+		EventsMatched,
+		EventsIgnored,
+		ProcessingFailures,
+		PublishLatency,
+		DispatchRetries,
+		BufferDepth,
+		ConsumerPending,
+	)
+}
+
+// DeleteProduct removes all series of specific product
+func DeleteProduct(name string) {
+	for _, c := range productCollectors {
+		c.DeletePartialMatch(prometheus.Labels{"product": name})
+	}
+}
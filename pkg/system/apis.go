@@ -0,0 +1,253 @@
+package system
+
+import (
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dry_run"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/partitioning"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/token"
+)
+
+// System
+type StatusRequest struct {
+}
+
+type StatusReply struct {
+	core.ErrorReply
+	Replica  string  `json:"replica"` // Replica which handled the request.
+	IsLeader bool    `json:"isLeader"`
+	Leader   *Leader `json:"leader"` // It's empty if there is no leader for now.
+}
+
+// Product
+type ProductInfo struct {
+	Setting *product_setting.ProductSetting `json:"setting"`
+	State   *internal.ProductState          `json:"state"`
+}
+
+type ListProductsReply struct {
+	core.ErrorReply
+	Products []*ProductInfo `json:"products"`
+}
+
+type CreateProductRequest struct {
+	Setting *product_setting.ProductSetting `json:"setting"`
+}
+
+type CreateProductReply struct {
+	core.ErrorReply
+	Setting  *product_setting.ProductSetting `json:"setting"`
+	Revision uint64                          `json:"revision,omitempty"` // Revision of setting which was created by this change.
+	Errors   []*FieldError                   `json:"errors,omitempty"`   // Invalid fields of setting.
+}
+
+type UpdateProductRequest struct {
+	Name    string                          `json:"name"`
+	Setting *product_setting.ProductSetting `json:"setting"`
+}
+
+type UpdateProductReply struct {
+	core.ErrorReply
+	Setting  *product_setting.ProductSetting `json:"setting"`
+	Revision uint64                          `json:"revision,omitempty"` // Revision of setting which was created by this change.
+	Errors   []*FieldError                   `json:"errors,omitempty"`   // Invalid fields of setting.
+}
+
+type InfoProductReply struct {
+	core.ErrorReply
+	Setting *product_setting.ProductSetting `json:"setting"`
+	State   *internal.ProductState          `json:"state"`
+}
+
+// Subscription
+type PrepareSubscriptionRequest struct {
+	product.PrepareSubscriptionRequest
+	Snapshot       bool            `json:"snapshot"`                 // Deliver a consistent snapshot before live events.
+	PartitionRange *PartitionRange `json:"partitionRange,omitempty"` // Partitions of consumers which don't specify partitions.
+}
+
+// PartitionRange selects partitions from First to Last inclusively.
+type PartitionRange struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+type PrepareSubscriptionReply struct {
+	product.PrepareSubscriptionReply
+	Subscription string                 `json:"subscription,omitempty"`
+	Snapshot     *internal.SnapshotView `json:"snapshot,omitempty"`
+	Partitioning []*partitioning.Range  `json:"partitioning,omitempty"` // Partitioning of product stream by ranges of sequence.
+}
+
+// Dead-letter
+type ListDeadLettersRequest struct {
+	Product  string `json:"product"`
+	StartSeq uint64 `json:"startSeq"`
+	Count    int    `json:"count"`
+}
+
+type ListDeadLettersReply struct {
+	core.ErrorReply
+	DeadLetters []*internal.DeadLetter `json:"deadLetters"`
+	Total       uint64                 `json:"total"`
+	NextSeq     uint64                 `json:"nextSeq"` // Zero if there is no more dead-letter event
+}
+
+type InfoDeadLetterRequest struct {
+	Product string `json:"product"`
+	Seq     uint64 `json:"seq"`
+}
+
+type InfoDeadLetterReply struct {
+	core.ErrorReply
+	DeadLetter *internal.DeadLetter `json:"deadLetter"`
+}
+
+type ReplayDeadLettersRequest struct {
+	Product string   `json:"product"`
+	Seqs    []uint64 `json:"seqs"`
+}
+
+type ReplayDeadLettersReply struct {
+	core.ErrorReply
+	Count int `json:"count"`
+}
+
+type PurgeDeadLettersRequest struct {
+	Product string   `json:"product"`
+	Seqs    []uint64 `json:"seqs"`
+}
+
+type PurgeDeadLettersReply struct {
+	core.ErrorReply
+}
+
+// Snapshot
+type ListSnapshotRequest struct {
+	Product  string `json:"product"`
+	AfterKey string `json:"afterKey"`
+	Count    int    `json:"count"`
+}
+
+type ListSnapshotReply struct {
+	core.ErrorReply
+	Records []*internal.SnapshotRecord `json:"records"`
+	LastKey string                     `json:"lastKey"`
+	HasMore bool                       `json:"hasMore"`
+}
+
+type GetSnapshotRequest struct {
+	Product string `json:"product"`
+	Key     string `json:"key"`
+}
+
+type GetSnapshotReply struct {
+	core.ErrorReply
+	Record *internal.SnapshotRecord `json:"record"`
+}
+
+// ACL
+type GetProductACLRequest struct {
+	Product string `json:"product"`
+}
+
+type GetProductACLReply struct {
+	core.ErrorReply
+	ACL *internal.ProductACL `json:"acl"`
+}
+
+type SetProductACLRequest struct {
+	Product string               `json:"product"`
+	ACL     *internal.ProductACL `json:"acl"`
+}
+
+type SetProductACLReply struct {
+	core.ErrorReply
+	ACL *internal.ProductACL `json:"acl"`
+}
+
+// Rule testing
+type TestRuleRequest struct {
+	Product  string                `json:"product"`
+	RuleName string                `json:"ruleName,omitempty"` // Name of existing rule of product.
+	Rule     *product_setting.Rule `json:"rule,omitempty"`     // Rule definition to be tested instead of existing rule.
+	Events   []*dry_run.Event      `json:"events"`
+}
+
+type TestRuleReply struct {
+	core.ErrorReply
+	Results []*dry_run.Result `json:"results"`
+}
+
+// Revision
+type ListRevisionsRequest struct {
+	Product string `json:"product"`
+}
+
+type ListRevisionsReply struct {
+	core.ErrorReply
+	Revisions []*internal.ProductRevision `json:"revisions"` // Settings are not included.
+}
+
+type GetRevisionRequest struct {
+	Product  string `json:"product"`
+	Revision uint64 `json:"revision"`
+}
+
+type GetRevisionReply struct {
+	core.ErrorReply
+	Revision *internal.ProductRevision `json:"revision"`
+}
+
+type DiffRevisionsRequest struct {
+	Product string `json:"product"`
+	From    uint64 `json:"from"`
+	To      uint64 `json:"to"` // Current setting of product will be compared if it's zero.
+}
+
+type DiffRevisionsReply struct {
+	core.ErrorReply
+	Changes []*internal.SettingChange `json:"changes"`
+}
+
+type RollbackProductRequest struct {
+	Product  string `json:"product"`
+	Revision uint64 `json:"revision"`
+}
+
+type RollbackProductReply struct {
+	core.ErrorReply
+	Setting  *product_setting.ProductSetting `json:"setting"`
+	Revision uint64                          `json:"revision,omitempty"` // Revision of setting which was created by rollback.
+	Errors   []*FieldError                   `json:"errors,omitempty"`   // Invalid fields of setting to be restored.
+}
+
+// Token
+type CreateTokenRequest struct {
+	token.CreateTokenRequest
+	TTL int64 `json:"ttl"` // Lifetime of JWT in seconds. JWT never expires if it's zero.
+}
+
+type InfoTokenRequest struct {
+	token.InfoTokenRequest
+	TTL int64 `json:"ttl"` // Lifetime of JWT in seconds. JWT never expires if it's zero.
+}
+
+type RevokeTokenRequest struct {
+	Token string `json:"token"` // JWT to be revoked
+}
+
+type RevokeTokenReply struct {
+	core.ErrorReply
+}
+
+type RotateKeyRequest struct {
+	GracePeriod int64 `json:"gracePeriod"` // Seconds that JWTs signed with previous key are still valid.
+}
+
+type RotateKeyReply struct {
+	core.ErrorReply
+	KeyID string `json:"kid"`
+}
@@ -2,8 +2,11 @@ package system
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
 type Permissions map[string]string
@@ -13,6 +16,9 @@ var availablePermissions = Permissions{
 	// Administrator
 	"ADMIN": "Administrator",
 
+	// System
+	"SYSTEM.STATUS": "Get status of dispatcher replicas",
+
 	// Product
 	"PRODUCT.LIST":          "List available products",
 	"PRODUCT.CREATE":        "Create product",
@@ -30,39 +36,119 @@ var availablePermissions = Permissions{
 	"TOKEN.DELETE": "Delete specific token",
 	"TOKEN.UPDATE": "Update specific token",
 	"TOKEN.INFO":   "Get specific token information",
+	"TOKEN.REVOKE": "Revoke specific JWT",
 }
 
+const (
+	DefaultKeyRotationGracePeriod = 24 * time.Hour
+)
+
+var (
+	ErrTokenRevoked       = errors.New("token was revoked")
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+)
+
 type Claims struct {
 	TokenID string `json:"tokenID"`
 	jwt.StandardClaims
+
+	// Token from identity provider
+	External    bool     `json:"-"`
+	Permissions []string `json:"-"`
 }
 
-func EncodeToken(tokenID string) (string, error) {
+// EncodeToken issues a JWT for specific token. JWT never expires if ttl is zero.
+func EncodeToken(tokenID string, ttl time.Duration) (string, error) {
+
+	now := time.Now()
 
 	claims := &Claims{
-		tokenID,
-		jwt.StandardClaims{
-			Issuer: "Gravity",
-			//ExpiresAt: time.Now().Add(time.Minute * 1).Unix(),
+		TokenID: tokenID,
+		StandardClaims: jwt.StandardClaims{
+			Id:       uuid.New().String(),
+			Issuer:   "Gravity",
+			IssuedAt: now.Unix(),
 		},
 	}
 
+	if ttl > 0 {
+		claims.ExpiresAt = now.Add(ttl).Unix()
+	}
+
+	// Asymmetric key
+	if system.signing != nil {
+		return system.signing.Sign(claims)
+	}
+
+	secret := system.sysConfig.GetEntry("secret").Secret()
+
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return t.SignedString([]byte(system.sysConfig.GetEntry("secret").Secret().Key))
+	// Key ID is required for finding signing key after rotation
+	if len(secret.KeyID) > 0 {
+		t.Header["kid"] = secret.KeyID
+	}
+
+	return t.SignedString([]byte(secret.Key))
 }
 
 func DecodeToken(tokenString string) (*Claims, error) {
 
+	var claims *Claims
+	var err error
+
+	// Token was issued by identity provider
+	if system.idp != nil && system.idp.IsTrusted(tokenString) {
+		claims, err = system.idp.Decode(tokenString)
+	} else {
+		claims, err = decodeToken(tokenString)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Check whether token was revoked or not
+	if len(claims.Id) > 0 && system.sysConfig.IsTokenRevoked(claims.Id) {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+func decodeToken(tokenString string) (*Claims, error) {
+
 	// Decode token
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (i interface{}, err error) {
-		return []byte(system.sysConfig.GetEntry("secret").Secret().Key), nil
+
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+
+			if system.signing == nil {
+				return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
+			}
+
+			return system.signing.VerificationKey(token)
+		}
+
+		// Shared secret is disallowed if asymmetric key was configured
+		if system.signing != nil && !system.signing.AllowLegacy {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+
+		key, ok := system.sysConfig.GetEntry("secret").Secret().GetKey(kid, time.Now())
+		if !ok {
+			return nil, ErrSigningKeyNotFound
+		}
+
+		return []byte(key), nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return token.Claims.(*Claims), err
+	return token.Claims.(*Claims), nil
 }
 
 func RequiredAuth() RPCHandler {
@@ -120,7 +206,7 @@ func RequiredPermissions(permissions ...string) RPCHandler {
 		claims := v.(*Claims)
 
 		// Getting token's permissions
-		tokenInfo, err := system.tokenRPC.tokenManager.GetToken(claims.TokenID)
+		tokenInfo, err := getTokenSetting(claims)
 		if err != nil {
 			ctx.Res.Error = err
 
@@ -144,5 +230,10 @@ func RequiredPermissions(permissions ...string) RPCHandler {
 				return
 			}
 		}
+
+		ctx.Res.Error = fmt.Errorf("Forbidden: token \"%s\" requires one of permissions %v", claims.TokenID, permissions)
+		reply := &ErrorRPCState{}
+		reply.Error = PermissionDeniedErr(permissions)
+		ctx.Res.Data = reply
 	}
 }
@@ -0,0 +1,165 @@
+package system
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type permissionTestCase struct {
+	api        string
+	path       string
+	permission string
+	data       string
+}
+
+func CreateTestToken(t *testing.T, sys *System, tokenID string, permissions ...string) string {
+
+	setting := &token.TokenSetting{
+		ID:          tokenID,
+		Enabled:     true,
+		Permissions: make(map[string]*token.Permission),
+	}
+
+	for _, perm := range permissions {
+		setting.Permissions[perm] = &token.Permission{}
+	}
+
+	_, err := sys.tokenRPC.tokenManager.CreateToken(tokenID, setting)
+	require.Nil(t, err)
+
+	jwt, err := EncodeToken(tokenID, 0)
+	require.Nil(t, err)
+
+	return jwt
+}
+
+func TestRequiredPermissions(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	domain := sys.connector.GetDomain()
+	productAPI := fmt.Sprintf(product.ProductAPI, domain)
+	tokenAPI := fmt.Sprintf(token.TokenAPI, domain)
+	coreAPI := fmt.Sprintf(core.CoreAPI, domain)
+
+	// Requests are designed to be harmless even if permission was granted
+	testCases := []permissionTestCase{
+		{productAPI, "LIST", "PRODUCT.LIST", `{}`},
+		{productAPI, "CREATE", "PRODUCT.CREATE", `{"setting":{"name":"perm_test"}}`},
+		{productAPI, "UPDATE", "PRODUCT.UPDATE", `{"name":"perm_test","setting":{"name":"perm_test"}}`},
+		{productAPI, "DELETE", "PRODUCT.DELETE", `{"name":"perm_test"}`},
+		{productAPI, "INFO", "PRODUCT.INFO", `{"name":"perm_test"}`},
+		{productAPI, "PURGE", "PRODUCT.PURGE", `{"name":"perm_test"}`},
+		{productAPI, "PREPARE_SUBSCRIPTION", "PRODUCT.SUBSCRIPTION", `{"product":"perm_test"}`},
+		{productAPI, "DLQ.LIST", "PRODUCT.INFO", `{"product":"perm_test"}`},
+		{productAPI, "DLQ.INFO", "PRODUCT.INFO", `{"product":"perm_test","seq":1}`},
+		{productAPI, "DLQ.REPLAY", "PRODUCT.UPDATE", `{"product":"perm_test"}`},
+		{productAPI, "DLQ.PURGE", "PRODUCT.PURGE", `{"product":"perm_test"}`},
+		{productAPI, "ACL.GET", "PRODUCT.ACL", `{"product":"perm_test"}`},
+		{productAPI, "ACL.SET", "PRODUCT.ACL", `{"product":"perm_test","acl":{"tokens":{}}}`},
+		{productAPI, "GET_SUBSCRIPTION", "PRODUCT.SUBSCRIPTION", `{"product":"perm_test"}`},
+		{productAPI, "DELETE_SUBSCRIPTION", "PRODUCT.SUBSCRIPTION", `{"product":"perm_test"}`},
+		{productAPI, "SNAPSHOT.LIST", "PRODUCT.SNAPSHOT.READ", `{"product":"perm_test"}`},
+		{productAPI, "SNAPSHOT.GET", "PRODUCT.SNAPSHOT.READ", `{"product":"perm_test","key":"a"}`},
+		{productAPI, "TEST_RULE", "PRODUCT.UPDATE", `{"product":"perm_test","ruleName":"a","events":[{"payload":{}}]}`},
+		{productAPI, "REVISION.LIST", "PRODUCT.INFO", `{"product":"perm_test"}`},
+		{productAPI, "REVISION.GET", "PRODUCT.INFO", `{"product":"perm_test","revision":1}`},
+		{productAPI, "REVISION.DIFF", "PRODUCT.INFO", `{"product":"perm_test","from":1}`},
+		{productAPI, "REVISION.ROLLBACK", "PRODUCT.UPDATE", `{"product":"perm_test","revision":1}`},
+		{tokenAPI, "LIST_AVAILABLE_PERMISSIONS", "", `{}`},
+		{tokenAPI, "LIST", "TOKEN.LIST", `{}`},
+		{tokenAPI, "CREATE", "TOKEN.CREATE", `{"tokenID":"perm_test","setting":{"permissions":{"UNKNOWN":{}}}}`},
+		{tokenAPI, "UPDATE", "TOKEN.UPDATE", `{"token":"perm_test","setting":{"permissions":{"UNKNOWN":{}}}}`},
+		{tokenAPI, "DELETE", "TOKEN.DELETE", `{"tokenID":"perm_test"}`},
+		{tokenAPI, "INFO", "TOKEN.INFO", `{"token":"perm_test"}`},
+		{tokenAPI, "REVOKE", "TOKEN.REVOKE", `{"token":"invalid"}`},
+		{tokenAPI, "ROTATE_KEY", "ADMIN", `{}`},
+		{coreAPI, "AUTHENTICATE", "", `{"token":"invalid"}`},
+		{coreAPI, "STATUS", "SYSTEM.STATUS", `{}`},
+	}
+
+	// Make sure all registered APIs are covered
+	registered := make([]string, 0)
+	for _, rpc := range []RPC{sys.productRPC.RPC, sys.tokenRPC.RPC, sys.coreRPC.RPC} {
+		for _, route := range rpc.routes {
+			for _, path := range route.paths {
+				registered = append(registered, fmt.Sprintf("%s.%s", route.prefix, path))
+			}
+		}
+	}
+
+	covered := make([]string, 0, len(testCases))
+	for _, tc := range testCases {
+		covered = append(covered, fmt.Sprintf("%s.%s", tc.api, tc.path))
+	}
+
+	sort.Strings(registered)
+	sort.Strings(covered)
+	require.Equal(t, registered, covered)
+
+	// Preparing tokens
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+	emptyToken := CreateTestToken(t, sys, "empty")
+	unrelatedTokens := map[string]string{
+		"PRODUCT.SNAPSHOT.READ": CreateTestToken(t, sys, "unrelated", "PRODUCT.SNAPSHOT.READ"),
+		"TOKEN.LIST":            CreateTestToken(t, sys, "unrelated_token", "TOKEN.LIST"),
+	}
+
+	for i, tc := range testCases {
+
+		subject := fmt.Sprintf("%s.%s", tc.api, tc.path)
+
+		t.Run(tc.path, func(t *testing.T) {
+
+			// No token
+			reply := RequestTestAPI(t, nc, subject, "", []byte(tc.data))
+			if assert.NotNil(t, reply.Error, subject) {
+				assert.Equal(t, 44403, reply.Error.Code, subject)
+			}
+
+			// Administrator
+			reply = RequestTestAPI(t, nc, subject, adminToken, []byte(tc.data))
+			if reply.Error != nil {
+				assert.NotEqual(t, 44403, reply.Error.Code, subject)
+			}
+
+			if len(tc.permission) == 0 {
+				reply = RequestTestAPI(t, nc, subject, emptyToken, []byte(tc.data))
+				if reply.Error != nil {
+					assert.NotEqual(t, 44403, reply.Error.Code, subject)
+				}
+
+				return
+			}
+
+			// Without required permission
+			unrelatedToken := unrelatedTokens["PRODUCT.SNAPSHOT.READ"]
+			if tc.permission == "PRODUCT.SNAPSHOT.READ" {
+				unrelatedToken = unrelatedTokens["TOKEN.LIST"]
+			}
+
+			for _, jwt := range []string{emptyToken, unrelatedToken} {
+				reply = RequestTestAPI(t, nc, subject, jwt, []byte(tc.data))
+				if assert.NotNil(t, reply.Error, subject) {
+					assert.Equal(t, 44403, reply.Error.Code, subject)
+				}
+			}
+
+			// Granted
+			grantedToken := CreateTestToken(t, sys, fmt.Sprintf("granted_%d", i), tc.permission)
+			reply = RequestTestAPI(t, nc, subject, grantedToken, []byte(tc.data))
+			if reply.Error != nil {
+				assert.NotEqual(t, 44403, reply.Error.Code, subject)
+			}
+		})
+	}
+}
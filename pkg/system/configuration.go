@@ -1,8 +1,11 @@
 package system
 
 import (
+	"time"
+
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/connector"
 	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/google/uuid"
 )
 
 type Config struct {
@@ -69,9 +72,49 @@ func (cfg *Config) initialize() error {
 		return err
 	}
 
+	_, err = cfg.configManager.InitializeEntry("revocation", func() []byte {
+
+		logger.Info("Initializing token revocation list...")
+
+		revocation := internal.ConfigEntryRevocation{
+			Tokens: make(map[string]time.Time),
+		}
+
+		data, _ := json.Marshal(revocation)
+
+		return data
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (cfg *Config) GetEntry(key string) internal.IConfigEntry {
 	return cfg.configManager.GetEntry(key)
 }
+
+func (cfg *Config) IsTokenRevoked(jwtID string) bool {
+
+	entry := cfg.configManager.GetEntry("revocation")
+	if entry == nil || entry.Revocation() == nil {
+		return false
+	}
+
+	return entry.Revocation().IsRevoked(jwtID)
+}
+
+func (cfg *Config) RevokeToken(jwtID string, expiresAt time.Time) error {
+	return cfg.configManager.RevokeToken(jwtID, expiresAt)
+}
+
+func (cfg *Config) RotateSecret(gracePeriod time.Duration) (*internal.ConfigEntrySecret, error) {
+
+	key, err := internal.GenerateRandomString(64)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.configManager.RotateSecret(uuid.New().String(), key, gracePeriod)
+}
@@ -0,0 +1,49 @@
+package system
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigInitialization(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+
+	// Another replica shares the same secret
+	cfg := NewConfig(sys.connector)
+	require.NotNil(t, cfg)
+
+	value, err := cfg.configManager.InitializeEntry("secret", func() []byte {
+		return []byte(`{"key":"another"}`)
+	})
+	require.Nil(t, err)
+	assert.NotContains(t, string(value), "another")
+
+	// Only one of replicas initializes entry
+	values := make([]string, 10)
+
+	var wg sync.WaitGroup
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			value, err := sys.sysConfig.configManager.InitializeEntry("test", func() []byte {
+				return []byte(fmt.Sprintf(`{"replica":%d}`, i))
+			})
+			assert.Nil(t, err)
+
+			values[i] = string(value)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, value := range values {
+		assert.Equal(t, values[0], value)
+	}
+}
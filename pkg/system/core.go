@@ -40,10 +40,33 @@ func (crpc *CoreRPC) initialize() error {
 	route, _ := crpc.createRoute("admin", prefix)
 	route.Use(RequiredAuth())
 	route.Handle("AUTHENTICATE", crpc.authenticate)
+	route.Handle("STATUS", RequiredPermissions("SYSTEM.STATUS"), crpc.status)
 
 	return nil
 }
 
+func (crpc *CoreRPC) status(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &StatusReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req StatusRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	election := crpc.system.GetElection()
+
+	resp.Replica = election.ID()
+	resp.IsLeader = election.IsLeader()
+	resp.Leader = election.Leader()
+}
+
 func (crpc *CoreRPC) authenticate(ctx *RPCContext) {
 
 	// Prepare response message
@@ -69,7 +92,7 @@ func (crpc *CoreRPC) authenticate(ctx *RPCContext) {
 	}
 
 	// Getting token's permissions
-	tokenInfo, err := system.tokenRPC.tokenManager.GetToken(claims.TokenID)
+	tokenInfo, err := getTokenSetting(claims)
 	if err != nil {
 		resp.Error = &core.Error{
 			Code:    44409,
@@ -0,0 +1,405 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultElectionLeaseTTL         = 10 * time.Second
+	DefaultElectionProvisionTimeout = 30 * time.Second
+	DefaultElectionProvisionBackoff = 500 * time.Millisecond
+)
+
+const (
+	electionBucket = "GVT_%s_ELECTION"
+	leaderKey      = "leader"
+)
+
+var (
+	ErrProvisionTimeout = errors.New("resource was not provisioned by leader in time")
+)
+
+// Leader describes replica which is the leader currently
+type Leader struct {
+	ID    string    `json:"id"`
+	Host  string    `json:"host"`
+	Since time.Time `json:"since"`
+}
+
+// Election elects a leader from dispatcher replicas by holding a lease in KV store. Only the leader
+// provisions streams and consumers, so replicas which start together don't race on creating them. Lease
+// will be expired if the leader was gone without resigning, then another replica takes over.
+type Election struct {
+	client           *core.Client
+	domain           string
+	enabled          bool
+	self             *Leader
+	kv               nats.KeyValue
+	leaseTTL         time.Duration
+	provisionTimeout time.Duration
+	leader           *Leader
+	rev              uint64 // Revision of lease if this replica is the leader
+	mutex            sync.RWMutex
+	provisionMutex   sync.Mutex
+	stop             chan struct{}
+	done             chan struct{}
+}
+
+// NewElection creates election for replicas. Replica is always the leader if election is disabled.
+func NewElection(client *core.Client, domain string, enabled bool) *Election {
+
+	id, _ := uuid.NewUUID()
+	host, _ := os.Hostname()
+
+	return &Election{
+		client:  client,
+		domain:  domain,
+		enabled: enabled,
+		self: &Leader{
+			ID:   id.String(),
+			Host: host,
+		},
+	}
+}
+
+// ID returns identity of replica
+func (e *Election) ID() string {
+	return e.self.ID
+}
+
+func (e *Election) IsLeader() bool {
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return e.leader != nil && e.leader.ID == e.self.ID
+}
+
+// Leader returns the current leader, it returns nil if there is no leader for now
+func (e *Election) Leader() *Leader {
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if e.leader == nil {
+		return nil
+	}
+
+	leader := *e.leader
+
+	return &leader
+}
+
+func (e *Election) Start() error {
+
+	viper.SetDefault("election.provision_timeout", DefaultElectionProvisionTimeout)
+
+	e.provisionTimeout = viper.GetDuration("election.provision_timeout")
+
+	// Single replica
+	if !e.enabled {
+		e.mutex.Lock()
+		e.self.Since = time.Now()
+		e.leader = e.self
+		e.mutex.Unlock()
+		return nil
+	}
+
+	err := e.initKV()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := e.kv.Watch(leaderKey)
+	if err != nil {
+		return err
+	}
+
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+
+	e.campaign()
+
+	go func() {
+
+		defer close(e.done)
+		defer watcher.Stop()
+
+		ticker := time.NewTicker(e.leaseTTL / 3)
+		defer ticker.Stop()
+
+		updates := watcher.Updates()
+
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+				e.campaign()
+			case entry, ok := <-updates:
+
+				// Watcher was closed, keep campaigning by ticker
+				if !ok {
+					updates = nil
+					continue
+				}
+
+				if entry == nil {
+					continue
+				}
+
+				// Leader resigned, take over immediately
+				if entry.Operation() != nats.KeyValuePut {
+					e.setLeader(nil)
+					e.campaign()
+					continue
+				}
+
+				var leader Leader
+				err := json.Unmarshal(entry.Value(), &leader)
+				if err != nil {
+					logger.Warn("Failed to parse leader",
+						zap.Error(err),
+					)
+					continue
+				}
+
+				e.setLeader(&leader)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop resigns leadership, so other replicas don't have to wait for lease to be expired
+func (e *Election) Stop() {
+
+	if e.stop == nil {
+		return
+	}
+
+	close(e.stop)
+	<-e.done
+	e.stop = nil
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.rev == 0 {
+		return
+	}
+
+	logger.Info("Resigning leadership",
+		zap.String("replica", e.self.ID),
+	)
+
+	err := e.kv.Delete(leaderKey, nats.LastRevision(e.rev))
+	if err != nil {
+		logger.Warn("Failed to resign leadership",
+			zap.String("replica", e.self.ID),
+			zap.Error(err),
+		)
+	}
+
+	e.rev = 0
+	e.leader = nil
+}
+
+func (e *Election) initKV() error {
+
+	viper.SetDefault("election.lease_ttl", DefaultElectionLeaseTTL)
+
+	leaseTTL := viper.GetDuration("election.lease_ttl")
+
+	js, err := e.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	bucket := fmt.Sprintf(electionBucket, e.domain)
+
+	kv, err := js.KeyValue(bucket)
+	if err != nil {
+		if err != nats.ErrBucketNotFound {
+			return err
+		}
+
+		// Lease expires if the leader didn't renew it in time
+		cfg := &nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Gravity dispatcher leader election",
+			History:     1,
+			TTL:         leaseTTL,
+			Replicas:    3,
+		}
+
+		kv, err = js.CreateKeyValue(cfg)
+		if err != nil {
+
+			// for single node
+			cfg.Replicas = 1
+			kv, err = js.CreateKeyValue(cfg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// All replicas have to follow TTL of bucket
+	status, err := kv.Status()
+	if err != nil {
+		return err
+	}
+
+	e.kv = kv
+	e.leaseTTL = status.TTL()
+
+	logger.Info("Initialized election",
+		zap.String("replica", e.self.ID),
+		zap.String("bucket", bucket),
+		zap.Duration("lease_ttl", e.leaseTTL),
+	)
+
+	return nil
+}
+
+func (e *Election) setLeader(leader *Leader) {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// Lease of this replica is still valid
+	if e.rev != 0 {
+		return
+	}
+
+	e.leader = leader
+}
+
+// campaign renews lease if this replica is the leader, or attempts to be the leader if there is no leader
+func (e *Election) campaign() {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// Renew lease
+	if e.rev != 0 {
+
+		data, _ := json.Marshal(e.self)
+
+		rev, err := e.kv.Update(leaderKey, data, e.rev)
+		if err == nil {
+			e.rev = rev
+			return
+		}
+
+		logger.Error("Lost leadership",
+			zap.String("replica", e.self.ID),
+			zap.Error(err),
+		)
+
+		e.rev = 0
+		e.leader = nil
+	}
+
+	// Lease is held by another replica already
+	self := *e.self
+	self.Since = time.Now()
+	data, _ := json.Marshal(&self)
+
+	rev, err := e.kv.Create(leaderKey, data)
+	if err != nil {
+
+		if e.leader == nil {
+			e.leader = e.getLeader()
+		}
+
+		return
+	}
+
+	e.self.Since = self.Since
+	e.rev = rev
+	e.leader = e.self
+
+	logger.Info("Became leader",
+		zap.String("replica", e.self.ID),
+		zap.String("host", e.self.Host),
+	)
+}
+
+func (e *Election) getLeader() *Leader {
+
+	entry, err := e.kv.Get(leaderKey)
+	if err != nil {
+		return nil
+	}
+
+	var leader Leader
+	err = json.Unmarshal(entry.Value(), &leader)
+	if err != nil {
+		return nil
+	}
+
+	return &leader
+}
+
+// Provision creates resource if it doesn't exist. Resource is created by the leader only, other replicas
+// wait for it to be created by the leader.
+func (e *Election) Provision(name string, check func() (bool, error), create func() error) error {
+
+	deadline := time.Now().Add(e.provisionTimeout)
+
+	for {
+
+		if e.IsLeader() {
+			return e.provision(check, create)
+		}
+
+		exists, err := check()
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s", ErrProvisionTimeout, name)
+		}
+
+		logger.Info("Waiting for leader to provision",
+			zap.String("resource", name),
+		)
+
+		time.Sleep(DefaultElectionProvisionBackoff)
+	}
+}
+
+func (e *Election) provision(check func() (bool, error), create func() error) error {
+
+	e.provisionMutex.Lock()
+	defer e.provisionMutex.Unlock()
+
+	exists, err := check()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	return create()
+}
@@ -0,0 +1,113 @@
+package system
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElection(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	client := sys.connector.GetClient()
+
+	viper.Set("election.lease_ttl", time.Second)
+	t.Cleanup(func() {
+		viper.Set("election.lease_ttl", DefaultElectionLeaseTTL)
+	})
+
+	// The first replica becomes the leader
+	e1 := NewElection(client, "election_test", true)
+	require.Nil(t, e1.Start())
+	t.Cleanup(e1.Stop)
+
+	e2 := NewElection(client, "election_test", true)
+	require.Nil(t, e2.Start())
+	t.Cleanup(e2.Stop)
+
+	assert.True(t, e1.IsLeader())
+	assert.False(t, e2.IsLeader())
+
+	require.Eventually(t, func() bool {
+		leader := e2.Leader()
+		return leader != nil && leader.ID == e1.ID()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Follower waits for resource which is created by the leader
+	var created atomic.Bool
+	var followerCreated atomic.Bool
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e2.Provision("test", func() (bool, error) {
+			return created.Load(), nil
+		}, func() error {
+			followerCreated.Store(true)
+			return nil
+		})
+	}()
+
+	err := e1.Provision("test", func() (bool, error) {
+		return created.Load(), nil
+	}, func() error {
+		created.Store(true)
+		return nil
+	})
+	require.Nil(t, err)
+
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Follower was not aware of provisioned resource")
+	}
+
+	assert.False(t, followerCreated.Load())
+
+	// Take over after the leader resigned
+	e1.Stop()
+
+	require.Eventually(t, func() bool {
+		return e2.IsLeader()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = e2.Provision("test2", func() (bool, error) {
+		return false, nil
+	}, func() error {
+		followerCreated.Store(true)
+		return nil
+	})
+	require.Nil(t, err)
+	assert.True(t, followerCreated.Load())
+}
+
+func TestElectionDisabled(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+
+	election := sys.GetElection()
+	assert.True(t, election.IsLeader())
+	assert.Equal(t, election.ID(), election.Leader().ID)
+}
+
+func TestStatus(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	nc := CreateTestConnection(t, sys)
+
+	coreAPI := fmt.Sprintf(core.CoreAPI, sys.connector.GetDomain())
+
+	var reply StatusReply
+	RequestTestAPIWithReply(t, nc, coreAPI+".STATUS", "", []byte(`{}`), &reply)
+	require.Nil(t, reply.Error)
+	assert.Equal(t, sys.GetElection().ID(), reply.Replica)
+	assert.True(t, reply.IsLeader)
+	require.NotNil(t, reply.Leader)
+	assert.Equal(t, reply.Replica, reply.Leader.ID)
+}
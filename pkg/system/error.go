@@ -1,6 +1,10 @@
 package system
 
-import "github.com/BrobridgeOrg/gravity-sdk/v2/core"
+import (
+	"strings"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+)
 
 type ErrorRPCState struct {
 	core.ErrorReply
@@ -13,6 +17,13 @@ func BadRequestErr() *core.Error {
 	}
 }
 
+func InvalidSettingErr() *core.Error {
+	return &core.Error{
+		Code:    44400,
+		Message: "Invalid product setting",
+	}
+}
+
 func InternalServerErr() *core.Error {
 	return &core.Error{
 		Code:    55000,
@@ -26,3 +37,17 @@ func ForbiddenErr() *core.Error {
 		Message: "Forbidden",
 	}
 }
+
+func PermissionDeniedErr(permissions []string) *core.Error {
+	return &core.Error{
+		Code:    44403,
+		Message: "Forbidden: requires one of permissions: " + strings.Join(permissions, ", "),
+	}
+}
+
+func AccessDeniedErr(productName string, right string) *core.Error {
+	return &core.Error{
+		Code:    44403,
+		Message: "Forbidden: no \"" + right + "\" right of product \"" + productName + "\"",
+	}
+}
@@ -0,0 +1,352 @@
+package system
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/token"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultIdentityProviderSubjectClaim = "sub"
+	DefaultIdentityProviderGroupsClaim  = "groups"
+	ExternalTokenPrefix                 = "idp:"
+)
+
+var (
+	ErrInvalidJWK     = errors.New("invalid JWK")
+	ErrUnknownKeyID   = errors.New("unknown key ID")
+	ErrInvalidIssuer  = errors.New("invalid issuer")
+	ErrInvalidSubject = errors.New("invalid subject")
+)
+
+// IdentityProvider trusts tokens which were issued by external identity provider
+type IdentityProvider struct {
+	Issuer       string
+	Audience     string
+	SubjectClaim string
+	GroupsClaim  string
+	Permissions  map[string][]string
+	keys         map[string]crypto.PublicKey
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []*jsonWebKey `json:"keys"`
+}
+
+func loadIdentityProvider() (*IdentityProvider, error) {
+
+	viper.SetDefault("auth.idp.subject_claim", DefaultIdentityProviderSubjectClaim)
+	viper.SetDefault("auth.idp.groups_claim", DefaultIdentityProviderGroupsClaim)
+
+	jwksFile := viper.GetString("auth.idp.jwks_file")
+	if len(jwksFile) == 0 {
+		return nil, nil
+	}
+
+	idp := &IdentityProvider{
+		Issuer:       viper.GetString("auth.idp.issuer"),
+		Audience:     viper.GetString("auth.idp.audience"),
+		SubjectClaim: viper.GetString("auth.idp.subject_claim"),
+		GroupsClaim:  viper.GetString("auth.idp.groups_claim"),
+		Permissions:  viper.GetStringMapStringSlice("auth.idp.permissions"),
+	}
+
+	if len(idp.Issuer) == 0 {
+		return nil, errors.New("issuer of identity provider is required")
+	}
+
+	data, err := os.ReadFile(jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	idp.keys, err = parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Trusting tokens from identity provider",
+		zap.String("issuer", idp.Issuer),
+		zap.Int("keys", len(idp.keys)),
+	)
+
+	return idp, nil
+}
+
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+
+	var jwks jsonWebKeySet
+	err := json.Unmarshal(data, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: key \"%s\": %v", ErrInvalidJWK, jwk.Kid, err)
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func (jwk *jsonWebKey) PublicKey() (crypto.PublicKey, error) {
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBase64URL(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBase64URL(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
+
+// IsTrusted returns true if token was issued by identity provider
+func (idp *IdentityProvider) IsTrusted(tokenString string) bool {
+
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(tokenString, claims)
+	if err != nil {
+		return false
+	}
+
+	iss, _ := claims["iss"].(string)
+
+	return iss == idp.Issuer
+}
+
+func (idp *IdentityProvider) verificationKey(token *jwt.Token) (interface{}, error) {
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := idp.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, kid)
+	}
+
+	// Algorithm must match type of key
+	switch key.(type) {
+	case *rsa.PublicKey:
+		_, ok = token.Method.(*jwt.SigningMethodRSA)
+	case *ecdsa.PublicKey:
+		_, ok = token.Method.(*jwt.SigningMethodECDSA)
+	case ed25519.PublicKey:
+		_, ok = token.Method.(*jwt.SigningMethodEd25519)
+	default:
+		ok = false
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
+	}
+
+	return key, nil
+}
+
+func (idp *IdentityProvider) Decode(tokenString string) (*Claims, error) {
+
+	mc := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, mc, idp.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if !mc.VerifyIssuer(idp.Issuer, true) {
+		return nil, ErrInvalidIssuer
+	}
+
+	if len(idp.Audience) > 0 && !mc.VerifyAudience(idp.Audience, true) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+
+	subject, _ := lookupClaim(mc, idp.SubjectClaim).(string)
+	if len(subject) == 0 {
+		return nil, ErrInvalidSubject
+	}
+
+	claims := &Claims{
+		TokenID:     ExternalTokenPrefix + subject,
+		External:    true,
+		Permissions: idp.mapPermissions(mc),
+	}
+
+	claims.Subject = subject
+	claims.Issuer = idp.Issuer
+	claims.Id, _ = mc["jti"].(string)
+
+	if exp, ok := mc["exp"].(float64); ok {
+		claims.ExpiresAt = int64(exp)
+	}
+
+	return claims, nil
+}
+
+// lookupClaim supports nested claim (e.g. "realm_access.roles")
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+
+	var cur interface{} = map[string]interface{}(claims)
+	for _, key := range strings.Split(path, ".") {
+
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		cur = m[key]
+	}
+
+	return cur
+}
+
+func (idp *IdentityProvider) mapPermissions(claims jwt.MapClaims) []string {
+
+	groups := make([]string, 0)
+	switch v := lookupClaim(claims, idp.GroupsClaim).(type) {
+	case string:
+		groups = append(groups, strings.Fields(v)...)
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+
+	perms := make(map[string]struct{})
+	for _, group := range groups {
+
+		// Keys of map from config file are case-insensitive
+		mapped, ok := idp.Permissions[group]
+		if !ok {
+			mapped = idp.Permissions[strings.ToLower(group)]
+		}
+
+		for _, perm := range mapped {
+
+			// Ignore unavailable permissions
+			if _, ok := availablePermissions[perm]; !ok {
+				continue
+			}
+
+			perms[perm] = struct{}{}
+		}
+	}
+
+	permissions := make([]string, 0, len(perms))
+	for perm := range perms {
+		permissions = append(permissions, perm)
+	}
+
+	return permissions
+}
+
+// getTokenSetting returns token setting for claims. Tokens from identity provider have no setting in store, so generate one.
+func getTokenSetting(claims *Claims) (*token.TokenSetting, error) {
+
+	if !claims.External {
+		return system.tokenRPC.tokenManager.GetToken(claims.TokenID)
+	}
+
+	ts := &token.TokenSetting{
+		ID:          claims.TokenID,
+		Description: "External token issued by " + claims.Issuer,
+		Enabled:     true,
+		Permissions: make(map[string]*token.Permission),
+		Subscription: &token.SubscriptionInfo{
+			Subscriptions: make(map[string]string),
+		},
+	}
+
+	for _, perm := range claims.Permissions {
+		ts.Permissions[perm] = &token.Permission{}
+	}
+
+	return ts, nil
+}
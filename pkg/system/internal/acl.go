@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/config_store"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/nats-io/nats.go"
+)
+
+// Rights which are able to be granted to tokens for specific product
+const (
+	ACLRightSubscribe = "subscribe"
+	ACLRightInfo      = "info"
+	ACLRightUpdate    = "update"
+	ACLRightPurge     = "purge"
+	ACLRightDelete    = "delete"
+	ACLRightSnapshot  = "snapshot"
+	ACLRightACL       = "acl"
+)
+
+var AvailableACLRights = map[string]string{
+	ACLRightSubscribe: "Subscribe to product",
+	ACLRightInfo:      "Get product information and dead-letter events",
+	ACLRightUpdate:    "Update product and replay dead-letter events",
+	ACLRightPurge:     "Purge product and dead-letter events",
+	ACLRightDelete:    "Delete product",
+	ACLRightSnapshot:  "Read snapshot of product",
+	ACLRightACL:       "Get and change ACL of product",
+}
+
+var (
+	ErrACLNotFound     = errors.New("acl not found")
+	ErrInvalidACLRight = errors.New("invalid acl right")
+)
+
+// ProductACL grants rights of specific product to tokens. Product without ACL is accessible to all tokens with global permissions.
+type ProductACL struct {
+	Product   string              `json:"product"`
+	Tokens    map[string][]string `json:"tokens"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+}
+
+func (acl *ProductACL) Allow(tokenID string, right string) bool {
+
+	rights, ok := acl.Tokens[tokenID]
+	if !ok {
+		return false
+	}
+
+	for _, r := range rights {
+		if r == right {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ACLManager struct {
+	client      *core.Client
+	configStore *config_store.ConfigStore
+}
+
+func NewACLManager(client *core.Client, domain string) *ACLManager {
+
+	am := &ACLManager{
+		client: client,
+	}
+
+	am.configStore = config_store.NewConfigStore(client,
+		config_store.WithDomain(domain),
+		config_store.WithCatalog("ACL"),
+	)
+
+	err := am.configStore.Init()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	return am
+}
+
+func (am *ACLManager) GetACL(productName string) (*ProductACL, error) {
+
+	kv, err := am.configStore.Get(productName)
+	if err != nil {
+		switch err {
+		case nats.ErrInvalidKey:
+			fallthrough
+		case nats.ErrKeyNotFound:
+			return nil, ErrACLNotFound
+		}
+
+		return nil, err
+	}
+
+	var acl ProductACL
+	err = json.Unmarshal(kv.Value(), &acl)
+	if err != nil {
+		return nil, err
+	}
+
+	if acl.Tokens == nil {
+		acl.Tokens = make(map[string][]string)
+	}
+
+	return &acl, nil
+}
+
+func (am *ACLManager) SetACL(productName string, acl *ProductACL) (*ProductACL, error) {
+
+	// Check rights
+	for _, rights := range acl.Tokens {
+		for _, r := range rights {
+			if _, ok := AvailableACLRights[r]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidACLRight, r)
+			}
+		}
+	}
+
+	acl.Product = productName
+	acl.UpdatedAt = time.Now()
+
+	data, _ := json.Marshal(acl)
+
+	// Write to KV store
+	_, err := am.configStore.Put(productName, data)
+	if err != nil {
+
+		switch err {
+		case nats.ErrInvalidKey:
+			return nil, ErrInvalidProductName
+		}
+
+		return nil, err
+	}
+
+	return acl, nil
+}
+
+func (am *ACLManager) DeleteACL(productName string) error {
+
+	err := am.configStore.Delete(productName)
+	if err != nil && err != nats.ErrKeyNotFound {
+		return err
+	}
+
+	return nil
+}
@@ -2,18 +2,34 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/BrobridgeOrg/gravity-sdk/v2/config_store"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
 	"github.com/nats-io/nats.go"
 )
 
+const (
+	DefaultConfigUpdateAttempts = 5
+)
+
+// MaxRevokedTokens limits size of revocation list, signing key should be rotated if it's full
+var MaxRevokedTokens = 10000
+
+var (
+	ErrRevocationListFull = errors.New("revocation list is full")
+)
+
 type ConfigManager struct {
 	client      *core.Client
 	configStore *config_store.ConfigStore
 
+	// Entries are updated by watcher of config store while RPC handlers are reading them
 	entries map[string]*ConfigEntry
+	mutex   sync.RWMutex
 }
 
 func NewConfigManager(client *core.Client, domain string) *ConfigManager {
@@ -42,7 +58,9 @@ func (cm *ConfigManager) updated(entry *config_store.ConfigEntry) {
 
 	switch entry.Operation {
 	case config_store.ConfigDelete:
+		cm.mutex.Lock()
 		delete(cm.entries, entry.Key)
+		cm.mutex.Unlock()
 	case config_store.ConfigUpdate:
 		fallthrough
 	case config_store.ConfigCreate:
@@ -65,9 +83,9 @@ func (cm *ConfigManager) updatedEntry(entry *config_store.ConfigEntry) error {
 			return err
 		}
 
-		cm.entries[entry.Key] = &ConfigEntry{
+		cm.setEntry(entry.Key, &ConfigEntry{
 			secret: &secret,
-		}
+		})
 	case "auth":
 
 		// Parsing
@@ -77,16 +95,39 @@ func (cm *ConfigManager) updatedEntry(entry *config_store.ConfigEntry) error {
 			return err
 		}
 
-		cm.entries[entry.Key] = &ConfigEntry{
+		cm.setEntry(entry.Key, &ConfigEntry{
 			auth: &auth,
+		})
+	case "revocation":
+
+		// Parsing
+		var revocation ConfigEntryRevocation
+		err := json.Unmarshal(entry.Value, &revocation)
+		if err != nil {
+			return err
 		}
+
+		cm.setEntry(entry.Key, &ConfigEntry{
+			revocation: &revocation,
+		})
 	}
 
 	return nil
 }
 
+func (cm *ConfigManager) setEntry(key string, entry *ConfigEntry) {
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	cm.entries[key] = entry
+}
+
 func (cm *ConfigManager) GetEntry(key string) *ConfigEntry {
 
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
 	if entry, ok := cm.entries[key]; ok {
 		return entry
 	}
@@ -101,19 +142,28 @@ func (cm *ConfigManager) InitializeEntry(key string, initialFn func() []byte) ([
 		return entry.Value(), nil
 	}
 
-	if err == nats.ErrKeyNotFound {
-		value := initialFn()
-
-		// TODO: It should check revision of entry
-		_, err = cm.configStore.Put(key, value)
-		if err != nil {
-			return nil, err
-		}
+	if err != nats.ErrKeyNotFound {
+		return nil, err
+	}
 
+	// Create entry only if it doesn't exist, so all replicas share the same initial value
+	value := initialFn()
+	_, err = cm.configStore.Update(key, value, 0)
+	if err == nil {
 		return value, nil
 	}
 
-	return nil, err
+	if !errors.Is(err, nats.ErrKeyExists) {
+		return nil, err
+	}
+
+	// Entry was initialized by another instance
+	entry, err = cm.configStore.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.Value(), nil
 }
 
 func (cm *ConfigManager) SetEntry(key string, value []byte) error {
@@ -126,23 +176,165 @@ func (cm *ConfigManager) SetEntry(key string, value []byte) error {
 	return nil
 }
 
+// RotateSecret replaces current signing key with a new one. Previous key is still valid until grace period is over.
+func (cm *ConfigManager) RotateSecret(keyID string, key string, gracePeriod time.Duration) (*ConfigEntrySecret, error) {
+
+	entry, err := cm.configStore.Get("secret")
+	if err != nil {
+		return nil, err
+	}
+
+	var secret ConfigEntrySecret
+	err = json.Unmarshal(entry.Value(), &secret)
+	if err != nil {
+		return nil, err
+	}
+
+	secret.Rotate(keyID, key, gracePeriod, time.Now())
+
+	data, _ := json.Marshal(secret)
+
+	_, err = cm.configStore.Update("secret", data, entry.Revision())
+	if err != nil {
+		return nil, err
+	}
+
+	return &secret, nil
+}
+
+// RevokeToken adds specific JWT ID to revocation list. The record will be removed after the JWT expired.
+func (cm *ConfigManager) RevokeToken(jwtID string, expiresAt time.Time) error {
+
+	for attempt := 1; ; attempt++ {
+
+		err := cm.revokeToken(jwtID, expiresAt)
+
+		// Revocation list was updated by another request at the same time
+		if errors.Is(err, nats.ErrKeyExists) && attempt < DefaultConfigUpdateAttempts {
+			continue
+		}
+
+		return err
+	}
+}
+
+func (cm *ConfigManager) revokeToken(jwtID string, expiresAt time.Time) error {
+
+	entry, err := cm.configStore.Get("revocation")
+	if err != nil {
+		return err
+	}
+
+	var revocation ConfigEntryRevocation
+	err = json.Unmarshal(entry.Value(), &revocation)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if revocation.Tokens == nil {
+		revocation.Tokens = make(map[string]time.Time)
+	}
+
+	// Purge records of expired tokens
+	for id, exp := range revocation.Tokens {
+		if !exp.IsZero() && exp.Before(now) {
+			delete(revocation.Tokens, id)
+		}
+	}
+
+	// Tokens without expiration are kept forever
+	if _, ok := revocation.Tokens[jwtID]; !ok && len(revocation.Tokens) >= MaxRevokedTokens {
+		return ErrRevocationListFull
+	}
+
+	revocation.Tokens[jwtID] = expiresAt
+
+	data, _ := json.Marshal(revocation)
+
+	_, err = cm.configStore.Update("revocation", data, entry.Revision())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // Configuration entry interface
+type SigningKey struct {
+	ID        string    `json:"kid"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 type ConfigEntrySecret struct {
-	Key string `json:"key"`
+	Key          string        `json:"key"`
+	KeyID        string        `json:"kid,omitempty"`
+	PreviousKeys []*SigningKey `json:"previousKeys,omitempty"`
+}
+
+// GetKey returns signing key for specific key ID. Tokens which were issued before key rotation have no key ID.
+func (ces *ConfigEntrySecret) GetKey(keyID string, now time.Time) (string, bool) {
+
+	if keyID == ces.KeyID {
+		return ces.Key, true
+	}
+
+	for _, k := range ces.PreviousKeys {
+		if k.ID == keyID && now.Before(k.ExpiresAt) {
+			return k.Key, true
+		}
+	}
+
+	return "", false
+}
+
+func (ces *ConfigEntrySecret) Rotate(keyID string, key string, gracePeriod time.Duration, now time.Time) {
+
+	keys := make([]*SigningKey, 0, len(ces.PreviousKeys)+1)
+
+	// Current key is still available in grace period
+	keys = append(keys, &SigningKey{
+		ID:        ces.KeyID,
+		Key:       ces.Key,
+		ExpiresAt: now.Add(gracePeriod),
+	})
+
+	// Drop expired keys
+	for _, k := range ces.PreviousKeys {
+		if now.Before(k.ExpiresAt) {
+			keys = append(keys, k)
+		}
+	}
+
+	ces.Key = key
+	ces.KeyID = keyID
+	ces.PreviousKeys = keys
 }
 
 type ConfigEntryAuth struct {
 	Enabled bool `json:"enabled"`
 }
 
+type ConfigEntryRevocation struct {
+	Tokens map[string]time.Time `json:"tokens"`
+}
+
+func (cer *ConfigEntryRevocation) IsRevoked(jwtID string) bool {
+	_, ok := cer.Tokens[jwtID]
+	return ok
+}
+
 type IConfigEntry interface {
 	Secret() *ConfigEntrySecret
 	Auth() *ConfigEntryAuth
+	Revocation() *ConfigEntryRevocation
 }
 
 type ConfigEntry struct {
-	secret *ConfigEntrySecret
-	auth   *ConfigEntryAuth
+	secret     *ConfigEntrySecret
+	auth       *ConfigEntryAuth
+	revocation *ConfigEntryRevocation
 }
 
 func (ce *ConfigEntry) Secret() *ConfigEntrySecret {
@@ -152,3 +344,7 @@ func (ce *ConfigEntry) Secret() *ConfigEntrySecret {
 func (ce *ConfigEntry) Auth() *ConfigEntryAuth {
 	return ce.auth
 }
+
+func (ce *ConfigEntry) Revocation() *ConfigEntryRevocation {
+	return ce.revocation
+}
@@ -0,0 +1,283 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	deadLetterStream   = "GVT_%s_DLQ_%s"
+	domainEventSubject = "$GVT.%s.EVENT.%s"
+)
+
+const (
+	DefaultDeadLetterListCount = 100
+	MaxDeadLetterListCount     = 1000
+	DefaultDeadLetterListWait  = time.Second
+)
+
+// Headers of dead-letter message
+const (
+	deadLetterHeaderEvent     = "Gravity-Dlq-Event"
+	deadLetterHeaderRule      = "Gravity-Dlq-Rule"
+	deadLetterHeaderStage     = "Gravity-Dlq-Stage"
+	deadLetterHeaderError     = "Gravity-Dlq-Error"
+	deadLetterHeaderSourceSeq = "Gravity-Dlq-Source-Seq"
+	deadLetterHeaderTarget    = "Gravity-Dlq-Target"
+	deadLetterHeaderPrefix    = "Gravity-Dlq-"
+)
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead-letter event not found")
+)
+
+type DeadLetter struct {
+	Seq       uint64    `json:"seq"`
+	Event     string    `json:"event"`
+	Rule      string    `json:"rule"`
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error"`
+	SourceSeq uint64    `json:"sourceSeq"`
+	Raw       []byte    `json:"raw"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func parseDeadLetter(msg *nats.RawStreamMsg) *DeadLetter {
+
+	sourceSeq, _ := strconv.ParseUint(msg.Header.Get(deadLetterHeaderSourceSeq), 10, 64)
+
+	return &DeadLetter{
+		Seq:       msg.Sequence,
+		Event:     msg.Header.Get(deadLetterHeaderEvent),
+		Rule:      msg.Header.Get(deadLetterHeaderRule),
+		Stage:     msg.Header.Get(deadLetterHeaderStage),
+		Error:     msg.Header.Get(deadLetterHeaderError),
+		SourceSeq: sourceSeq,
+		Raw:       msg.Data,
+		CreatedAt: msg.Time,
+	}
+}
+
+func (pm *ProductManager) getDeadLetterStreamInfo(productName string) (*nats.StreamInfo, error) {
+
+	// Check whether specific product exist or not
+	_, err := pm.GetProduct(productName)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	streamName := fmt.Sprintf(deadLetterStream, pm.domain, productName)
+	info, err := js.StreamInfo(streamName)
+	if err != nil {
+		if err == nats.ErrStreamNotFound {
+			return nil, ErrEventStoreNotFound
+		}
+
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// ListDeadLetters returns events from specific sequence and the sequence of the next page, which is zero if
+// there is nothing left.
+func (pm *ProductManager) ListDeadLetters(productName string, startSeq uint64, count int) ([]*DeadLetter, uint64, uint64, error) {
+
+	info, err := pm.getDeadLetterStreamInfo(productName)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if count <= 0 {
+		count = DefaultDeadLetterListCount
+	} else if count > MaxDeadLetterListCount {
+		count = MaxDeadLetterListCount
+	}
+
+	if startSeq < info.State.FirstSeq {
+		startSeq = info.State.FirstSeq
+	}
+
+	deadLetters := make([]*DeadLetter, 0)
+	if info.State.Msgs == 0 || startSeq > info.State.LastSeq {
+		return deadLetters, info.State.Msgs, 0, nil
+	}
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// Ordered consumer skips deleted events, so it doesn't have to look up every sequence
+	sub, err := js.SubscribeSync("",
+		nats.BindStream(info.Config.Name),
+		nats.OrderedConsumer(),
+		nats.StartSequence(startSeq),
+	)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer sub.Unsubscribe()
+
+	var nextSeq uint64
+	for len(deadLetters) < count {
+
+		msg, err := sub.NextMsg(DefaultDeadLetterListWait)
+		if err != nil {
+			if err == nats.ErrTimeout {
+				break
+			}
+
+			return nil, 0, 0, err
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		deadLetters = append(deadLetters, parseDeadLetter(&nats.RawStreamMsg{
+			Subject:  msg.Subject,
+			Sequence: meta.Sequence.Stream,
+			Header:   msg.Header,
+			Data:     msg.Data,
+			Time:     meta.Timestamp,
+		}))
+
+		if meta.NumPending == 0 {
+			nextSeq = 0
+			break
+		}
+
+		nextSeq = meta.Sequence.Stream + 1
+	}
+
+	return deadLetters, info.State.Msgs, nextSeq, nil
+}
+
+func (pm *ProductManager) GetDeadLetter(productName string, seq uint64) (*DeadLetter, error) {
+
+	info, err := pm.getDeadLetterStreamInfo(productName)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := js.GetMsg(info.Config.Name, seq)
+	if err != nil {
+		if err == nats.ErrMsgNotFound {
+			return nil, ErrDeadLetterNotFound
+		}
+
+		return nil, err
+	}
+
+	return parseDeadLetter(msg), nil
+}
+
+func (pm *ProductManager) ReplayDeadLetters(productName string, seqs []uint64) (int, error) {
+
+	info, err := pm.getDeadLetterStreamInfo(productName)
+	if err != nil {
+		return 0, err
+	}
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return 0, err
+	}
+
+	// Replay all events if no sequence was specified
+	if len(seqs) == 0 {
+		seqs = make([]uint64, 0, info.State.Msgs)
+		for seq := info.State.FirstSeq; seq <= info.State.LastSeq && info.State.Msgs > 0; seq++ {
+			seqs = append(seqs, seq)
+		}
+	}
+
+	count := 0
+	for _, seq := range seqs {
+
+		msg, err := js.GetMsg(info.Config.Name, seq)
+		if err != nil {
+			if err == nats.ErrMsgNotFound {
+				continue
+			}
+
+			return count, err
+		}
+
+		dl := parseDeadLetter(msg)
+
+		// Re-drive event to domain stream for specific product
+		m := nats.NewMsg(fmt.Sprintf(domainEventSubject, pm.domain, dl.Event))
+		m.Data = dl.Raw
+
+		// Original headers such as trace context are kept, but failure details and message ID of dead-letter
+		// stream are not
+		for key, values := range msg.Header {
+			if strings.HasPrefix(key, deadLetterHeaderPrefix) || key == nats.MsgIdHdr {
+				continue
+			}
+
+			m.Header[key] = values
+		}
+
+		m.Header.Set(deadLetterHeaderTarget, productName)
+
+		_, err = js.PublishMsg(m)
+		if err != nil {
+			return count, err
+		}
+
+		err = js.DeleteMsg(info.Config.Name, seq)
+		if err != nil && err != nats.ErrMsgNotFound {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func (pm *ProductManager) PurgeDeadLetters(productName string, seqs []uint64) error {
+
+	info, err := pm.getDeadLetterStreamInfo(productName)
+	if err != nil {
+		return err
+	}
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	// Purge all events if no sequence was specified
+	if len(seqs) == 0 {
+		return js.PurgeStream(info.Config.Name)
+	}
+
+	for _, seq := range seqs {
+		err := js.DeleteMsg(info.Config.Name, seq)
+		if err != nil && err != nats.ErrMsgNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
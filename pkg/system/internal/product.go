@@ -7,6 +7,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dispatch_state"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/partitioning"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/config_store"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
@@ -14,8 +17,10 @@ import (
 )
 
 const (
-	productEventStream  = "GVT_%s_DP_%s"
-	productEventSubject = "$GVT.%s.DP.%s.%s.EVENT.>"
+	productEventStream     = "GVT_%s_DP_%s"
+	productEventSubject    = "$GVT.%s.DP.%s.%s.EVENT.>"
+	productStateBucket     = "GVT_%s_PRODUCT_STATE"
+	productPartitionBucket = "GVT_%s_PRODUCT_PARTITION"
 )
 
 var (
@@ -26,6 +31,12 @@ var (
 	ErrInvalidProductName    = errors.New("invalid product name")
 )
 
+// ProductState extends the product state of SDK with state of dispatcher
+type ProductState struct {
+	product.ProductState
+	Dispatch *dispatch_state.State `json:"dispatch,omitempty"`
+}
+
 type ProductManager struct {
 	client      *core.Client
 	domain      string
@@ -53,7 +64,7 @@ func NewProductManager(client *core.Client, domain string) *ProductManager {
 	return pm
 }
 
-func (pm *ProductManager) CreateProduct(productSetting *product.ProductSetting) (*product.ProductSetting, error) {
+func (pm *ProductManager) CreateProduct(productSetting *product_setting.ProductSetting) (*product_setting.ProductSetting, error) {
 
 	// Attempt to get product information
 	_, err := pm.configStore.Get(productSetting.Name)
@@ -98,10 +109,16 @@ func (pm *ProductManager) DeleteProduct(name string) error {
 		return err
 	}
 
+	// Snapshot views are useless now
+	err = pm.deleteSnapshotViews(name)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func (pm *ProductManager) UpdateProduct(name string, productSetting *product.ProductSetting) (*product.ProductSetting, error) {
+func (pm *ProductManager) UpdateProduct(name string, productSetting *product_setting.ProductSetting) (*product_setting.ProductSetting, error) {
 
 	// Check whether specific product exist or not
 	_, err := pm.GetProduct(name)
@@ -150,7 +167,7 @@ func (pm *ProductManager) PurgeProduct(name string) error {
 	return nil
 }
 
-func (pm *ProductManager) GetProduct(name string) (*product.ProductSetting, error) {
+func (pm *ProductManager) GetProduct(name string) (*product_setting.ProductSetting, error) {
 
 	// Attempt to get product information
 	kv, err := pm.configStore.Get(name)
@@ -166,7 +183,7 @@ func (pm *ProductManager) GetProduct(name string) (*product.ProductSetting, erro
 	}
 
 	// Parsing value
-	var productSetting product.ProductSetting
+	var productSetting product_setting.ProductSetting
 	err = json.Unmarshal(kv.Value(), &productSetting)
 	if err != nil {
 		return nil, err
@@ -175,7 +192,7 @@ func (pm *ProductManager) GetProduct(name string) (*product.ProductSetting, erro
 	return &productSetting, nil
 }
 
-func (pm *ProductManager) GetProductState(setting *product.ProductSetting) (*product.ProductState, error) {
+func (pm *ProductManager) GetProductState(setting *product_setting.ProductSetting) (*ProductState, error) {
 
 	js, err := pm.client.GetJetStream()
 	if err != nil {
@@ -188,17 +205,81 @@ func (pm *ProductManager) GetProductState(setting *product.ProductSetting) (*pro
 		return nil, ErrEventStoreNotFound
 	}
 
-	state := &product.ProductState{
-		EventCount: s.State.Msgs,
-		Bytes:      s.State.Bytes,
-		FirstTime:  s.State.FirstTime,
-		LastTime:   s.State.LastTime,
+	state := &ProductState{
+		ProductState: product.ProductState{
+			EventCount: s.State.Msgs,
+			Bytes:      s.State.Bytes,
+			FirstTime:  s.State.FirstTime,
+			LastTime:   s.State.LastTime,
+		},
+	}
+
+	// Dispatch state is available only after dispatcher started working on product
+	state.Dispatch, err = pm.getDispatchState(js, setting.Name)
+	if err != nil {
+		return nil, ErrInternalSystemFailure
 	}
 
 	return state, nil
 }
 
-func (pm *ProductManager) ListProducts() ([]*product.ProductSetting, error) {
+func (pm *ProductManager) getDispatchState(js nats.JetStreamContext, productName string) (*dispatch_state.State, error) {
+
+	kv, err := js.KeyValue(fmt.Sprintf(productStateBucket, pm.domain))
+	if err != nil {
+		if err == nats.ErrBucketNotFound {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	entry, err := kv.Get(productName)
+	if err != nil {
+		if err == nats.ErrKeyNotFound {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return dispatch_state.Unmarshal(entry.Value())
+}
+
+// GetPartitioning returns history of partitioning of product stream, it's empty if dispatcher never dispatched events
+func (pm *ProductManager) GetPartitioning(productName string) (*partitioning.History, error) {
+
+	history := &partitioning.History{
+		Ranges: make([]*partitioning.Range, 0),
+	}
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.KeyValue(fmt.Sprintf(productPartitionBucket, pm.domain))
+	if err != nil {
+		if err == nats.ErrBucketNotFound {
+			return history, nil
+		}
+
+		return nil, err
+	}
+
+	entry, err := kv.Get(productName)
+	if err != nil {
+		if err == nats.ErrKeyNotFound {
+			return history, nil
+		}
+
+		return nil, err
+	}
+
+	return partitioning.Unmarshal(entry.Value())
+}
+
+func (pm *ProductManager) ListProducts() ([]*product_setting.ProductSetting, error) {
 
 	// Getting all entries
 	keys, _ := pm.configStore.Keys()
@@ -215,10 +296,10 @@ func (pm *ProductManager) ListProducts() ([]*product.ProductSetting, error) {
 		entries[i] = entry
 	}
 
-	products := make([]*product.ProductSetting, len(entries))
+	products := make([]*product_setting.ProductSetting, len(entries))
 	for i, entry := range entries {
 
-		var p product.ProductSetting
+		var p product_setting.ProductSetting
 		err := json.Unmarshal(entry.Value(), &p)
 		if err != nil {
 			fmt.Printf("Product \"%s\" Invalid setting format\n", entry.Key())
@@ -283,6 +364,21 @@ func (pm *ProductManager) PrepareSubscription(productName string, durable string
 		return nil
 	}
 */
+// getProductStream returns the stream of product setting, or the default stream if it's not specified
+func (pm *ProductManager) getProductStream(productName string) (string, error) {
+
+	setting, err := pm.GetProduct(productName)
+	if err != nil && err != ErrProductNotFound {
+		return "", err
+	}
+
+	if setting != nil && len(setting.Stream) > 0 {
+		return setting.Stream, nil
+	}
+
+	return fmt.Sprintf(productEventStream, pm.domain, productName), nil
+}
+
 func (pm *ProductManager) InitConsumer(productName string, consumerName string, partitions []int, startSeq uint64) error {
 
 	js, err := pm.client.GetJetStream()
@@ -291,7 +387,11 @@ func (pm *ProductManager) InitConsumer(productName string, consumerName string,
 	}
 
 	// Check if the stream already exists
-	streamName := fmt.Sprintf(productEventStream, pm.domain, productName)
+	streamName, err := pm.getProductStream(productName)
+	if err != nil {
+		return err
+	}
+
 	_, err = js.StreamInfo(streamName)
 	if err != nil {
 		return err
@@ -324,7 +424,7 @@ func (pm *ProductManager) InitConsumer(productName string, consumerName string,
 		subject := fmt.Sprintf(productEventSubject, pm.domain, productName, "*")
 		cfg.FilterSubject = subject
 	} else {
-		subjects := make([]string, len(partitions))
+		subjects := make([]string, 0, len(partitions))
 		for _, partition := range partitions {
 			subject := fmt.Sprintf(productEventSubject, pm.domain, productName, strconv.Itoa(partition))
 			subjects = append(subjects, subject)
@@ -355,7 +455,11 @@ func (pm *ProductManager) DeleteConsumer(productName string, consumerName string
 	}
 
 	// Check if the stream already exists
-	streamName := fmt.Sprintf(productEventStream, pm.domain, productName)
+	streamName, err := pm.getProductStream(productName)
+	if err != nil {
+		return err
+	}
+
 	_, err = js.StreamInfo(streamName)
 	if err != nil {
 		return err
@@ -363,8 +467,12 @@ func (pm *ProductManager) DeleteConsumer(productName string, consumerName string
 
 	// Check wheter consumer exist or not
 	_, err = js.ConsumerInfo(streamName, consumerName)
-	if err != nats.ErrConsumerNotFound {
-		return nil
+	if err != nil {
+		if err == nats.ErrConsumerNotFound {
+			return nil
+		}
+
+		return err
 	}
 
 	return js.DeleteConsumer(streamName, consumerName)
@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/config_store"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	revisionKey         = "%s.%d"
+	maxRevisionAttempts = 5
+)
+
+// Operations which created revisions
+const (
+	RevisionOpCreate   = "create"
+	RevisionOpUpdate   = "update"
+	RevisionOpDelete   = "delete"
+	RevisionOpRollback = "rollback"
+)
+
+// Types of setting changes
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrRevisionConflict = errors.New("revision was created by others at the same time")
+)
+
+// ProductRevision is a snapshot of product setting which was taken when product was changed.
+type ProductRevision struct {
+	Product   string                          `json:"product"`
+	Revision  uint64                          `json:"revision"`
+	Operation string                          `json:"operation"`         // create, update, delete or rollback
+	TokenID   string                          `json:"tokenID,omitempty"` // Token which made the change, it's empty if auth is disabled.
+	Source    uint64                          `json:"source,omitempty"`  // Revision which was restored by rollback.
+	Setting   *product_setting.ProductSetting `json:"setting,omitempty"`
+	CreatedAt time.Time                       `json:"createdAt"`
+}
+
+// SettingChange describes a difference between two product settings.
+type SettingChange struct {
+	Path string      `json:"path"` // Path of field (e.g. "rules.myRule.handler.script")
+	Type string      `json:"type"` // added, removed or changed
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// RevisionManager keeps history of product settings. Revisions are still available after product was deleted.
+type RevisionManager struct {
+	client      *core.Client
+	configStore *config_store.ConfigStore
+}
+
+func NewRevisionManager(client *core.Client, domain string) *RevisionManager {
+
+	rm := &RevisionManager{
+		client: client,
+	}
+
+	rm.configStore = config_store.NewConfigStore(client,
+		config_store.WithDomain(domain),
+		config_store.WithCatalog("PRODUCT_REVISION"),
+	)
+
+	err := rm.configStore.Init()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	return rm
+}
+
+// revisionNumbers returns numbers of revisions of product in ascending order
+func (rm *RevisionManager) revisionNumbers(productName string) ([]uint64, error) {
+
+	keys, err := rm.configStore.Keys()
+	if err != nil {
+		if err == nats.ErrNoKeysFound {
+			return []uint64{}, nil
+		}
+
+		return nil, err
+	}
+
+	prefix := productName + "."
+	revs := make([]uint64, 0)
+	for _, key := range keys {
+
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		rev, err := strconv.ParseUint(strings.TrimPrefix(key, prefix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		revs = append(revs, rev)
+	}
+
+	sort.Slice(revs, func(i, j int) bool {
+		return revs[i] < revs[j]
+	})
+
+	return revs, nil
+}
+
+// AddRevision stores a new revision of product with the next revision number
+func (rm *RevisionManager) AddRevision(rev *ProductRevision) (*ProductRevision, error) {
+
+	for i := 0; i < maxRevisionAttempts; i++ {
+
+		revs, err := rm.revisionNumbers(rev.Product)
+		if err != nil {
+			return nil, err
+		}
+
+		rev.Revision = 1
+		if len(revs) > 0 {
+			rev.Revision = revs[len(revs)-1] + 1
+		}
+
+		rev.CreatedAt = time.Now()
+
+		data, _ := json.Marshal(rev)
+
+		// Revision number might be taken by others, try the next one
+		_, err = rm.configStore.Update(fmt.Sprintf(revisionKey, rev.Product, rev.Revision), data, 0)
+		if err != nil {
+
+			if errors.Is(err, nats.ErrKeyExists) {
+				continue
+			}
+
+			if err == nats.ErrInvalidKey {
+				return nil, ErrInvalidProductName
+			}
+
+			return nil, err
+		}
+
+		return rev, nil
+	}
+
+	return nil, ErrRevisionConflict
+}
+
+func (rm *RevisionManager) GetRevision(productName string, revision uint64) (*ProductRevision, error) {
+
+	entry, err := rm.configStore.Get(fmt.Sprintf(revisionKey, productName, revision))
+	if err != nil {
+		switch err {
+		case nats.ErrInvalidKey:
+			fallthrough
+		case nats.ErrKeyNotFound:
+			return nil, ErrRevisionNotFound
+		}
+
+		return nil, err
+	}
+
+	var rev ProductRevision
+	err = json.Unmarshal(entry.Value(), &rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// ListRevisions returns revisions of product in ascending order
+func (rm *RevisionManager) ListRevisions(productName string) ([]*ProductRevision, error) {
+
+	revs, err := rm.revisionNumbers(productName)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*ProductRevision, 0, len(revs))
+	for _, r := range revs {
+
+		rev, err := rm.GetRevision(productName, r)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, nil
+}
+
+// DiffSettings returns changes from one setting to another. Timestamps of settings are ignored.
+func DiffSettings(from *product_setting.ProductSetting, to *product_setting.ProductSetting) ([]*SettingChange, error) {
+
+	a, err := settingToMap(from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := settingToMap(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*SettingChange, 0)
+	diffValue("", a, b, &changes)
+
+	return changes, nil
+}
+
+func settingToMap(setting *product_setting.ProductSetting) (map[string]interface{}, error) {
+
+	m := make(map[string]interface{})
+	if setting == nil {
+		return m, nil
+	}
+
+	data, err := json.Marshal(setting)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(m, "createdAt")
+	delete(m, "updatedAt")
+
+	return m, nil
+}
+
+func diffValue(path string, a interface{}, b interface{}, changes *[]*SettingChange) {
+
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+
+	// Values which are not objects are compared as a whole
+	if !aIsMap || !bIsMap {
+
+		if !reflect.DeepEqual(a, b) {
+			*changes = append(*changes, &SettingChange{
+				Path: path,
+				Type: ChangeChanged,
+				From: a,
+				To:   b,
+			})
+		}
+
+		return
+	}
+
+	keys := make([]string, 0, len(am)+len(bm))
+	for k := range am {
+		keys = append(keys, k)
+	}
+
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		p := k
+		if len(path) > 0 {
+			p = path + "." + k
+		}
+
+		av, aExists := am[k]
+		bv, bExists := bm[k]
+
+		switch {
+		case !aExists:
+			*changes = append(*changes, &SettingChange{Path: p, Type: ChangeAdded, To: bv})
+		case !bExists:
+			*changes = append(*changes, &SettingChange{Path: p, Type: ChangeRemoved, From: av})
+		default:
+			diffValue(p, av, bv, changes)
+		}
+	}
+}
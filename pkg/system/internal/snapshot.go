@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/snapshot_record"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	snapshotBucket = "GVT_%s_SS_%s"
+)
+
+const (
+	DefaultSnapshotListCount = 100
+)
+
+var (
+	ErrSnapshotNotFound       = errors.New("snapshot not found")
+	ErrSnapshotRecordNotFound = errors.New("snapshot record not found")
+)
+
+// SnapshotRecord is the latest state of a primary key
+type SnapshotRecord struct {
+	Key        string                 `json:"key"`
+	PrimaryKey []byte                 `json:"primaryKey"`
+	Event      string                 `json:"event"`
+	Method     string                 `json:"method"`
+	Payload    map[string]interface{} `json:"payload"`
+	Seq        uint64                 `json:"seq"`
+	Revision   uint64                 `json:"revision"`
+	UpdatedAt  time.Time              `json:"updatedAt"`
+}
+
+func parseSnapshotRecord(entry nats.KeyValueEntry) (*SnapshotRecord, error) {
+
+	sr, err := snapshot_record.Unmarshal(entry.Value())
+	if err != nil {
+		return nil, err
+	}
+
+	pe, err := sr.GetProductEvent()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := pe.GetContent()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnapshotRecord{
+		Key:        entry.Key(),
+		PrimaryKey: pe.PrimaryKey,
+		Event:      pe.EventName,
+		Method:     pe.Method.String(),
+		Payload:    r.AsMap(),
+		Seq:        sr.Seq,
+		Revision:   entry.Revision(),
+		UpdatedAt:  entry.Created(),
+	}, nil
+}
+
+func (pm *ProductManager) getSnapshotStore(productName string) (nats.KeyValue, error) {
+
+	// Check whether specific product exist or not
+	_, err := pm.GetProduct(productName)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.KeyValue(fmt.Sprintf(snapshotBucket, pm.domain, productName))
+	if err != nil {
+		if err == nats.ErrBucketNotFound {
+			return nil, ErrSnapshotNotFound
+		}
+
+		return nil, err
+	}
+
+	return kv, nil
+}
+
+// ListSnapshot returns records which are ordered by key. Records after specific key will be returned if it's not empty.
+func (pm *ProductManager) ListSnapshot(productName string, afterKey string, count int) ([]*SnapshotRecord, bool, error) {
+
+	kv, err := pm.getSnapshotStore(productName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if count <= 0 {
+		count = DefaultSnapshotListCount
+	}
+
+	records := make([]*SnapshotRecord, 0)
+
+	keys, err := kv.Keys()
+	if err != nil {
+		if err == nats.ErrNoKeysFound {
+			return records, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	sort.Strings(keys)
+
+	// Skip keys which were returned already
+	start := 0
+	if len(afterKey) > 0 {
+		start = sort.Search(len(keys), func(i int) bool {
+			return keys[i] > afterKey
+		})
+	}
+
+	i := start
+	for ; i < len(keys) && len(records) < count; i++ {
+
+		entry, err := kv.Get(keys[i])
+		if err != nil {
+			if err == nats.ErrKeyNotFound {
+				// Deleted already
+				continue
+			}
+
+			return nil, false, err
+		}
+
+		record, err := parseSnapshotRecord(entry)
+		if err != nil {
+			return nil, false, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, i < len(keys), nil
+}
+
+func (pm *ProductManager) GetSnapshotRecord(productName string, key string) (*SnapshotRecord, error) {
+
+	kv, err := pm.getSnapshotStore(productName)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := kv.Get(key)
+	if err != nil {
+		if err == nats.ErrKeyNotFound || err == nats.ErrInvalidKey {
+			return nil, ErrSnapshotRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return parseSnapshotRecord(entry)
+}
@@ -0,0 +1,342 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/snapshot_record"
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	snapshotConsumer    = "GVT_%s_SS_%s"
+	snapshotViewStream  = "GVT_%s_SV_%s"
+	snapshotViewSubject = "$GVT.%s.SS.%s.EVENT"
+)
+
+const (
+	DefaultSnapshotViewTTL = time.Hour
+)
+
+// Metadata of snapshot view stream
+const (
+	snapshotViewMetaProduct = "product"
+)
+
+// Headers of message in snapshot view
+const (
+	SnapshotViewHeaderSeq = "Gravity-Snapshot-Seq"
+	SnapshotViewHeaderKey = "Gravity-Snapshot-Key"
+)
+
+var (
+	ErrSnapshotNotReady = errors.New("snapshot is not ready")
+)
+
+// SnapshotView is a consistent copy of snapshot which reflects all events of product stream up to Seq.
+// Live events should be received from the next sequence after consuming all records of view.
+type SnapshotView struct {
+	ID        string    `json:"id"`
+	Product   string    `json:"product"`
+	Stream    string    `json:"stream"`
+	Subject   string    `json:"subject"`
+	Seq       uint64    `json:"seq"`
+	Count     int       `json:"count"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// CreateSnapshotView builds a consistent view of snapshot and writes records to a temporary stream.
+// Records of snapshot store are updated while scanning, so events in the range of scanning will be
+// replayed from product stream to make sure all records reflect the same sequence.
+func (pm *ProductManager) CreateSnapshotView(productName string, viewID string, ttl time.Duration) (*SnapshotView, error) {
+
+	kv, err := pm.getSnapshotStore(productName)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	// Snapshot consumes events from stream of product setting
+	streamName, err := pm.getProductStream(productName)
+	if err != nil {
+		return nil, err
+	}
+
+	consumerName := fmt.Sprintf(snapshotConsumer, pm.domain, productName)
+
+	// All events up to ack floor were applied to snapshot store already
+	ci, err := js.ConsumerInfo(streamName, consumerName)
+	if err != nil {
+		if err == nats.ErrConsumerNotFound {
+			return nil, ErrSnapshotNotReady
+		}
+
+		return nil, err
+	}
+
+	startSeq := ci.AckFloor.Stream
+
+	// Scanning snapshot store
+	records := make(map[string]*snapshot_record.Record)
+
+	keys, err := kv.Keys()
+	if err != nil && err != nats.ErrNoKeysFound {
+		return nil, err
+	}
+
+	for _, key := range keys {
+
+		entry, err := kv.Get(key)
+		if err != nil {
+			if err == nats.ErrKeyNotFound {
+				continue
+			}
+
+			return nil, err
+		}
+
+		r, err := snapshot_record.Unmarshal(entry.Value())
+		if err != nil {
+			return nil, err
+		}
+
+		records[key] = r
+	}
+
+	// Events which were applied while scanning must have been delivered
+	ci, err = js.ConsumerInfo(streamName, consumerName)
+	if err != nil {
+		return nil, err
+	}
+
+	endSeq := ci.Delivered.Stream
+	if endSeq < startSeq {
+		endSeq = startSeq
+	}
+
+	// Replay events to catch up with the end of scanning
+	err = pm.replaySnapshot(js, streamName, records, startSeq, endSeq)
+	if err != nil {
+		return nil, err
+	}
+
+	return pm.writeSnapshotView(js, productName, viewID, ttl, records, endSeq)
+}
+
+func (pm *ProductManager) replaySnapshot(js nats.JetStreamContext, streamName string, records map[string]*snapshot_record.Record, startSeq uint64, endSeq uint64) error {
+
+	if endSeq <= startSeq {
+		return nil
+	}
+
+	info, err := js.StreamInfo(streamName)
+	if err != nil {
+		return err
+	}
+
+	// Events are gone
+	if info.State.FirstSeq > startSeq+1 {
+		return ErrSnapshotNotReady
+	}
+
+	for seq := startSeq + 1; seq <= endSeq; seq++ {
+
+		msg, err := js.GetMsg(streamName, seq)
+		if err != nil {
+			if err == nats.ErrMsgNotFound {
+				continue
+			}
+
+			return err
+		}
+
+		var pe gravity_sdk_types_product_event.ProductEvent
+		err = gravity_sdk_types_product_event.Unmarshal(msg.Data, &pe)
+		if err != nil {
+			// Skipped by snapshot as well
+			continue
+		}
+
+		if pe.Method == gravity_sdk_types_product_event.Method_TRUNCATE {
+			for key, r := range records {
+				if r.Seq < seq {
+					delete(records, key)
+				}
+			}
+
+			continue
+		}
+
+		if len(pe.PrimaryKey) == 0 {
+			continue
+		}
+
+		key := snapshot_record.EncodeKey(pe.PrimaryKey)
+
+		// Record reflects this event already
+		orig := records[key]
+		if orig != nil && orig.Seq >= seq {
+			continue
+		}
+
+		r, err := snapshot_record.Apply(orig, &pe, seq)
+		if err != nil {
+			return err
+		}
+
+		if r == nil {
+			delete(records, key)
+			continue
+		}
+
+		records[key] = r
+	}
+
+	return nil
+}
+
+func (pm *ProductManager) writeSnapshotView(js nats.JetStreamContext, productName string, viewID string, ttl time.Duration, records map[string]*snapshot_record.Record, seq uint64) (*SnapshotView, error) {
+
+	if ttl <= 0 {
+		ttl = DefaultSnapshotViewTTL
+	}
+
+	view := &SnapshotView{
+		ID:        viewID,
+		Product:   productName,
+		Stream:    fmt.Sprintf(snapshotViewStream, pm.domain, viewID),
+		Subject:   fmt.Sprintf(snapshotViewSubject, pm.domain, viewID),
+		Seq:       seq,
+		Count:     len(records),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	// Replace old view
+	err := pm.DeleteSnapshotView(viewID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:        view.Stream,
+		Description: "Gravity product snapshot view",
+		Subjects: []string{
+			view.Subject,
+		},
+		Retention: nats.LimitsPolicy,
+		MaxAge:    ttl,
+		Replicas:  1,
+		Metadata: map[string]string{
+			snapshotViewMetaProduct: productName,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	seqStr := strconv.FormatUint(seq, 10)
+	for _, key := range keys {
+
+		pe, err := records[key].GetProductEvent()
+		if err != nil {
+			return nil, err
+		}
+
+		// Record in view contains the whole state
+		pe.Method = gravity_sdk_types_product_event.Method_INSERT
+
+		data, err := gravity_sdk_types_product_event.Marshal(pe)
+		if err != nil {
+			return nil, err
+		}
+
+		msg := nats.NewMsg(view.Subject)
+		msg.Data = data
+		msg.Header.Set(SnapshotViewHeaderSeq, seqStr)
+		msg.Header.Set(SnapshotViewHeaderKey, key)
+
+		_, err = js.PublishMsgAsync(msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(30 * time.Second):
+		return nil, errors.New("timeout while writing snapshot view")
+	}
+
+	// Make sure all records were written
+	info, err := js.StreamInfo(view.Stream)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.State.Msgs != uint64(view.Count) {
+		return nil, fmt.Errorf("snapshot view is incomplete: %d/%d records", info.State.Msgs, view.Count)
+	}
+
+	return view, nil
+}
+
+// DeleteSnapshotView deletes stream of snapshot view
+func (pm *ProductManager) DeleteSnapshotView(viewID string) error {
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	err = js.DeleteStream(fmt.Sprintf(snapshotViewStream, pm.domain, viewID))
+	if err != nil && err != nats.ErrStreamNotFound {
+		return err
+	}
+
+	return nil
+}
+
+// deleteSnapshotViews deletes all snapshot views which were created for specific product
+func (pm *ProductManager) deleteSnapshotViews(productName string) error {
+
+	js, err := pm.client.GetJetStream()
+	if err != nil {
+		return err
+	}
+
+	prefix := fmt.Sprintf(snapshotViewStream, pm.domain, "")
+
+	for info := range js.StreamsInfo() {
+
+		if !strings.HasPrefix(info.Config.Name, prefix) {
+			continue
+		}
+
+		if info.Config.Metadata[snapshotViewMetaProduct] != productName {
+			continue
+		}
+
+		err = js.DeleteStream(info.Config.Name)
+		if err != nil && err != nats.ErrStreamNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -3,9 +3,11 @@ package system
 import (
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/connector"
 	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/partitioning"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
 	"github.com/BrobridgeOrg/gravity-sdk/v2/subscription"
@@ -21,6 +23,8 @@ type ProductRPC struct {
 	connector           *connector.Connector
 	productManager      *internal.ProductManager
 	subscriptionManager *internal.SubscriptionManager
+	aclManager          *internal.ACLManager
+	revisionManager     *internal.RevisionManager
 }
 
 func NewProductRPC(s *System) *ProductRPC {
@@ -62,6 +66,30 @@ func (prpc *ProductRPC) initialize() error {
 
 	prpc.subscriptionManager = subscriptionManager
 
+	// Initialize ACL manager
+	aclManager := internal.NewACLManager(
+		prpc.connector.GetClient(),
+		prpc.connector.GetDomain(),
+	)
+
+	if aclManager == nil {
+		return errors.New("Failed to create ACL manager")
+	}
+
+	prpc.aclManager = aclManager
+
+	// Initialize revision manager
+	revisionManager := internal.NewRevisionManager(
+		prpc.connector.GetClient(),
+		prpc.connector.GetDomain(),
+	)
+
+	if revisionManager == nil {
+		return errors.New("Failed to create revision manager")
+	}
+
+	prpc.revisionManager = revisionManager
+
 	err := prpc.initializeAdminRPC()
 	if err != nil {
 		return err
@@ -92,6 +120,17 @@ func (prpc *ProductRPC) initializeAdminRPC() error {
 	route.Handle("INFO", RequiredPermissions("PRODUCT.INFO"), prpc.info)
 	route.Handle("PURGE", RequiredPermissions("PRODUCT.PURGE"), prpc.purge)
 	route.Handle("PREPARE_SUBSCRIPTION", RequiredPermissions("PRODUCT.SUBSCRIPTION"), prpc.prepareSubscription)
+	route.Handle("DLQ.LIST", RequiredPermissions("PRODUCT.INFO"), prpc.listDeadLetters)
+	route.Handle("DLQ.INFO", RequiredPermissions("PRODUCT.INFO"), prpc.infoDeadLetter)
+	route.Handle("DLQ.REPLAY", RequiredPermissions("PRODUCT.UPDATE"), prpc.replayDeadLetters)
+	route.Handle("DLQ.PURGE", RequiredPermissions("PRODUCT.PURGE"), prpc.purgeDeadLetters)
+	route.Handle("ACL.GET", RequiredPermissions("PRODUCT.ACL"), prpc.getACL)
+	route.Handle("ACL.SET", RequiredPermissions("PRODUCT.ACL"), prpc.setACL)
+	route.Handle("TEST_RULE", RequiredPermissions("PRODUCT.UPDATE"), prpc.testRule)
+	route.Handle("REVISION.LIST", RequiredPermissions("PRODUCT.INFO"), prpc.listRevisions)
+	route.Handle("REVISION.GET", RequiredPermissions("PRODUCT.INFO"), prpc.getRevision)
+	route.Handle("REVISION.DIFF", RequiredPermissions("PRODUCT.INFO"), prpc.diffRevisions)
+	route.Handle("REVISION.ROLLBACK", RequiredPermissions("PRODUCT.UPDATE"), prpc.rollbackProduct)
 
 	return nil
 }
@@ -108,6 +147,8 @@ func (prpc *ProductRPC) initializeRPC() error {
 	route.Use(RequiredAuth())
 	route.Handle("GET_SUBSCRIPTION", RequiredPermissions("PRODUCT.SUBSCRIPTION"), prpc.getSubscription)
 	route.Handle("DELETE_SUBSCRIPTION", RequiredPermissions("PRODUCT.SUBSCRIPTION"), prpc.deleteSubscription)
+	route.Handle("SNAPSHOT.LIST", RequiredPermissions("PRODUCT.SNAPSHOT.READ"), prpc.listSnapshot)
+	route.Handle("SNAPSHOT.GET", RequiredPermissions("PRODUCT.SNAPSHOT.READ"), prpc.getSnapshot)
 
 	return nil
 }
@@ -115,7 +156,7 @@ func (prpc *ProductRPC) initializeRPC() error {
 func (prpc *ProductRPC) list(ctx *RPCContext) {
 
 	// Prepare response message
-	resp := &product.ListProductsReply{}
+	resp := &ListProductsReply{}
 	ctx.Res.Data = resp
 
 	// Parsing request
@@ -135,9 +176,23 @@ func (prpc *ProductRPC) list(ctx *RPCContext) {
 		return
 	}
 
-	products := make([]*product.ProductInfo, 0)
+	tokenInfo := getTokenInfo(ctx)
+
+	products := make([]*ProductInfo, 0)
 	for _, setting := range settings {
 
+		// Only products which are accessible for token
+		allowed, err := prpc.verifyACL(tokenInfo, setting.Name, internal.ACLRightInfo)
+		if err != nil {
+			ctx.Res.Error = err
+			resp.Error = InternalServerErr()
+			return
+		}
+
+		if !allowed {
+			continue
+		}
+
 		// Getting product state
 		state, err := prpc.productManager.GetProductState(setting)
 		if err != nil {
@@ -145,7 +200,7 @@ func (prpc *ProductRPC) list(ctx *RPCContext) {
 			return
 		}
 
-		p := &product.ProductInfo{}
+		p := &ProductInfo{}
 		p.Setting = setting
 		p.State = state
 
@@ -158,11 +213,11 @@ func (prpc *ProductRPC) list(ctx *RPCContext) {
 func (prpc *ProductRPC) create(ctx *RPCContext) {
 
 	// Prepare response message
-	resp := &product.CreateProductReply{}
+	resp := &CreateProductReply{}
 	ctx.Res.Data = resp
 
 	// Parsing request
-	var req product.CreateProductRequest
+	var req CreateProductRequest
 	err := json.Unmarshal(ctx.Req.Data, &req)
 	if err != nil {
 		ctx.Res.Error = err
@@ -170,11 +225,18 @@ func (prpc *ProductRPC) create(ctx *RPCContext) {
 		return
 	}
 
-	if len(req.Setting.Stream) == 0 {
+	if req.Setting == nil || len(req.Setting.Stream) == 0 {
 		resp.Error = BadRequestErr()
 		return
 	}
 
+	// Validate setting before it's applied by dispatchers
+	if errs := validateProductSetting(req.Setting); len(errs) > 0 {
+		resp.Error = InvalidSettingErr()
+		resp.Errors = errs
+		return
+	}
+
 	// Create a new product
 	setting, err := prpc.productManager.CreateProduct(req.Setting)
 	if err != nil {
@@ -193,16 +255,17 @@ func (prpc *ProductRPC) create(ctx *RPCContext) {
 	}
 
 	resp.Setting = setting
+	resp.Revision = prpc.recordRevision(ctx, internal.RevisionOpCreate, setting.Name, setting, 0)
 }
 
 func (prpc *ProductRPC) update(ctx *RPCContext) {
 
 	// Prepare response message
-	resp := &product.UpdateProductReply{}
+	resp := &UpdateProductReply{}
 	ctx.Res.Data = resp
 
 	// Parsing request
-	var req product.UpdateProductRequest
+	var req UpdateProductRequest
 	err := json.Unmarshal(ctx.Req.Data, &req)
 	if err != nil {
 		ctx.Res.Error = err
@@ -210,6 +273,24 @@ func (prpc *ProductRPC) update(ctx *RPCContext) {
 		return
 	}
 
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Name, internal.ACLRightUpdate); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	if req.Setting == nil {
+		resp.Error = BadRequestErr()
+		return
+	}
+
+	// Validate setting before it's applied by dispatchers
+	if errs := validateProductSetting(req.Setting); len(errs) > 0 {
+		resp.Error = InvalidSettingErr()
+		resp.Errors = errs
+		return
+	}
+
 	// Update specific product
 	setting, err := prpc.productManager.UpdateProduct(req.Name, req.Setting)
 	if err != nil {
@@ -228,6 +309,7 @@ func (prpc *ProductRPC) update(ctx *RPCContext) {
 	}
 
 	resp.Setting = setting
+	resp.Revision = prpc.recordRevision(ctx, internal.RevisionOpUpdate, req.Name, setting, 0)
 }
 
 func (prpc *ProductRPC) delete(ctx *RPCContext) {
@@ -245,6 +327,12 @@ func (prpc *ProductRPC) delete(ctx *RPCContext) {
 		return
 	}
 
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Name, internal.ACLRightDelete); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
 	// Delete specific product
 	err = prpc.productManager.DeleteProduct(req.Name)
 	if err != nil {
@@ -261,12 +349,22 @@ func (prpc *ProductRPC) delete(ctx *RPCContext) {
 
 		return
 	}
+
+	prpc.recordRevision(ctx, internal.RevisionOpDelete, req.Name, nil, 0)
+
+	// ACL of product is useless now
+	err = prpc.aclManager.DeleteACL(req.Name)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
 }
 
 func (prpc *ProductRPC) info(ctx *RPCContext) {
 
 	// Prepare response message
-	resp := &product.InfoProductReply{}
+	resp := &InfoProductReply{}
 	ctx.Res.Data = resp
 
 	// Parsing request
@@ -278,6 +376,12 @@ func (prpc *ProductRPC) info(ctx *RPCContext) {
 		return
 	}
 
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Name, internal.ACLRightInfo); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
 	// Get information of specific product
 	setting, err := prpc.productManager.GetProduct(req.Name)
 	if err != nil {
@@ -322,6 +426,12 @@ func (prpc *ProductRPC) purge(ctx *RPCContext) {
 		return
 	}
 
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Name, internal.ACLRightPurge); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
 	// Purge specific product
 	err = prpc.productManager.PurgeProduct(req.Name)
 	if err != nil {
@@ -343,11 +453,11 @@ func (prpc *ProductRPC) purge(ctx *RPCContext) {
 func (prpc *ProductRPC) prepareSubscription(ctx *RPCContext) {
 
 	// Prepare response message
-	resp := &product.PrepareSubscriptionReply{}
+	resp := &PrepareSubscriptionReply{}
 	ctx.Res.Data = resp
 
 	// Parsing request
-	var req product.PrepareSubscriptionRequest
+	var req PrepareSubscriptionRequest
 	err := json.Unmarshal(ctx.Req.Data, &req)
 	if err != nil {
 		ctx.Res.Error = err
@@ -355,6 +465,12 @@ func (prpc *ProductRPC) prepareSubscription(ctx *RPCContext) {
 		return
 	}
 
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightSubscribe); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
 	// Getting token information
 	if ctx.Req.Header["tokenInfo"] == nil {
 		resp.Error = ForbiddenErr()
@@ -365,6 +481,17 @@ func (prpc *ProductRPC) prepareSubscription(ctx *RPCContext) {
 
 	//TODO: Check permission
 
+	// Partitions are selected by range
+	var partitions []int
+	if req.PartitionRange != nil {
+		var rErr *core.Error
+		partitions, rErr = prpc.getPartitionRange(ctx, req.Product, req.PartitionRange)
+		if rErr != nil {
+			resp.Error = rErr
+			return
+		}
+	}
+
 	var s *subscription.SubscriptionSetting
 
 	subscriptionID, err := tokenInfo.GetSubscriptionByProduct(req.Product)
@@ -387,6 +514,14 @@ func (prpc *ProductRPC) prepareSubscription(ctx *RPCContext) {
 			}
 		}
 
+		if partitions != nil {
+			for _, c := range s.Consumers {
+				if len(c.Partitions) == 0 {
+					c.Partitions = partitions
+				}
+			}
+		}
+
 		// Create subscription
 		_, err = prpc.subscriptionManager.CreateSubscription(subscriptionID, s)
 		if err != nil {
@@ -403,6 +538,15 @@ func (prpc *ProductRPC) prepareSubscription(ctx *RPCContext) {
 			resp.Error = InternalServerErr()
 			return
 		}
+
+		// Consumers of existing subscription can not be moved to another range
+		if partitions != nil && !isWithinPartitions(s.Consumers, partitions) {
+			resp.Error = &core.Error{
+				Code:    44409,
+				Message: "subscription exists with partitions out of range, it has to be deleted before changing range",
+			}
+			return
+		}
 	}
 
 	/*
@@ -415,6 +559,19 @@ func (prpc *ProductRPC) prepareSubscription(ctx *RPCContext) {
 		}
 	*/
 
+	resp.Subscription = subscriptionID
+
+	// Consumers will continue with live events after snapshot
+	if req.Snapshot {
+		view, viewErr := prpc.prepareSnapshotView(ctx, tokenInfo, req.Product, subscriptionID, s)
+		if viewErr != nil {
+			resp.Error = viewErr
+			return
+		}
+
+		resp.Snapshot = view
+	}
+
 	// Initializing consumers
 	for _, c := range s.Consumers {
 		consumerName := fmt.Sprintf("%s_%s", subscriptionID, c.Name)
@@ -426,6 +583,72 @@ func (prpc *ProductRPC) prepareSubscription(ctx *RPCContext) {
 		}
 	}
 
+	// Subscriber needs to know partitioning of events which were dispatched before repartitioning
+	history, err := prpc.productManager.GetPartitioning(req.Product)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	resp.Partitioning = history.Ranges
+}
+
+// isWithinPartitions returns true if consumers receive events of specific partitions only
+func isWithinPartitions(consumers []*subscription.ConsumerSetting, partitions []int) bool {
+
+	for _, c := range consumers {
+
+		// Consumer without partitions receives events of all partitions
+		if len(c.Partitions) == 0 {
+			return false
+		}
+
+		for _, partition := range c.Partitions {
+			if !slices.Contains(partitions, partition) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// getPartitionRange returns partitions in range, the range must be within partitions of product
+func (prpc *ProductRPC) getPartitionRange(ctx *RPCContext, productName string, r *PartitionRange) ([]int, *core.Error) {
+
+	setting, err := prpc.productManager.GetProduct(productName)
+	if err != nil {
+		ctx.Res.Error = err
+
+		if err == internal.ErrProductNotFound {
+			return nil, &core.Error{
+				Code:    44404,
+				Message: err.Error(),
+			}
+		}
+
+		return nil, InternalServerErr()
+	}
+
+	count := setting.Partitions
+	if count <= 0 {
+		count = partitioning.DefaultPartitions
+	}
+
+	if r.First < 0 || r.First > r.Last || r.Last >= count {
+		return nil, &core.Error{
+			Code:    44400,
+			Message: fmt.Sprintf("partition range must be within 0 and %d", count-1),
+		}
+	}
+
+	partitions := make([]int, 0, r.Last-r.First+1)
+	for i := r.First; i <= r.Last; i++ {
+		partitions = append(partitions, i)
+	}
+
+	return partitions, nil
 }
 
 func (prpc *ProductRPC) getSubscription(ctx *RPCContext) {
@@ -443,6 +666,12 @@ func (prpc *ProductRPC) getSubscription(ctx *RPCContext) {
 		return
 	}
 
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightSubscribe); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
 	// Getting token information
 	if ctx.Req.Header["tokenInfo"] == nil {
 		resp.Error = ForbiddenErr()
@@ -500,6 +729,12 @@ func (prpc *ProductRPC) deleteSubscription(ctx *RPCContext) {
 		return
 	}
 
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightSubscribe); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
 	// Getting token information
 	if ctx.Req.Header["tokenInfo"] == nil {
 		resp.Error = ForbiddenErr()
@@ -550,6 +785,14 @@ func (prpc *ProductRPC) deleteSubscription(ctx *RPCContext) {
 		}
 	}
 
+	// Delete snapshot view of subscription
+	err = prpc.productManager.DeleteSnapshotView(req.Subscription)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
 	// Delete subscription
 	err = prpc.subscriptionManager.DeleteSubscription(req.Subscription)
 	if err != nil {
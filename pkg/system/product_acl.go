@@ -0,0 +1,192 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/token"
+)
+
+func getTokenInfo(ctx *RPCContext) *token.TokenSetting {
+
+	v, ok := ctx.Req.Header["tokenInfo"]
+	if !ok || v == nil {
+		return nil
+	}
+
+	return v.(*token.TokenSetting)
+}
+
+// verifyACL checks whether token has specific right of product or not
+func (prpc *ProductRPC) verifyACL(tokenInfo *token.TokenSetting, productName string, right string) (bool, error) {
+
+	// No token, auth is disabled
+	if tokenInfo == nil {
+		return true, nil
+	}
+
+	// Administrator is able to access all products
+	if tokenInfo.CheckPermission("ADMIN") {
+		return true, nil
+	}
+
+	acl, err := prpc.aclManager.GetACL(productName)
+	if err != nil {
+
+		// Product without ACL is accessible for all tokens
+		if err == internal.ErrACLNotFound {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return acl.Allow(tokenInfo.ID, right), nil
+}
+
+// checkACL returns an error if token of request doesn't have specific right of product
+func (prpc *ProductRPC) checkACL(ctx *RPCContext, productName string, right string) *core.Error {
+
+	tokenInfo := getTokenInfo(ctx)
+
+	allowed, err := prpc.verifyACL(tokenInfo, productName, right)
+	if err != nil {
+		ctx.Res.Error = err
+		return InternalServerErr()
+	}
+
+	if allowed {
+		return nil
+	}
+
+	ctx.Res.Error = fmt.Errorf("Forbidden: token \"%s\" has no \"%s\" right of product \"%s\"", tokenInfo.ID, right, productName)
+
+	return AccessDeniedErr(productName, right)
+}
+
+func (prpc *ProductRPC) getACL(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &GetProductACLReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req GetProductACLRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightACL); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	// Check whether specific product exist or not
+	_, err = prpc.productManager.GetProduct(req.Product)
+	if err != nil {
+		ctx.Res.Error = err
+
+		if err == internal.ErrProductNotFound {
+			resp.Error = &core.Error{
+				Code:    44404,
+				Message: err.Error(),
+			}
+		} else {
+			resp.Error = InternalServerErr()
+		}
+
+		return
+	}
+
+	acl, err := prpc.aclManager.GetACL(req.Product)
+	if err != nil {
+
+		if err != internal.ErrACLNotFound {
+			ctx.Res.Error = err
+			resp.Error = InternalServerErr()
+			return
+		}
+
+		// Empty ACL
+		acl = &internal.ProductACL{
+			Product: req.Product,
+			Tokens:  make(map[string][]string),
+		}
+	}
+
+	resp.ACL = acl
+}
+
+func (prpc *ProductRPC) setACL(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &SetProductACLReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req SetProductACLRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Token is not able to grant itself rights of product which is protected by ACL
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightACL); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	// Check whether specific product exist or not
+	_, err = prpc.productManager.GetProduct(req.Product)
+	if err != nil {
+		ctx.Res.Error = err
+
+		if err == internal.ErrProductNotFound {
+			resp.Error = &core.Error{
+				Code:    44404,
+				Message: err.Error(),
+			}
+		} else {
+			resp.Error = InternalServerErr()
+		}
+
+		return
+	}
+
+	// Remove ACL to make product accessible for all tokens
+	if req.ACL == nil {
+		err = prpc.aclManager.DeleteACL(req.Product)
+		if err != nil {
+			ctx.Res.Error = err
+			resp.Error = InternalServerErr()
+		}
+
+		return
+	}
+
+	acl, err := prpc.aclManager.SetACL(req.Product, req.ACL)
+	if err != nil {
+		ctx.Res.Error = err
+
+		if errors.Is(err, internal.ErrInvalidACLRight) {
+			resp.Error = &core.Error{
+				Code:    44400,
+				Message: err.Error(),
+			}
+		} else {
+			resp.Error = InternalServerErr()
+		}
+
+		return
+	}
+
+	resp.ACL = acl
+}
@@ -0,0 +1,131 @@
+package system
+
+import (
+	"fmt"
+	"testing"
+
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductACL(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	productAPI := fmt.Sprintf(product.ProductAPI, sys.connector.GetDomain())
+
+	CreateTestProduct(t, sys, "acl_a")
+	CreateTestProduct(t, sys, "acl_b")
+
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+	teamToken := CreateTestToken(t, sys, "team", "PRODUCT.LIST", "PRODUCT.INFO", "PRODUCT.PURGE", "PRODUCT.SUBSCRIPTION")
+	otherToken := CreateTestToken(t, sys, "other", "PRODUCT.LIST", "PRODUCT.INFO", "PRODUCT.PURGE", "PRODUCT.SUBSCRIPTION")
+
+	// Only administrator or token with PRODUCT.ACL permission is able to set ACL
+	reply := RequestTestAPI(t, nc, productAPI+".ACL.SET", teamToken, []byte(`{"product":"acl_a","acl":{"tokens":{"team":["info"]}}}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+
+	// Invalid right
+	reply = RequestTestAPI(t, nc, productAPI+".ACL.SET", adminToken, []byte(`{"product":"acl_a","acl":{"tokens":{"team":["write"]}}}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44400, reply.Error.Code)
+
+	// Product doesn't exist
+	reply = RequestTestAPI(t, nc, productAPI+".ACL.SET", adminToken, []byte(`{"product":"acl_x","acl":{"tokens":{}}}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44404, reply.Error.Code)
+
+	reply = RequestTestAPI(t, nc, productAPI+".ACL.SET", adminToken, []byte(`{"product":"acl_a","acl":{"tokens":{"team":["info","subscribe"]}}}`))
+	require.Nil(t, reply.Error)
+
+	// Getting ACL
+	var aclReply GetProductACLReply
+	RequestTestAPIWithReply(t, nc, productAPI+".ACL.GET", adminToken, []byte(`{"product":"acl_a"}`), &aclReply)
+	require.Nil(t, aclReply.Error)
+	assert.Equal(t, []string{"info", "subscribe"}, aclReply.ACL.Tokens["team"])
+
+	testCases := []struct {
+		path    string
+		data    string
+		jwt     string
+		allowed bool
+	}{
+		{"INFO", `{"name":"acl_a"}`, teamToken, true},
+		{"INFO", `{"name":"acl_a"}`, otherToken, false},
+		{"INFO", `{"name":"acl_a"}`, adminToken, true},
+		{"INFO", `{"name":"acl_b"}`, otherToken, true},
+		{"PURGE", `{"name":"acl_a"}`, teamToken, false},
+		{"PURGE", `{"name":"acl_b"}`, teamToken, true},
+		{"PREPARE_SUBSCRIPTION", `{"product":"acl_a"}`, otherToken, false},
+		{"DLQ.LIST", `{"product":"acl_a"}`, otherToken, false},
+	}
+
+	for _, tc := range testCases {
+		reply := RequestTestAPI(t, nc, productAPI+"."+tc.path, tc.jwt, []byte(tc.data))
+		if tc.allowed {
+			if reply.Error != nil {
+				assert.NotEqual(t, 44403, reply.Error.Code, tc.path)
+			}
+		} else if assert.NotNil(t, reply.Error, tc.path) {
+			assert.Equal(t, 44403, reply.Error.Code, tc.path)
+		}
+	}
+
+	// Token with PRODUCT.ACL permission is able to change ACL of product which grants "acl" right to it only
+	aclToken := CreateTestToken(t, sys, "acl_manager", "PRODUCT.ACL")
+
+	reply = RequestTestAPI(t, nc, productAPI+".ACL.SET", aclToken, []byte(`{"product":"acl_a","acl":{"tokens":{"acl_manager":["info","update","purge","acl"]}}}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+
+	reply = RequestTestAPI(t, nc, productAPI+".ACL.GET", aclToken, []byte(`{"product":"acl_a"}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+
+	reply = RequestTestAPI(t, nc, productAPI+".ACL.SET", adminToken, []byte(`{"product":"acl_a","acl":{"tokens":{"team":["info","subscribe"],"acl_manager":["acl"]}}}`))
+	require.Nil(t, reply.Error)
+
+	RequestTestAPIWithReply(t, nc, productAPI+".ACL.GET", aclToken, []byte(`{"product":"acl_a"}`), &aclReply)
+	require.Nil(t, aclReply.Error)
+	assert.Equal(t, []string{"acl"}, aclReply.ACL.Tokens["acl_manager"])
+
+	// Token with PRODUCT.DELETE permission is not able to delete product which is protected by ACL
+	deleteToken := CreateTestToken(t, sys, "deleter", "PRODUCT.DELETE")
+
+	reply = RequestTestAPI(t, nc, productAPI+".DELETE", deleteToken, []byte(`{"name":"acl_a"}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+
+	_, err := sys.productRPC.aclManager.GetACL("acl_a")
+	assert.Nil(t, err)
+
+	// Products are invisible for tokens without ACL
+	listProducts := func(jwt string) []string {
+
+		var reply ListProductsReply
+		RequestTestAPIWithReply(t, nc, productAPI+".LIST", jwt, []byte(`{}`), &reply)
+		require.Nil(t, reply.Error)
+
+		names := make([]string, 0)
+		for _, p := range reply.Products {
+			names = append(names, p.Setting.Name)
+		}
+
+		return names
+	}
+
+	assert.ElementsMatch(t, []string{"acl_a", "acl_b"}, listProducts(teamToken))
+	assert.ElementsMatch(t, []string{"acl_b"}, listProducts(otherToken))
+
+	// ACL will be removed with product
+	reply = RequestTestAPI(t, nc, productAPI+".DELETE", adminToken, []byte(`{"name":"acl_a"}`))
+	require.Nil(t, reply.Error)
+
+	_, err = sys.productRPC.aclManager.GetACL("acl_a")
+	assert.Equal(t, internal.ErrACLNotFound, err)
+}
@@ -0,0 +1,150 @@
+package system
+
+import (
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+)
+
+func deadLetterErr(err error) *core.Error {
+
+	switch err {
+	case internal.ErrProductNotFound:
+		fallthrough
+	case internal.ErrEventStoreNotFound:
+		fallthrough
+	case internal.ErrDeadLetterNotFound:
+		return &core.Error{
+			Code:    44404,
+			Message: err.Error(),
+		}
+	}
+
+	return InternalServerErr()
+}
+
+func (prpc *ProductRPC) listDeadLetters(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &ListDeadLettersReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req ListDeadLettersRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightInfo); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	// List events which were sent to dead-letter stream
+	deadLetters, total, nextSeq, err := prpc.productManager.ListDeadLetters(req.Product, req.StartSeq, req.Count)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = deadLetterErr(err)
+		return
+	}
+
+	resp.DeadLetters = deadLetters
+	resp.Total = total
+	resp.NextSeq = nextSeq
+}
+
+func (prpc *ProductRPC) infoDeadLetter(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &InfoDeadLetterReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req InfoDeadLetterRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightInfo); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	// Get specific dead-letter event
+	deadLetter, err := prpc.productManager.GetDeadLetter(req.Product, req.Seq)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = deadLetterErr(err)
+		return
+	}
+
+	resp.DeadLetter = deadLetter
+}
+
+func (prpc *ProductRPC) replayDeadLetters(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &ReplayDeadLettersReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req ReplayDeadLettersRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightUpdate); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	// Re-drive events to product
+	count, err := prpc.productManager.ReplayDeadLetters(req.Product, req.Seqs)
+	resp.Count = count
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = deadLetterErr(err)
+		return
+	}
+}
+
+func (prpc *ProductRPC) purgeDeadLetters(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &PurgeDeadLettersReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req PurgeDeadLettersRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightPurge); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	// Purge dead-letter events
+	err = prpc.productManager.PurgeDeadLetters(req.Product, req.Seqs)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = deadLetterErr(err)
+		return
+	}
+}
@@ -0,0 +1,134 @@
+package system
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterReplay(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	nc := CreateTestConnection(t, sys)
+
+	domain := sys.connector.GetDomain()
+	productAPI := fmt.Sprintf(product.ProductAPI, domain)
+
+	CreateTestProduct(t, sys, "dlq_a")
+
+	js, err := sys.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	// Domain stream and dead-letter stream which were created by dispatcher
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     fmt.Sprintf("GVT_%s", domain),
+		Subjects: []string{fmt.Sprintf("$GVT.%s.EVENT.*", domain)},
+	})
+	require.Nil(t, err)
+
+	dlqStream := fmt.Sprintf("GVT_%s_DLQ_dlq_a", domain)
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     dlqStream,
+		Subjects: []string{fmt.Sprintf("$GVT.%s.DLQ.dlq_a", domain)},
+	})
+	require.Nil(t, err)
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	msg := nats.NewMsg(fmt.Sprintf("$GVT.%s.DLQ.dlq_a", domain))
+	msg.Data = []byte(`{"event":"dataCreated","payload":"eyJpZCI6MTAxfQ=="}`)
+	msg.Header.Set("Gravity-Dlq-Event", "dataCreated")
+	msg.Header.Set("Gravity-Dlq-Rule", "testRule")
+	msg.Header.Set("Gravity-Dlq-Stage", "transform")
+	msg.Header.Set("Gravity-Dlq-Error", "failed")
+	msg.Header.Set("Gravity-Dlq-Source-Seq", "7")
+	msg.Header.Set("traceparent", traceparent)
+
+	_, err = js.PublishMsg(msg, nats.MsgId("7"))
+	require.Nil(t, err)
+
+	var reply ReplayDeadLettersReply
+	RequestTestAPIWithReply(t, nc, productAPI+".DLQ.REPLAY", "", []byte(`{"product":"dlq_a"}`), &reply)
+	require.Nil(t, reply.Error)
+	assert.Equal(t, 1, reply.Count)
+
+	// Event was re-driven to domain stream for the product
+	replayed, err := js.GetLastMsg(fmt.Sprintf("GVT_%s", domain), fmt.Sprintf("$GVT.%s.EVENT.dataCreated", domain))
+	require.Nil(t, err)
+	assert.Equal(t, msg.Data, replayed.Data)
+	assert.Equal(t, "dlq_a", replayed.Header.Get("Gravity-Dlq-Target"))
+	assert.Equal(t, traceparent, replayed.Header.Get("traceparent"))
+	assert.Empty(t, replayed.Header.Get("Gravity-Dlq-Error"))
+	assert.Empty(t, replayed.Header.Get(nats.MsgIdHdr))
+
+	// Replayed event was removed from dead-letter stream
+	info, err := js.StreamInfo(dlqStream)
+	require.Nil(t, err)
+	assert.Equal(t, uint64(0), info.State.Msgs)
+}
+
+func TestDeadLetterList(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	nc := CreateTestConnection(t, sys)
+
+	domain := sys.connector.GetDomain()
+	productAPI := fmt.Sprintf(product.ProductAPI, domain)
+
+	CreateTestProduct(t, sys, "dlq_list")
+
+	js, err := sys.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	dlqStream := fmt.Sprintf("GVT_%s_DLQ_dlq_list", domain)
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     dlqStream,
+		Subjects: []string{fmt.Sprintf("$GVT.%s.DLQ.dlq_list", domain)},
+	})
+	require.Nil(t, err)
+
+	for i := 1; i <= 6; i++ {
+		msg := nats.NewMsg(fmt.Sprintf("$GVT.%s.DLQ.dlq_list", domain))
+		msg.Data = []byte(`{}`)
+		msg.Header.Set("Gravity-Dlq-Event", "dataCreated")
+		msg.Header.Set("Gravity-Dlq-Source-Seq", fmt.Sprintf("%d", i))
+
+		_, err = js.PublishMsg(msg)
+		require.Nil(t, err)
+	}
+
+	// Gaps of replayed events are skipped
+	require.Nil(t, js.DeleteMsg(dlqStream, 2))
+	require.Nil(t, js.DeleteMsg(dlqStream, 3))
+
+	list := func(startSeq uint64, count int) ([]uint64, uint64) {
+
+		var reply ListDeadLettersReply
+		RequestTestAPIWithReply(t, nc, productAPI+".DLQ.LIST", "", []byte(fmt.Sprintf(`{"product":"dlq_list","startSeq":%d,"count":%d}`, startSeq, count)), &reply)
+		require.Nil(t, reply.Error)
+		assert.Equal(t, uint64(4), reply.Total)
+
+		seqs := make([]uint64, 0)
+		for _, dl := range reply.DeadLetters {
+			seqs = append(seqs, dl.Seq)
+		}
+
+		return seqs, reply.NextSeq
+	}
+
+	seqs, nextSeq := list(0, 2)
+	assert.Equal(t, []uint64{1, 4}, seqs)
+	assert.Equal(t, uint64(5), nextSeq)
+
+	seqs, nextSeq = list(nextSeq, 2)
+	assert.Equal(t, []uint64{5, 6}, seqs)
+	assert.Equal(t, uint64(0), nextSeq)
+
+	seqs, nextSeq = list(7, 2)
+	assert.Empty(t, seqs)
+	assert.Equal(t, uint64(0), nextSeq)
+}
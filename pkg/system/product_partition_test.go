@@ -0,0 +1,144 @@
+package system
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/partitioning"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/token"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductPartitioningValidation(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	nc := CreateTestConnection(t, sys)
+
+	productAPI := fmt.Sprintf(product.ProductAPI, sys.connector.GetDomain())
+
+	cases := []struct {
+		setting string
+		field   string
+	}{
+		{`{"name":"partition_validation","stream":"partition_validation","partitions":-1}`, "partitions"},
+		{`{"name":"partition_validation","stream":"partition_validation","partitions":100000}`, "partitions"},
+		{`{"name":"partition_validation","stream":"partition_validation","partitionBy":"random"}`, "partitionBy"},
+		{`{"name":"partition_validation","stream":"partition_validation","partitionBy":"field"}`, "partitionField"},
+	}
+
+	for _, c := range cases {
+
+		var reply CreateProductReply
+		RequestTestAPIWithReply(t, nc, productAPI+".CREATE", "", []byte(`{"setting":`+c.setting+`}`), &reply)
+		require.NotNil(t, reply.Error, c.setting)
+		assert.Equal(t, 44400, reply.Error.Code)
+		require.Len(t, reply.Errors, 1, c.setting)
+		assert.Equal(t, c.field, reply.Errors[0].Field)
+	}
+
+	var reply CreateProductReply
+	RequestTestAPIWithReply(t, nc, productAPI+".CREATE", "", []byte(`{"setting":{"name":"partition_validation","stream":"partition_validation","partitions":8,"partitionBy":"field","partitionField":"region"}}`), &reply)
+	require.Nil(t, reply.Error)
+}
+
+func TestProductPartitionSubscription(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	domain := sys.connector.GetDomain()
+	productAPI := fmt.Sprintf(product.ProductAPI, domain)
+
+	setting := CreateTestProduct(t, sys, "partition_sub")
+	setting.Partitions = 8
+	_, err := sys.productRPC.productManager.UpdateProduct(setting.Name, setting)
+	require.Nil(t, err)
+
+	js, err := sys.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	// Partitioning history which was recorded by dispatcher
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket: fmt.Sprintf("GVT_%s_PRODUCT_PARTITION", domain),
+	})
+	require.Nil(t, err)
+
+	history := &partitioning.History{
+		Ranges: []*partitioning.Range{
+			{Partitions: 256, PartitionBy: partitioning.ByPrimaryKey, StartSeq: 1},
+			{Partitions: 8, PartitionBy: partitioning.ByPrimaryKey, StartSeq: 11},
+		},
+	}
+	data, err := history.Marshal()
+	require.Nil(t, err)
+	_, err = kv.Put("partition_sub", data)
+	require.Nil(t, err)
+
+	subscriberToken := CreateTestToken(t, sys, "subscriber", "PRODUCT.SUBSCRIPTION")
+
+	// Range is out of partitions of product
+	reply := RequestTestAPI(t, nc, productAPI+".PREPARE_SUBSCRIPTION", subscriberToken, []byte(`{"product":"partition_sub","partitionRange":{"first":4,"last":8}}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44400, reply.Error.Code)
+
+	reply = RequestTestAPI(t, nc, productAPI+".PREPARE_SUBSCRIPTION", subscriberToken, []byte(`{"product":"partition_sub","partitionRange":{"first":3,"last":2}}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44400, reply.Error.Code)
+
+	var prepareReply PrepareSubscriptionReply
+	RequestTestAPIWithReply(t, nc, productAPI+".PREPARE_SUBSCRIPTION", subscriberToken, []byte(`{"product":"partition_sub","partitionRange":{"first":4,"last":7}}`), &prepareReply)
+	require.Nil(t, prepareReply.Error)
+
+	require.Len(t, prepareReply.Partitioning, 2)
+	assert.Equal(t, 256, prepareReply.Partitioning[0].Partitions)
+	assert.Equal(t, 8, prepareReply.Partitioning[1].Partitions)
+	assert.Equal(t, uint64(11), prepareReply.Partitioning[1].StartSeq)
+
+	// Consumers only receive events of partitions in range
+	s, err := sys.productRPC.subscriptionManager.GetSubscription(prepareReply.Subscription)
+	require.Nil(t, err)
+	require.Len(t, s.Consumers, 1)
+	assert.Equal(t, []int{4, 5, 6, 7}, s.Consumers[0].Partitions)
+
+	ci, err := js.ConsumerInfo(setting.Stream, fmt.Sprintf("%s_%s", prepareReply.Subscription, s.Consumers[0].Name))
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{
+		fmt.Sprintf("$GVT.%s.DP.partition_sub.4.EVENT.>", domain),
+		fmt.Sprintf("$GVT.%s.DP.partition_sub.5.EVENT.>", domain),
+		fmt.Sprintf("$GVT.%s.DP.partition_sub.6.EVENT.>", domain),
+		fmt.Sprintf("$GVT.%s.DP.partition_sub.7.EVENT.>", domain),
+	}, ci.Config.FilterSubjects)
+
+	// Subscription of token is reused
+	subscriptionID := prepareReply.Subscription
+
+	tokenSetting, err := sys.tokenRPC.tokenManager.GetToken("subscriber")
+	require.Nil(t, err)
+
+	tokenSetting.Subscription = &token.SubscriptionInfo{
+		Subscriptions: map[string]string{
+			subscriptionID: "partition_sub",
+		},
+	}
+
+	_, err = sys.tokenRPC.tokenManager.UpdateToken("subscriber", tokenSetting)
+	require.Nil(t, err)
+
+	prepareReply = PrepareSubscriptionReply{}
+	RequestTestAPIWithReply(t, nc, productAPI+".PREPARE_SUBSCRIPTION", subscriberToken, []byte(`{"product":"partition_sub","partitionRange":{"first":4,"last":7}}`), &prepareReply)
+	require.Nil(t, prepareReply.Error)
+	assert.Equal(t, subscriptionID, prepareReply.Subscription)
+
+	// Existing consumers can not be moved to another range
+	reply = RequestTestAPI(t, nc, productAPI+".PREPARE_SUBSCRIPTION", subscriberToken, []byte(`{"product":"partition_sub","partitionRange":{"first":0,"last":3}}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44409, reply.Error.Code)
+
+	s, err = sys.productRPC.subscriptionManager.GetSubscription(subscriptionID)
+	require.Nil(t, err)
+	assert.Equal(t, []int{4, 5, 6, 7}, s.Consumers[0].Partitions)
+}
@@ -0,0 +1,267 @@
+package system
+
+import (
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"go.uber.org/zap"
+)
+
+// recordRevision keeps setting of product as a new revision, it returns zero if revision failed to be recorded
+func (prpc *ProductRPC) recordRevision(ctx *RPCContext, op string, productName string, setting *product_setting.ProductSetting, source uint64) uint64 {
+
+	rev := &internal.ProductRevision{
+		Product:   productName,
+		Operation: op,
+		Source:    source,
+		Setting:   setting,
+	}
+
+	// Token which made the change
+	tokenInfo := getTokenInfo(ctx)
+	if tokenInfo != nil {
+		rev.TokenID = tokenInfo.ID
+	}
+
+	// Product was changed already, so failure of history should not break the request
+	rev, err := prpc.revisionManager.AddRevision(rev)
+	if err != nil {
+		logger.Error("Failed to record revision of product",
+			zap.String("product", productName),
+			zap.String("operation", op),
+			zap.Error(err),
+		)
+
+		return 0
+	}
+
+	return rev.Revision
+}
+
+func (prpc *ProductRPC) getRevisionSetting(ctx *RPCContext, productName string, revision uint64) (*product_setting.ProductSetting, *core.Error) {
+
+	rev, err := prpc.revisionManager.GetRevision(productName, revision)
+	if err != nil {
+		ctx.Res.Error = err
+
+		if err == internal.ErrRevisionNotFound {
+			return nil, &core.Error{
+				Code:    44404,
+				Message: err.Error(),
+			}
+		}
+
+		return nil, InternalServerErr()
+	}
+
+	return rev.Setting, nil
+}
+
+func (prpc *ProductRPC) listRevisions(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &ListRevisionsReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req ListRevisionsRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightInfo); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	revisions, err := prpc.revisionManager.ListRevisions(req.Product)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Settings can be large, so only information of revisions will be returned
+	for _, rev := range revisions {
+		rev.Setting = nil
+	}
+
+	resp.Revisions = revisions
+}
+
+func (prpc *ProductRPC) getRevision(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &GetRevisionReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req GetRevisionRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightInfo); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	rev, err := prpc.revisionManager.GetRevision(req.Product, req.Revision)
+	if err != nil {
+		ctx.Res.Error = err
+
+		if err == internal.ErrRevisionNotFound {
+			resp.Error = &core.Error{
+				Code:    44404,
+				Message: err.Error(),
+			}
+		} else {
+			resp.Error = InternalServerErr()
+		}
+
+		return
+	}
+
+	resp.Revision = rev
+}
+
+func (prpc *ProductRPC) diffRevisions(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &DiffRevisionsReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req DiffRevisionsRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	if req.From == 0 {
+		resp.Error = BadRequestErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightInfo); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	from, rErr := prpc.getRevisionSetting(ctx, req.Product, req.From)
+	if rErr != nil {
+		resp.Error = rErr
+		return
+	}
+
+	// Compare with current setting of product by default
+	var to *product_setting.ProductSetting
+	if req.To == 0 {
+		to, err = prpc.productManager.GetProduct(req.Product)
+		if err != nil {
+			ctx.Res.Error = err
+
+			if err == internal.ErrProductNotFound {
+				resp.Error = &core.Error{
+					Code:    44404,
+					Message: err.Error(),
+				}
+			} else {
+				resp.Error = InternalServerErr()
+			}
+
+			return
+		}
+	} else {
+		to, rErr = prpc.getRevisionSetting(ctx, req.Product, req.To)
+		if rErr != nil {
+			resp.Error = rErr
+			return
+		}
+	}
+
+	changes, err := internal.DiffSettings(from, to)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	resp.Changes = changes
+}
+
+func (prpc *ProductRPC) rollbackProduct(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &RollbackProductReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req RollbackProductRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightUpdate); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	setting, rErr := prpc.getRevisionSetting(ctx, req.Product, req.Revision)
+	if rErr != nil {
+		resp.Error = rErr
+		return
+	}
+
+	// Nothing to restore for revision of deletion
+	if setting == nil {
+		resp.Error = &core.Error{
+			Code:    44400,
+			Message: "revision has no setting",
+		}
+		return
+	}
+
+	setting.Name = req.Product
+
+	// Implementation of dispatcher might be changed since the revision was created
+	if errs := validateProductSetting(setting); len(errs) > 0 {
+		resp.Error = InvalidSettingErr()
+		resp.Errors = errs
+		return
+	}
+
+	setting, err = prpc.productManager.UpdateProduct(req.Product, setting)
+	if err != nil {
+		ctx.Res.Error = err
+
+		if err == internal.ErrProductNotFound {
+			resp.Error = &core.Error{
+				Code:    44404,
+				Message: err.Error(),
+			}
+		} else {
+			resp.Error = InternalServerErr()
+		}
+
+		return
+	}
+
+	resp.Setting = setting
+	resp.Revision = prpc.recordRevision(ctx, internal.RevisionOpRollback, req.Product, setting, req.Revision)
+}
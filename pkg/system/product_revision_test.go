@@ -0,0 +1,130 @@
+package system
+
+import (
+	"fmt"
+	"testing"
+
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductRevisions(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	productAPI := fmt.Sprintf(product.ProductAPI, sys.connector.GetDomain())
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+	editorToken := CreateTestToken(t, sys, "editor", "PRODUCT.UPDATE", "PRODUCT.INFO")
+
+	// Revision 1
+	var createReply CreateProductReply
+	RequestTestAPIWithReply(t, nc, productAPI+".CREATE", adminToken, []byte(`{"setting":{
+		"name": "revision_test",
+		"stream": "revision_test",
+		"rules": { "r1": { "event": "dataCreated", "handler": { "type": "script", "script": "return source" } } }
+	}}`), &createReply)
+	require.Nil(t, createReply.Error)
+	assert.Equal(t, uint64(1), createReply.Revision)
+
+	// Revision 2
+	var updateReply UpdateProductReply
+	RequestTestAPIWithReply(t, nc, productAPI+".UPDATE", editorToken, []byte(`{"name":"revision_test","setting":{
+		"name": "revision_test",
+		"stream": "revision_test",
+		"desc": "changed",
+		"rules": { "r2": { "event": "dataUpdated", "handler": { "type": "script", "script": "return { id: source.id }" } } }
+	}}`), &updateReply)
+	require.Nil(t, updateReply.Error)
+	assert.Equal(t, uint64(2), updateReply.Revision)
+
+	// List revisions
+	var listReply ListRevisionsReply
+	RequestTestAPIWithReply(t, nc, productAPI+".REVISION.LIST", adminToken, []byte(`{"product":"revision_test"}`), &listReply)
+	require.Nil(t, listReply.Error)
+	require.Len(t, listReply.Revisions, 2)
+	assert.Equal(t, internal.RevisionOpCreate, listReply.Revisions[0].Operation)
+	assert.Equal(t, "admin", listReply.Revisions[0].TokenID)
+	assert.Equal(t, internal.RevisionOpUpdate, listReply.Revisions[1].Operation)
+	assert.Equal(t, "editor", listReply.Revisions[1].TokenID)
+	assert.Nil(t, listReply.Revisions[1].Setting)
+
+	// Get specific revision
+	var getReply GetRevisionReply
+	RequestTestAPIWithReply(t, nc, productAPI+".REVISION.GET", adminToken, []byte(`{"product":"revision_test","revision":1}`), &getReply)
+	require.Nil(t, getReply.Error)
+	require.NotNil(t, getReply.Revision.Setting)
+	assert.Contains(t, getReply.Revision.Setting.Rules, "r1")
+
+	// Diff between revisions
+	var diffReply DiffRevisionsReply
+	RequestTestAPIWithReply(t, nc, productAPI+".REVISION.DIFF", adminToken, []byte(`{"product":"revision_test","from":1,"to":2}`), &diffReply)
+	require.Nil(t, diffReply.Error)
+
+	changes := make(map[string]*internal.SettingChange)
+	for _, c := range diffReply.Changes {
+		changes[c.Path] = c
+	}
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, internal.ChangeChanged, changes["desc"].Type)
+	assert.Equal(t, "", changes["desc"].From)
+	assert.Equal(t, "changed", changes["desc"].To)
+	assert.Equal(t, internal.ChangeRemoved, changes["rules.r1"].Type)
+	assert.Equal(t, internal.ChangeAdded, changes["rules.r2"].Type)
+
+	// Diff with current setting
+	diffReply = DiffRevisionsReply{}
+	RequestTestAPIWithReply(t, nc, productAPI+".REVISION.DIFF", adminToken, []byte(`{"product":"revision_test","from":2}`), &diffReply)
+	require.Nil(t, diffReply.Error)
+	assert.Empty(t, diffReply.Changes)
+
+	// Rollback to the first revision
+	var rollbackReply RollbackProductReply
+	RequestTestAPIWithReply(t, nc, productAPI+".REVISION.ROLLBACK", editorToken, []byte(`{"product":"revision_test","revision":1}`), &rollbackReply)
+	require.Nil(t, rollbackReply.Error)
+	assert.Equal(t, uint64(3), rollbackReply.Revision)
+
+	current, err := sys.productRPC.productManager.GetProduct("revision_test")
+	require.Nil(t, err)
+	assert.Equal(t, "", current.Description)
+	assert.Contains(t, current.Rules, "r1")
+	assert.NotContains(t, current.Rules, "r2")
+
+	rev, err := sys.productRPC.revisionManager.GetRevision("revision_test", 3)
+	require.Nil(t, err)
+	assert.Equal(t, internal.RevisionOpRollback, rev.Operation)
+	assert.Equal(t, uint64(1), rev.Source)
+	assert.Equal(t, "editor", rev.TokenID)
+
+	// History is kept after product was deleted
+	reply := RequestTestAPI(t, nc, productAPI+".DELETE", adminToken, []byte(`{"name":"revision_test"}`))
+	require.Nil(t, reply.Error)
+
+	listReply = ListRevisionsReply{}
+	RequestTestAPIWithReply(t, nc, productAPI+".REVISION.LIST", adminToken, []byte(`{"product":"revision_test"}`), &listReply)
+	require.Nil(t, listReply.Error)
+	require.Len(t, listReply.Revisions, 4)
+	assert.Equal(t, internal.RevisionOpDelete, listReply.Revisions[3].Operation)
+
+	testCases := []struct {
+		api  string
+		data string
+		code int
+	}{
+		{"REVISION.GET", `{"product":"revision_test","revision":10}`, 44404},
+		{"REVISION.DIFF", `{"product":"revision_test","from":1}`, 44404},
+		{"REVISION.DIFF", `{"product":"revision_test","to":1}`, 44400},
+		{"REVISION.ROLLBACK", `{"product":"revision_test","revision":4}`, 44400},
+		{"REVISION.ROLLBACK", `{"product":"revision_test","revision":1}`, 44404},
+	}
+
+	for _, tc := range testCases {
+		reply := RequestTestAPI(t, nc, productAPI+"."+tc.api, adminToken, []byte(tc.data))
+		require.NotNil(t, reply.Error, tc.data)
+		assert.Equal(t, tc.code, reply.Error.Code, tc.data)
+	}
+}
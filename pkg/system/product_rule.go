@@ -0,0 +1,137 @@
+package system
+
+import (
+	"errors"
+
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dry_run"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+)
+
+var (
+	ErrRuleTesterNotAvailable = errors.New("rule tester is not available")
+	ErrRuleNotFound           = errors.New("rule not found")
+)
+
+// RuleTester processes sample events with rules of product without publishing
+type RuleTester interface {
+	TestRule(setting *product_setting.ProductSetting, events []*dry_run.Event) ([]*dry_run.Result, error)
+}
+
+// SetRuleTester registers the component which is able to process events for PRODUCT.TEST_RULE
+func (system *System) SetRuleTester(rt RuleTester) {
+	system.ruleTester = rt
+}
+
+// findRule returns rule by key of rules or name of rule
+func findRule(setting *product_setting.ProductSetting, name string) *product_setting.Rule {
+
+	if rule, ok := setting.Rules[name]; ok {
+		return rule
+	}
+
+	for _, rule := range setting.Rules {
+		if rule.Name == name {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+func (prpc *ProductRPC) testRule(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &TestRuleReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req TestRuleRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	if len(req.Product) == 0 || len(req.Events) == 0 || (req.Rule == nil && len(req.RuleName) == 0) {
+		resp.Error = BadRequestErr()
+		return
+	}
+
+	if prpc.system.ruleTester == nil {
+		ctx.Res.Error = ErrRuleTesterNotAvailable
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightUpdate); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	setting, err := prpc.productManager.GetProduct(req.Product)
+	if err != nil {
+
+		// Rule definition is able to be tested before product was created
+		if err != internal.ErrProductNotFound || req.Rule == nil {
+			ctx.Res.Error = err
+
+			if err == internal.ErrProductNotFound {
+				resp.Error = &core.Error{
+					Code:    44404,
+					Message: err.Error(),
+				}
+			} else {
+				resp.Error = InternalServerErr()
+			}
+
+			return
+		}
+
+		setting = product_setting.NewProductSetting()
+		setting.Name = req.Product
+	}
+
+	rule := req.Rule
+	if rule == nil {
+		rule = findRule(setting, req.RuleName)
+		if rule == nil {
+			ctx.Res.Error = ErrRuleNotFound
+			resp.Error = &core.Error{
+				Code:    44404,
+				Message: ErrRuleNotFound.Error(),
+			}
+			return
+		}
+	}
+
+	if len(rule.Product) == 0 {
+		rule.Product = setting.Name
+	}
+
+	// Only the rule to be tested will be applied
+	setting.Rules = map[string]*product_setting.Rule{
+		rule.Name: rule,
+	}
+
+	for _, e := range req.Events {
+		if len(e.Event) == 0 {
+			e.Event = rule.Event
+		}
+	}
+
+	results, err := prpc.system.ruleTester.TestRule(setting, req.Events)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = &core.Error{
+			Code:    44400,
+			Message: err.Error(),
+		}
+		return
+	}
+
+	resp.Results = results
+}
@@ -0,0 +1,114 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/dry_run"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRuleTester struct {
+	setting *product_setting.ProductSetting
+	events  []*dry_run.Event
+}
+
+func (rt *testRuleTester) TestRule(setting *product_setting.ProductSetting, events []*dry_run.Event) ([]*dry_run.Result, error) {
+
+	rt.setting = setting
+	rt.events = events
+
+	for _, rule := range setting.Rules {
+		if rule.Event == "invalid" {
+			return nil, errors.New("invalid rule")
+		}
+	}
+
+	results := make([]*dry_run.Result, 0, len(events))
+	for _, e := range events {
+		results = append(results, &dry_run.Result{
+			Event:   e.Event,
+			Matched: true,
+		})
+	}
+
+	return results, nil
+}
+
+func TestProductTestRule(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	nc := CreateTestConnection(t, sys)
+
+	productAPI := fmt.Sprintf(product.ProductAPI, sys.connector.GetDomain())
+
+	// Dispatcher is not ready
+	reply := RequestTestAPI(t, nc, productAPI+".TEST_RULE", "", []byte(`{"product":"rule_test","ruleName":"r1","events":[{"payload":{}}]}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 55000, reply.Error.Code)
+
+	rt := &testRuleTester{}
+	sys.SetRuleTester(rt)
+
+	// Preparing product with rules
+	setting := CreateTestProduct(t, sys, "rule_test")
+
+	r1 := product_setting.NewRule()
+	r1.Name = "r1"
+	r1.Event = "dataCreated"
+
+	r2 := product_setting.NewRule()
+	r2.Name = "r2"
+	r2.Event = "dataUpdated"
+
+	setting.Rules = map[string]*product_setting.Rule{
+		"rule1": r1,
+		"rule2": r2,
+	}
+
+	_, err := sys.productRPC.productManager.UpdateProduct(setting.Name, setting)
+	require.Nil(t, err)
+
+	// Existing rule
+	var testReply TestRuleReply
+	RequestTestAPIWithReply(t, nc, productAPI+".TEST_RULE", "", []byte(`{"product":"rule_test","ruleName":"r2","events":[{"payload":{"id":1}},{"event":"dataCreated","payload":{"id":2}}]}`), &testReply)
+	require.Nil(t, testReply.Error)
+	require.Len(t, testReply.Results, 2)
+
+	// Only the specific rule was tested, and event of rule is default
+	require.Len(t, rt.setting.Rules, 1)
+	assert.Equal(t, "r2", rt.setting.Rules["r2"].Name)
+	assert.Equal(t, "rule_test", rt.setting.Rules["r2"].Product)
+	assert.Equal(t, "dataUpdated", rt.events[0].Event)
+	assert.Equal(t, `{"id":1}`, string(rt.events[0].Payload))
+	assert.Equal(t, "dataCreated", rt.events[1].Event)
+
+	// Rule definition for product which doesn't exist yet
+	testReply = TestRuleReply{}
+	RequestTestAPIWithReply(t, nc, productAPI+".TEST_RULE", "", []byte(`{"product":"rule_new","rule":{"name":"draft","event":"dataDeleted"},"events":[{"payload":{"id":1}}]}`), &testReply)
+	require.Nil(t, testReply.Error)
+	require.Len(t, testReply.Results, 1)
+	assert.Equal(t, "rule_new", rt.setting.Name)
+	assert.Equal(t, "dataDeleted", rt.events[0].Event)
+
+	testCases := []struct {
+		data string
+		code int
+	}{
+		{`{"product":"rule_test","ruleName":"r3","events":[{"payload":{}}]}`, 44404},
+		{`{"product":"rule_x","ruleName":"r1","events":[{"payload":{}}]}`, 44404},
+		{`{"product":"rule_test","ruleName":"r1","events":[]}`, 44400},
+		{`{"product":"rule_test","events":[{"payload":{}}]}`, 44400},
+		{`{"product":"rule_test","rule":{"name":"bad","event":"invalid"},"events":[{"payload":{}}]}`, 44400},
+	}
+
+	for _, tc := range testCases {
+		reply := RequestTestAPI(t, nc, productAPI+".TEST_RULE", "", []byte(tc.data))
+		require.NotNil(t, reply.Error, tc.data)
+		assert.Equal(t, tc.code, reply.Error.Code, tc.data)
+	}
+}
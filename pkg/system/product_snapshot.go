@@ -0,0 +1,149 @@
+package system
+
+import (
+	"fmt"
+
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/subscription"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/token"
+	"github.com/spf13/viper"
+)
+
+func snapshotErr(err error) *core.Error {
+
+	switch err {
+	case internal.ErrProductNotFound:
+		fallthrough
+	case internal.ErrSnapshotNotFound:
+		fallthrough
+	case internal.ErrSnapshotRecordNotFound:
+		return &core.Error{
+			Code:    44404,
+			Message: err.Error(),
+		}
+	case internal.ErrSnapshotNotReady:
+		return &core.Error{
+			Code:    55503,
+			Message: err.Error(),
+		}
+	}
+
+	return InternalServerErr()
+}
+
+func (prpc *ProductRPC) listSnapshot(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &ListSnapshotReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req ListSnapshotRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightSnapshot); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	// Page through snapshot
+	records, hasMore, err := prpc.productManager.ListSnapshot(req.Product, req.AfterKey, req.Count)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = snapshotErr(err)
+		return
+	}
+
+	resp.Records = records
+	resp.HasMore = hasMore
+
+	if len(records) > 0 {
+		resp.LastKey = records[len(records)-1].Key
+	}
+}
+
+func (prpc *ProductRPC) getSnapshot(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &GetSnapshotReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req GetSnapshotRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, req.Product, internal.ACLRightSnapshot); aclErr != nil {
+		resp.Error = aclErr
+		return
+	}
+
+	// Get the latest state of specific key
+	record, err := prpc.productManager.GetSnapshotRecord(req.Product, req.Key)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = snapshotErr(err)
+		return
+	}
+
+	resp.Record = record
+}
+
+// prepareSnapshotView creates a snapshot view for subscription, then moves consumers of subscription to the next sequence after snapshot
+func (prpc *ProductRPC) prepareSnapshotView(ctx *RPCContext, tokenInfo *token.TokenSetting, productName string, subscriptionID string, s *subscription.SubscriptionSetting) (*internal.SnapshotView, *core.Error) {
+
+	// Reading snapshot requires additional permission
+	if !tokenInfo.CheckPermission("ADMIN") {
+		if _, ok := tokenInfo.Permissions["PRODUCT.SNAPSHOT.READ"]; !ok {
+			ctx.Res.Error = fmt.Errorf("Forbidden: token \"%s\" requires permission PRODUCT.SNAPSHOT.READ", tokenInfo.ID)
+			return nil, PermissionDeniedErr([]string{"PRODUCT.SNAPSHOT.READ"})
+		}
+	}
+
+	// Check ACL of product
+	if aclErr := prpc.checkACL(ctx, productName, internal.ACLRightSnapshot); aclErr != nil {
+		return nil, aclErr
+	}
+
+	viper.SetDefault("subscription.snapshot_view_ttl", internal.DefaultSnapshotViewTTL)
+
+	ttl := viper.GetDuration("subscription.snapshot_view_ttl")
+
+	view, err := prpc.productManager.CreateSnapshotView(productName, subscriptionID, ttl)
+	if err != nil {
+		ctx.Res.Error = err
+		return nil, snapshotErr(err)
+	}
+
+	// Existing consumers have to be recreated to start from the next sequence
+	for _, c := range s.Consumers {
+		consumerName := fmt.Sprintf("%s_%s", subscriptionID, c.Name)
+		err = prpc.productManager.DeleteConsumer(productName, consumerName)
+		if err != nil {
+			ctx.Res.Error = err
+			return nil, InternalServerErr()
+		}
+
+		c.StartFromSeq = view.Seq + 1
+	}
+
+	_, err = prpc.subscriptionManager.UpdateSubscription(subscriptionID, s)
+	if err != nil {
+		ctx.Res.Error = err
+		return nil, InternalServerErr()
+	}
+
+	return view, nil
+}
@@ -0,0 +1,333 @@
+package system
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/snapshot_record"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
+	record_type "github.com/BrobridgeOrg/gravity-sdk/v2/types/record"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func CreateTestProductEvent(t *testing.T, name string, method gravity_sdk_types_product_event.Method, pk string, payload map[string]interface{}) *gravity_sdk_types_product_event.ProductEvent {
+
+	r := record_type.NewRecord()
+	require.Nil(t, record_type.UnmarshalMapData(payload, r))
+
+	pe := &gravity_sdk_types_product_event.ProductEvent{
+		EventName:  "dataCreated",
+		Table:      name,
+		Method:     method,
+		PrimaryKey: []byte(pk),
+	}
+	require.Nil(t, pe.SetContent(r))
+
+	return pe
+}
+
+func PutTestSnapshotRecord(t *testing.T, kv nats.KeyValue, name string, pk string, payload map[string]interface{}, seq uint64) {
+
+	pe := CreateTestProductEvent(t, name, gravity_sdk_types_product_event.Method_INSERT, pk, payload)
+
+	r, err := snapshot_record.Apply(nil, pe, seq)
+	require.Nil(t, err)
+
+	data, err := r.Marshal()
+	require.Nil(t, err)
+
+	_, err = kv.Put(snapshot_record.EncodeKey([]byte(pk)), data)
+	require.Nil(t, err)
+}
+
+func CreateTestSnapshot(t *testing.T, sys *System, name string, records map[string]map[string]interface{}) nats.KeyValue {
+
+	js, err := sys.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket: fmt.Sprintf("GVT_%s_SS_%s", sys.connector.GetDomain(), name),
+	})
+	require.Nil(t, err)
+
+	for pk, payload := range records {
+		PutTestSnapshotRecord(t, kv, name, pk, payload, 0)
+	}
+
+	return kv
+}
+
+func TestProductSnapshot(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	productAPI := fmt.Sprintf(product.ProductAPI, sys.connector.GetDomain())
+
+	CreateTestProduct(t, sys, "ss_a")
+	CreateTestProduct(t, sys, "ss_b")
+	CreateTestSnapshot(t, sys, "ss_a", map[string]map[string]interface{}{
+		"1": {"name": "fred"},
+		"2": {"name": "armani"},
+		"3": {"name": "bob"},
+	})
+
+	readerToken := CreateTestToken(t, sys, "reader", "PRODUCT.SNAPSHOT.READ")
+	otherToken := CreateTestToken(t, sys, "other", "PRODUCT.SNAPSHOT.READ")
+
+	// Page through snapshot
+	names := make([]string, 0)
+	lastKey := ""
+	for i := 0; i < 3; i++ {
+
+		var listReply ListSnapshotReply
+		RequestTestAPIWithReply(t, nc, productAPI+".SNAPSHOT.LIST", readerToken, []byte(fmt.Sprintf(`{"product":"ss_a","afterKey":"%s","count":2}`, lastKey)), &listReply)
+		require.Nil(t, listReply.Error)
+
+		for _, r := range listReply.Records {
+			names = append(names, r.Payload["name"].(string))
+		}
+
+		lastKey = listReply.LastKey
+
+		if !listReply.HasMore {
+			break
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"fred", "armani", "bob"}, names)
+
+	// Fetch one key
+	var getReply GetSnapshotReply
+	key := base64.RawURLEncoding.EncodeToString([]byte("2"))
+	RequestTestAPIWithReply(t, nc, productAPI+".SNAPSHOT.GET", readerToken, []byte(fmt.Sprintf(`{"product":"ss_a","key":"%s"}`, key)), &getReply)
+	require.Nil(t, getReply.Error)
+	assert.Equal(t, key, getReply.Record.Key)
+	assert.Equal(t, []byte("2"), getReply.Record.PrimaryKey)
+	assert.Equal(t, "armani", getReply.Record.Payload["name"])
+	assert.Equal(t, "INSERT", getReply.Record.Method)
+
+	// Key doesn't exist
+	reply := RequestTestAPI(t, nc, productAPI+".SNAPSHOT.GET", readerToken, []byte(`{"product":"ss_a","key":"none"}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44404, reply.Error.Code)
+
+	// Snapshot wasn't enabled
+	reply = RequestTestAPI(t, nc, productAPI+".SNAPSHOT.LIST", readerToken, []byte(`{"product":"ss_b"}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44404, reply.Error.Code)
+
+	// Only token with snapshot right is able to read if ACL was set
+	_, err := sys.productRPC.aclManager.SetACL("ss_a", &internal.ProductACL{
+		Tokens: map[string][]string{
+			"reader": {"snapshot"},
+			"other":  {"info"},
+		},
+	})
+	require.Nil(t, err)
+
+	reply = RequestTestAPI(t, nc, productAPI+".SNAPSHOT.LIST", readerToken, []byte(`{"product":"ss_a"}`))
+	assert.Nil(t, reply.Error)
+
+	reply = RequestTestAPI(t, nc, productAPI+".SNAPSHOT.GET", otherToken, []byte(fmt.Sprintf(`{"product":"ss_a","key":"%s"}`, key)))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+}
+
+func TestProductSnapshotSubscription(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	domain := sys.connector.GetDomain()
+	productAPI := fmt.Sprintf(product.ProductAPI, domain)
+
+	setting := CreateTestProduct(t, sys, "ssv_a")
+
+	js, err := sys.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	// Product stream: seq 1-3 were applied to snapshot, seq 4-5 were delivered but not acked yet
+	events := []*gravity_sdk_types_product_event.ProductEvent{
+		CreateTestProductEvent(t, "ssv_a", gravity_sdk_types_product_event.Method_INSERT, "1", map[string]interface{}{"name": "fred"}),
+		CreateTestProductEvent(t, "ssv_a", gravity_sdk_types_product_event.Method_INSERT, "2", map[string]interface{}{"name": "armani"}),
+		CreateTestProductEvent(t, "ssv_a", gravity_sdk_types_product_event.Method_INSERT, "3", map[string]interface{}{"name": "bob"}),
+		CreateTestProductEvent(t, "ssv_a", gravity_sdk_types_product_event.Method_UPDATE, "1", map[string]interface{}{"name": "fredx"}),
+		CreateTestProductEvent(t, "ssv_a", gravity_sdk_types_product_event.Method_DELETE, "2", map[string]interface{}{}),
+	}
+
+	for _, pe := range events {
+		data, err := gravity_sdk_types_product_event.Marshal(pe)
+		require.Nil(t, err)
+
+		_, err = js.Publish(fmt.Sprintf("$GVT.%s.DP.ssv_a.0.EVENT.dataCreated", domain), data)
+		require.Nil(t, err)
+	}
+
+	kv := CreateTestSnapshot(t, sys, "ssv_a", map[string]map[string]interface{}{})
+	PutTestSnapshotRecord(t, kv, "ssv_a", "1", map[string]interface{}{"name": "fred"}, 1)
+	PutTestSnapshotRecord(t, kv, "ssv_a", "2", map[string]interface{}{"name": "armani"}, 2)
+	PutTestSnapshotRecord(t, kv, "ssv_a", "3", map[string]interface{}{"name": "bob"}, 3)
+
+	snapshotConsumer := fmt.Sprintf("GVT_%s_SS_ssv_a", domain)
+	_, err = js.AddConsumer(setting.Stream, &nats.ConsumerConfig{
+		Durable:   snapshotConsumer,
+		AckPolicy: nats.AckExplicitPolicy,
+	})
+	require.Nil(t, err)
+
+	sub, err := js.PullSubscribe("", snapshotConsumer, nats.Bind(setting.Stream, snapshotConsumer))
+	require.Nil(t, err)
+
+	msgs, err := sub.Fetch(len(events))
+	require.Nil(t, err)
+	require.Len(t, msgs, len(events))
+
+	for _, msg := range msgs[:3] {
+		require.Nil(t, msg.AckSync())
+	}
+
+	subscriberToken := CreateTestToken(t, sys, "subscriber", "PRODUCT.SUBSCRIPTION", "PRODUCT.SNAPSHOT.READ")
+	plainToken := CreateTestToken(t, sys, "plain", "PRODUCT.SUBSCRIPTION")
+
+	// Snapshot requires additional permission
+	reply := RequestTestAPI(t, nc, productAPI+".PREPARE_SUBSCRIPTION", plainToken, []byte(`{"product":"ssv_a","snapshot":true}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+
+	var prepareReply PrepareSubscriptionReply
+	RequestTestAPIWithReply(t, nc, productAPI+".PREPARE_SUBSCRIPTION", subscriberToken, []byte(`{"product":"ssv_a","snapshot":true}`), &prepareReply)
+	require.Nil(t, prepareReply.Error)
+	require.NotNil(t, prepareReply.Snapshot)
+	assert.Equal(t, uint64(5), prepareReply.Snapshot.Seq)
+	assert.Equal(t, 2, prepareReply.Snapshot.Count)
+
+	// Records of view reflect all events up to sequence of view
+	names := make([]string, 0)
+	for seq := uint64(1); seq <= uint64(prepareReply.Snapshot.Count); seq++ {
+
+		msg, err := js.GetMsg(prepareReply.Snapshot.Stream, seq)
+		require.Nil(t, err)
+		assert.Equal(t, "5", msg.Header.Get(internal.SnapshotViewHeaderSeq))
+
+		var pe gravity_sdk_types_product_event.ProductEvent
+		require.Nil(t, gravity_sdk_types_product_event.Unmarshal(msg.Data, &pe))
+		assert.Equal(t, gravity_sdk_types_product_event.Method_INSERT, pe.Method)
+
+		r, err := pe.GetContent()
+		require.Nil(t, err)
+
+		names = append(names, r.AsMap()["name"].(string))
+	}
+
+	assert.Equal(t, []string{"fredx", "bob"}, names)
+
+	// Live events start from the next sequence
+	s, err := sys.productRPC.subscriptionManager.GetSubscription(prepareReply.Subscription)
+	require.Nil(t, err)
+	require.NotEmpty(t, s.Consumers)
+
+	for _, c := range s.Consumers {
+		assert.Equal(t, uint64(6), c.StartFromSeq)
+
+		ci, err := js.ConsumerInfo(setting.Stream, fmt.Sprintf("%s_%s", prepareReply.Subscription, c.Name))
+		require.Nil(t, err)
+		assert.Equal(t, nats.DeliverByStartSequencePolicy, ci.Config.DeliverPolicy)
+		assert.Equal(t, uint64(6), ci.Config.OptStartSeq)
+	}
+}
+
+func TestProductSnapshotViewCleanup(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	domain := sys.connector.GetDomain()
+	productAPI := fmt.Sprintf(product.ProductAPI, domain)
+
+	js, err := sys.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	// Product with custom stream
+	setting := product_setting.NewProductSetting()
+	setting.Name = "ssv_b"
+	setting.Enabled = true
+	setting.Stream = fmt.Sprintf("GVT_%s_CUSTOM_ssv_b", domain)
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     setting.Stream,
+		Subjects: []string{fmt.Sprintf("$GVT.%s.DP.ssv_b.>", domain)},
+	})
+	require.Nil(t, err)
+
+	_, err = sys.productRPC.productManager.CreateProduct(setting)
+	require.Nil(t, err)
+
+	data, err := gravity_sdk_types_product_event.Marshal(CreateTestProductEvent(t, "ssv_b", gravity_sdk_types_product_event.Method_INSERT, "1", map[string]interface{}{"name": "fred"}))
+	require.Nil(t, err)
+
+	_, err = js.Publish(fmt.Sprintf("$GVT.%s.DP.ssv_b.0.EVENT.dataCreated", domain), data)
+	require.Nil(t, err)
+
+	kv := CreateTestSnapshot(t, sys, "ssv_b", map[string]map[string]interface{}{})
+	PutTestSnapshotRecord(t, kv, "ssv_b", "1", map[string]interface{}{"name": "fred"}, 1)
+
+	// Snapshot consumes events from custom stream
+	snapshotConsumer := fmt.Sprintf("GVT_%s_SS_ssv_b", domain)
+	_, err = js.AddConsumer(setting.Stream, &nats.ConsumerConfig{
+		Durable:   snapshotConsumer,
+		AckPolicy: nats.AckExplicitPolicy,
+	})
+	require.Nil(t, err)
+
+	sub, err := js.PullSubscribe("", snapshotConsumer, nats.Bind(setting.Stream, snapshotConsumer))
+	require.Nil(t, err)
+
+	msgs, err := sub.Fetch(1)
+	require.Nil(t, err)
+	require.Len(t, msgs, 1)
+	require.Nil(t, msgs[0].AckSync())
+
+	subscriberToken := CreateTestToken(t, sys, "subscriber", "PRODUCT.SUBSCRIPTION", "PRODUCT.SNAPSHOT.READ")
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+
+	var prepareReply PrepareSubscriptionReply
+	RequestTestAPIWithReply(t, nc, productAPI+".PREPARE_SUBSCRIPTION", subscriberToken, []byte(`{"product":"ssv_b","snapshot":true}`), &prepareReply)
+	require.Nil(t, prepareReply.Error)
+	require.NotNil(t, prepareReply.Snapshot)
+	assert.Equal(t, uint64(1), prepareReply.Snapshot.Seq)
+	assert.Equal(t, 1, prepareReply.Snapshot.Count)
+
+	// View is deleted with subscription
+	reply := RequestTestAPI(t, nc, productAPI+".DELETE_SUBSCRIPTION", adminToken, []byte(fmt.Sprintf(`{"product":"ssv_b","subscription":"%s"}`, prepareReply.Subscription)))
+	require.Nil(t, reply.Error)
+
+	_, err = js.StreamInfo(prepareReply.Snapshot.Stream)
+	assert.Equal(t, nats.ErrStreamNotFound, err)
+
+	// View is deleted with product
+	anotherToken := CreateTestToken(t, sys, "another", "PRODUCT.SUBSCRIPTION", "PRODUCT.SNAPSHOT.READ")
+
+	prepareReply = PrepareSubscriptionReply{}
+	RequestTestAPIWithReply(t, nc, productAPI+".PREPARE_SUBSCRIPTION", anotherToken, []byte(`{"product":"ssv_b","snapshot":true}`), &prepareReply)
+	require.Nil(t, prepareReply.Error)
+	require.NotNil(t, prepareReply.Snapshot)
+
+	_, err = js.StreamInfo(prepareReply.Snapshot.Stream)
+	require.Nil(t, err)
+
+	reply = RequestTestAPI(t, nc, productAPI+".DELETE", adminToken, []byte(`{"name":"ssv_b"}`))
+	require.Nil(t, reply.Error)
+
+	_, err = js.StreamInfo(prepareReply.Snapshot.Stream)
+	assert.Equal(t, nats.ErrStreamNotFound, err)
+}
@@ -0,0 +1,147 @@
+package system
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/dispatcher/rule_manager"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/partitioning"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
+	"github.com/BrobridgeOrg/schemer"
+)
+
+// Event name is a token of subject, so dots, wildcards and spaces are not allowed
+var eventNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// FieldError describes why a field of product setting is invalid
+type FieldError struct {
+	Field   string `json:"field"` // Path of field (e.g. "rules.myRule.handler")
+	Message string `json:"message"`
+}
+
+// validateProductSetting checks everything which is prepared by dispatcher when product is applied
+func validateProductSetting(setting *product_setting.ProductSetting) []*FieldError {
+
+	errs := make([]*FieldError, 0)
+
+	// Product schema
+	var schema *schemer.Schema
+	if setting.Schema != nil {
+		schema = schemer.NewSchema()
+		err := schemer.Unmarshal(setting.Schema, schema)
+		if err != nil {
+			errs = append(errs, &FieldError{Field: "schema", Message: err.Error()})
+			schema = nil
+		}
+	}
+
+	// Rules are checked in order to have stable results
+	keys := make([]string, 0, len(setting.Rules))
+	for key := range setting.Rules {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		errs = append(errs, validateRule("rules."+key, setting.Rules[key], schema)...)
+	}
+
+	return append(errs, validatePartitioning(setting)...)
+}
+
+func validatePartitioning(setting *product_setting.ProductSetting) []*FieldError {
+
+	errs := make([]*FieldError, 0)
+
+	if setting.Partitions < 0 || setting.Partitions > partitioning.MaxPartitions {
+		errs = append(errs, &FieldError{
+			Field:   "partitions",
+			Message: fmt.Sprintf("partitions must be between 0 and %d", partitioning.MaxPartitions),
+		})
+	}
+
+	switch setting.PartitionBy {
+	case "", partitioning.ByPrimaryKey, partitioning.ByRoundRobin, partitioning.BySingle:
+	case partitioning.ByField:
+		if len(setting.PartitionField) == 0 {
+			errs = append(errs, &FieldError{Field: "partitionField", Message: "partitionField is required"})
+		}
+	default:
+		errs = append(errs, &FieldError{
+			Field:   "partitionBy",
+			Message: fmt.Sprintf("invalid partitioning: %s", setting.PartitionBy),
+		})
+	}
+
+	return errs
+}
+
+func validateRule(path string, rule *product_setting.Rule, targetSchema *schemer.Schema) []*FieldError {
+
+	errs := make([]*FieldError, 0)
+	addErr := func(field string, message string) {
+		errs = append(errs, &FieldError{Field: path + "." + field, Message: message})
+	}
+
+	if rule == nil {
+		return append(errs, &FieldError{Field: path, Message: "rule is required"})
+	}
+
+	// Event name
+	if len(rule.Event) == 0 {
+		addErr("event", "event is required")
+	} else if !eventNamePattern.MatchString(rule.Event) {
+		addErr("event", fmt.Sprintf("invalid event name: %s", rule.Event))
+	}
+
+	// Method is case-insensitive and it is INSERT by default
+	if len(rule.Method) > 0 {
+		if _, ok := gravity_sdk_types_product_event.Method_value[strings.ToUpper(rule.Method)]; !ok {
+			addErr("method", fmt.Sprintf("invalid method: %s", rule.Method))
+		}
+	}
+
+	// Schema of source event
+	var schema *schemer.Schema
+	if rule.SchemaConfig != nil {
+		schema = schemer.NewSchema()
+		err := schemer.Unmarshal(rule.SchemaConfig, schema)
+		if err != nil {
+			addErr("schema", err.Error())
+			schema = nil
+		}
+	}
+
+	if rule.Filter != nil {
+		_, err := rule_manager.NewFilter(rule.Filter)
+		if err != nil {
+			addErr("filter", err.Error())
+		}
+	}
+
+	if rule.HandlerConfig != nil {
+		err := rule_manager.CheckHandlerConfig(rule.HandlerConfig)
+		if err != nil {
+			addErr("handler", err.Error())
+		}
+	}
+
+	// Primary keys must be defined in schema of output, which is product schema or schema of rule
+	if targetSchema == nil {
+		targetSchema = schema
+	}
+
+	if targetSchema != nil && len(targetSchema.Fields) > 0 {
+		for _, pk := range rule.PrimaryKey {
+			if targetSchema.GetDefinition(pk) == nil {
+				addErr("primaryKey", fmt.Sprintf("%s is not defined in schema", pk))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,86 @@
+package system
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductSettingValidation(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	nc := CreateTestConnection(t, sys)
+
+	productAPI := fmt.Sprintf(product.ProductAPI, sys.connector.GetDomain())
+
+	invalidSetting := `{
+		"name": "validation_test",
+		"stream": "validation_test",
+		"schema": { "id": { "type": "int" }, "name": { "type": "string" } },
+		"rules": {
+			"badEvent": { "event": "data.created", "method": "insert", "primaryKey": [ "id" ] },
+			"badMethod": { "event": "dataCreated", "method": "upsert" },
+			"badScript": { "event": "dataCreated", "handler": { "type": "script", "script": "return {" } },
+			"badHandler": { "event": "dataCreated", "handler": { "type": "unknown" } },
+			"badFilter": { "event": "dataCreated", "filter": { "conditions": [ { "field": "id", "operator": "like" } ] } },
+			"badPrimaryKey": { "event": "dataCreated", "primaryKey": [ "uid" ] },
+			"badSchema": { "event": "dataCreated", "schema": { "tags": { "type": "array" } } }
+		}
+	}`
+
+	// Creating product with invalid setting
+	var createReply CreateProductReply
+	RequestTestAPIWithReply(t, nc, productAPI+".CREATE", "", []byte(`{"setting":`+invalidSetting+`}`), &createReply)
+	require.NotNil(t, createReply.Error)
+	assert.Equal(t, 44400, createReply.Error.Code)
+
+	fields := make(map[string]string)
+	for _, e := range createReply.Errors {
+		fields[e.Field] = e.Message
+	}
+
+	assert.Len(t, fields, 7)
+	assert.Contains(t, fields["rules.badEvent.event"], "data.created")
+	assert.Contains(t, fields["rules.badMethod.method"], "upsert")
+	assert.Contains(t, fields["rules.badScript.handler"], "invalid script")
+	assert.Contains(t, fields["rules.badHandler.handler"], "invalid handler type")
+	assert.Contains(t, fields["rules.badFilter.filter"], "invalid filter operator")
+	assert.Contains(t, fields["rules.badPrimaryKey.primaryKey"], "uid")
+	assert.Contains(t, fields["rules.badSchema.schema"], "subtype")
+
+	// Nothing was written
+	_, err := sys.productRPC.productManager.GetProduct("validation_test")
+	assert.NotNil(t, err)
+
+	// Updating product with invalid setting
+	setting := CreateTestProduct(t, sys, "validation_test")
+
+	var updateReply UpdateProductReply
+	RequestTestAPIWithReply(t, nc, productAPI+".UPDATE", "", []byte(`{"name":"validation_test","setting":`+invalidSetting+`}`), &updateReply)
+	require.NotNil(t, updateReply.Error)
+	assert.Equal(t, 44400, updateReply.Error.Code)
+	assert.Len(t, updateReply.Errors, 7)
+
+	current, err := sys.productRPC.productManager.GetProduct("validation_test")
+	require.Nil(t, err)
+	assert.Empty(t, current.Rules)
+
+	// Valid setting
+	validSetting := `{
+		"name": "validation_test",
+		"stream": "` + setting.Stream + `",
+		"schema": { "id": { "type": "int" }, "name": { "type": "string" } },
+		"rules": {
+			"rule1": { "event": "dataCreated", "method": "insert", "primaryKey": [ "id" ], "handler": { "type": "script", "script": "return source" } }
+		}
+	}`
+
+	updateReply = UpdateProductReply{}
+	RequestTestAPIWithReply(t, nc, productAPI+".UPDATE", "", []byte(`{"name":"validation_test","setting":`+validSetting+`}`), &updateReply)
+	require.Nil(t, updateReply.Error)
+	assert.Empty(t, updateReply.Errors)
+	assert.Len(t, updateReply.Setting.Rules, 1)
+}
@@ -37,6 +37,7 @@ type Route struct {
 	prefix      string
 	rpc         *RPC
 	middlewares []RPCHandler
+	paths       []string
 }
 
 func NewRoute(rpc *RPC, prefix string, middlewares ...RPCHandler) *Route {
@@ -54,6 +55,7 @@ func (r *Route) Use(handlers ...RPCHandler) {
 func (r *Route) Handle(apiPath string, handlers ...RPCHandler) {
 
 	uri := fmt.Sprintf("%s.%s", r.prefix, apiPath)
+	r.paths = append(r.paths, apiPath)
 
 	logger.Info("Registered API",
 		zap.String("path", uri),
@@ -0,0 +1,107 @@
+package system
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultSigningAlgorithm = "HS256"
+)
+
+var (
+	ErrUnsupportedSigningAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnexpectedSigningMethod     = errors.New("unexpected signing method")
+)
+
+// SigningConfig holds asymmetric key pair for issuing tokens. Tokens are signed with shared secret if it's not configured.
+type SigningConfig struct {
+	Method     jwt.SigningMethod
+	KeyID      string
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+
+	// Accept HS256 tokens which were issued before switching to asymmetric keys
+	AllowLegacy bool
+}
+
+type publicKeyProvider interface {
+	Public() crypto.PublicKey
+}
+
+func loadSigningConfig() (*SigningConfig, error) {
+
+	viper.SetDefault("auth.signing.algorithm", DefaultSigningAlgorithm)
+	viper.SetDefault("auth.signing.allow_legacy", false)
+
+	algorithm := strings.ToUpper(viper.GetString("auth.signing.algorithm"))
+	if len(algorithm) == 0 || algorithm == DefaultSigningAlgorithm {
+		return nil, nil
+	}
+
+	sc := &SigningConfig{
+		KeyID:       viper.GetString("auth.signing.kid"),
+		AllowLegacy: viper.GetBool("auth.signing.allow_legacy"),
+	}
+
+	keyFile := viper.GetString("auth.signing.private_key")
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	switch algorithm {
+	case "RS256":
+		sc.Method = jwt.SigningMethodRS256
+		sc.PrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case "ES256":
+		sc.Method = jwt.SigningMethodES256
+		sc.PrivateKey, err = jwt.ParseECPrivateKeyFromPEM(data)
+	case "EDDSA":
+		sc.Method = jwt.SigningMethodEdDSA
+		sc.PrivateKey, err = jwt.ParseEdPrivateKeyFromPEM(data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSigningAlgorithm, algorithm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sc.PublicKey = sc.PrivateKey.(publicKeyProvider).Public()
+
+	logger.Info("Tokens will be signed with asymmetric key",
+		zap.String("algorithm", sc.Method.Alg()),
+		zap.String("kid", sc.KeyID),
+		zap.Bool("allowLegacy", sc.AllowLegacy),
+	)
+
+	return sc, nil
+}
+
+func (sc *SigningConfig) Sign(claims jwt.Claims) (string, error) {
+
+	t := jwt.NewWithClaims(sc.Method, claims)
+
+	if len(sc.KeyID) > 0 {
+		t.Header["kid"] = sc.KeyID
+	}
+
+	return t.SignedString(sc.PrivateKey)
+}
+
+func (sc *SigningConfig) VerificationKey(token *jwt.Token) (interface{}, error) {
+
+	if token.Method.Alg() != sc.Method.Alg() {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
+	}
+
+	return sc.PublicKey, nil
+}
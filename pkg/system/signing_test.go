@@ -0,0 +1,186 @@
+package system
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-sdk/v2/product"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func WriteTestPrivateKey(t *testing.T, key crypto.PrivateKey) string {
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.Nil(t, err)
+
+	filename := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	require.Nil(t, err)
+
+	return filename
+}
+
+func SetTestConfig(t *testing.T, key string, value interface{}) {
+	viper.Set(key, value)
+	t.Cleanup(func() {
+		viper.Set(key, nil)
+	})
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	testCases := []struct {
+		algorithm string
+		key       crypto.PrivateKey
+	}{
+		{"RS256", rsaKey},
+		{"ES256", ecKey},
+		{"EdDSA", edKey},
+	}
+
+	for _, tc := range testCases {
+
+		t.Run(tc.algorithm, func(t *testing.T) {
+
+			SetTestConfig(t, "auth.signing.algorithm", tc.algorithm)
+			SetTestConfig(t, "auth.signing.private_key", WriteTestPrivateKey(t, tc.key))
+			SetTestConfig(t, "auth.signing.kid", "test_key")
+
+			sys := CreateTestSystem(t)
+			require.NotNil(t, sys.signing)
+
+			jwtString, err := EncodeToken("user", time.Minute)
+			require.Nil(t, err)
+
+			// Checking header
+			token, _, err := jwt.NewParser().ParseUnverified(jwtString, &Claims{})
+			require.Nil(t, err)
+			assert.Equal(t, tc.algorithm, token.Header["alg"])
+			assert.Equal(t, "test_key", token.Header["kid"])
+
+			claims, err := DecodeToken(jwtString)
+			require.Nil(t, err)
+			assert.Equal(t, "user", claims.TokenID)
+
+			// Token signed with shared secret in KV store is disallowed
+			secret := sys.sysConfig.GetEntry("secret").Secret()
+			legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{TokenID: "user"}).SignedString([]byte(secret.Key))
+			require.Nil(t, err)
+
+			_, err = DecodeToken(legacy)
+			assert.ErrorIs(t, err, ErrUnexpectedSigningMethod)
+		})
+	}
+}
+
+func TestIdentityProvider(t *testing.T) {
+
+	idpKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	// Preparing JWKS
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"idp_key","use":"sig","n":"%s","e":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(idpKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idpKey.E)).Bytes()),
+	)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.Nil(t, os.WriteFile(jwksFile, []byte(jwks), 0600))
+
+	SetTestConfig(t, "auth.idp.jwks_file", jwksFile)
+	SetTestConfig(t, "auth.idp.issuer", "https://sso.example.com")
+	SetTestConfig(t, "auth.idp.audience", "gravity")
+	SetTestConfig(t, "auth.idp.groups_claim", "realm_access.roles")
+	SetTestConfig(t, "auth.idp.permissions", map[string][]string{
+		"data-team": {"PRODUCT.LIST", "PRODUCT.INFO"},
+		"admins":    {"ADMIN"},
+	})
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	productAPI := fmt.Sprintf(product.ProductAPI, sys.connector.GetDomain())
+
+	issue := func(key crypto.PrivateKey, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "idp_key"
+		s, err := token.SignedString(key)
+		require.Nil(t, err)
+		return s
+	}
+
+	claims := jwt.MapClaims{
+		"iss": "https://sso.example.com",
+		"aud": "gravity",
+		"sub": "alice",
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"realm_access": map[string]interface{}{
+			"roles": []string{"data-team", "unknown"},
+		},
+	}
+
+	jwtString := issue(idpKey, claims)
+
+	c, err := DecodeToken(jwtString)
+	require.Nil(t, err)
+	assert.True(t, c.External)
+	assert.Equal(t, "idp:alice", c.TokenID)
+	assert.ElementsMatch(t, []string{"PRODUCT.LIST", "PRODUCT.INFO"}, c.Permissions)
+
+	// Permissions were mapped from groups
+	reply := RequestTestAPI(t, nc, productAPI+".LIST", jwtString, []byte(`{}`))
+	assert.Nil(t, reply.Error)
+
+	reply = RequestTestAPI(t, nc, productAPI+".PURGE", jwtString, []byte(`{"name":"test"}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+
+	// Signed with untrusted key
+	untrustedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	_, err = DecodeToken(issue(untrustedKey, claims))
+	assert.NotNil(t, err)
+
+	// Wrong audience
+	claims["aud"] = "others"
+	_, err = DecodeToken(issue(idpKey, claims))
+	assert.NotNil(t, err)
+
+	// Expired
+	claims["aud"] = "gravity"
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = DecodeToken(issue(idpKey, claims))
+	assert.NotNil(t, err)
+
+	// Tokens issued by dispatcher are still available
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+	reply = RequestTestAPI(t, nc, productAPI+".LIST", adminToken, []byte(`{}`))
+	assert.Nil(t, reply.Error)
+}
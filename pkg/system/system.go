@@ -21,9 +21,13 @@ type System struct {
 	connector *connector.Connector
 
 	sysConfig  *Config
+	signing    *SigningConfig
+	idp        *IdentityProvider
 	coreRPC    *CoreRPC
 	productRPC *ProductRPC
 	tokenRPC   *TokenRPC
+	ruleTester RuleTester
+	election   *Election
 }
 
 func New(lifecycle fx.Lifecycle, config *configs.Config, l *zap.Logger, c *connector.Connector) *System {
@@ -40,9 +44,10 @@ func New(lifecycle fx.Lifecycle, config *configs.Config, l *zap.Logger, c *conne
 	lifecycle.Append(
 		fx.Hook{
 			OnStart: func(context.Context) error {
-				return system.initialize()
+				return s.initialize()
 			},
 			OnStop: func(ctx context.Context) error {
+				s.election.Stop()
 				return nil
 			},
 		},
@@ -53,6 +58,18 @@ func New(lifecycle fx.Lifecycle, config *configs.Config, l *zap.Logger, c *conne
 
 func (system *System) initialize() error {
 
+	// Replicas elect a leader to provision resources
+	system.election = NewElection(
+		system.connector.GetClient(),
+		system.connector.GetDomain(),
+		system.config != nil && system.config.Replicas > 1,
+	)
+
+	err := system.election.Start()
+	if err != nil {
+		return err
+	}
+
 	logger.Info("Loading system configuration...")
 
 	// Initialize system configuration
@@ -61,9 +78,24 @@ func (system *System) initialize() error {
 		return errors.New("Failed to create config client")
 	}
 
+	// Keys for tokens
+	signing, err := loadSigningConfig()
+	if err != nil {
+		return err
+	}
+
+	system.signing = signing
+
+	idp, err := loadIdentityProvider()
+	if err != nil {
+		return err
+	}
+
+	system.idp = idp
+
 	// Initializing RPC hanlers
 	system.coreRPC = NewCoreRPC(system)
-	err := system.coreRPC.initialize()
+	err = system.coreRPC.initialize()
 	if err != nil {
 		return err
 	}
@@ -82,3 +114,8 @@ func (system *System) initialize() error {
 
 	return nil
 }
+
+// GetElection returns leader election of replicas
+func (system *System) GetElection() *Election {
+	return system.election
+}
@@ -0,0 +1,138 @@
+package system
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/configs"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/connector"
+	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/types/product_setting"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func StartTestServer(t *testing.T) *server.Server {
+
+	opts := &server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	}
+
+	s, err := server.NewServer(opts)
+	require.Nil(t, err)
+
+	go s.Start()
+
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server is not ready")
+	}
+
+	t.Cleanup(s.Shutdown)
+
+	return s
+}
+
+func CreateTestSystem(t *testing.T) *System {
+
+	s := StartTestServer(t)
+
+	viper.Set("gravity.domain", "default")
+	viper.Set("gravity.host", "127.0.0.1")
+	viper.Set("gravity.port", s.Addr().(*net.TCPAddr).Port)
+
+	lc := fxtest.NewLifecycle(t)
+	c := connector.New(lc, zap.NewNop())
+	sys := New(lc, &configs.Config{}, zap.NewNop(), c)
+	lc.RequireStart()
+	t.Cleanup(func() {
+		lc.RequireStop()
+	})
+
+	// Waiting for configurations to be loaded
+	require.Eventually(t, func() bool {
+		return sys.sysConfig.configManager.GetEntry("secret") != nil &&
+			sys.sysConfig.configManager.GetEntry("auth") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return sys
+}
+
+func EnableTestAuth(t *testing.T, sys *System) {
+
+	err := sys.sysConfig.configManager.SetEntry("auth", []byte(`{"enabled":true}`))
+	require.Nil(t, err)
+
+	require.Eventually(t, func() bool {
+		return sys.sysConfig.GetEntry("auth").Auth().Enabled
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func CreateTestConnection(t *testing.T, sys *System) *nats.Conn {
+
+	nc, err := nats.Connect(sys.connector.GetClient().GetConnection().ConnectedUrl())
+	require.Nil(t, err)
+
+	t.Cleanup(nc.Close)
+
+	return nc
+}
+
+func RequestTestAPI(t *testing.T, nc *nats.Conn, subject string, jwt string, data []byte) *ErrorRPCState {
+
+	reply := &ErrorRPCState{}
+	RequestTestAPIWithReply(t, nc, subject, jwt, data, reply)
+
+	return reply
+}
+
+func RequestTestAPIWithReply(t *testing.T, nc *nats.Conn, subject string, jwt string, data []byte, reply interface{}) {
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+
+	if len(jwt) > 0 {
+		msg.Header.Set("Authorization", jwt)
+	}
+
+	resp, err := nc.RequestMsg(msg, 5*time.Second)
+	require.Nil(t, err, subject)
+
+	if len(resp.Data) > 0 {
+		err = json.Unmarshal(resp.Data, reply)
+		require.Nil(t, err, subject)
+	}
+}
+
+func CreateTestProduct(t *testing.T, sys *System, name string) *product_setting.ProductSetting {
+
+	domain := sys.connector.GetDomain()
+
+	setting := product_setting.NewProductSetting()
+	setting.Name = name
+	setting.Enabled = true
+	setting.Stream = fmt.Sprintf("GVT_%s_DP_%s", domain, name)
+
+	js, err := sys.connector.GetClient().GetJetStream()
+	require.Nil(t, err)
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     setting.Stream,
+		Subjects: []string{fmt.Sprintf("$GVT.%s.DP.%s.>", domain, name)},
+	})
+	require.Nil(t, err)
+
+	_, err = sys.productRPC.productManager.CreateProduct(setting)
+	require.Nil(t, err)
+
+	return setting
+}
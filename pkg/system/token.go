@@ -3,6 +3,7 @@ package system
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/BrobridgeOrg/gravity-dispatcher/pkg/connector"
 	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
@@ -61,6 +62,8 @@ func (trpc *TokenRPC) initialize() error {
 	route.Handle("UPDATE", RequiredPermissions("TOKEN.UPDATE"), trpc.update)
 	route.Handle("DELETE", RequiredPermissions("TOKEN.DELETE"), trpc.delete)
 	route.Handle("INFO", RequiredPermissions("TOKEN.INFO"), trpc.info)
+	route.Handle("REVOKE", RequiredPermissions("TOKEN.REVOKE"), trpc.revoke)
+	route.Handle("ROTATE_KEY", RequiredPermissions("ADMIN"), trpc.rotateKey)
 
 	return nil
 }
@@ -116,7 +119,7 @@ func (trpc *TokenRPC) create(ctx *RPCContext) {
 	ctx.Res.Data = resp
 
 	// Parsing request
-	var req token.CreateTokenRequest
+	var req CreateTokenRequest
 	err := json.Unmarshal(ctx.Req.Data, &req)
 	if err != nil {
 		ctx.Res.Error = err
@@ -155,7 +158,7 @@ func (trpc *TokenRPC) create(ctx *RPCContext) {
 	}
 
 	// Encode token to JWT
-	jwtString, err := EncodeToken(req.TokenID)
+	jwtString, err := EncodeToken(req.TokenID, time.Duration(req.TTL)*time.Second)
 	if err != nil {
 		ctx.Res.Error = err
 		resp.Error = InternalServerErr()
@@ -252,7 +255,7 @@ func (trpc *TokenRPC) info(ctx *RPCContext) {
 	ctx.Res.Data = resp
 
 	// Parsing request
-	var req token.InfoTokenRequest
+	var req InfoTokenRequest
 	err := json.Unmarshal(ctx.Req.Data, &req)
 	if err != nil {
 		ctx.Res.Error = err
@@ -277,6 +280,106 @@ func (trpc *TokenRPC) info(ctx *RPCContext) {
 		return
 	}
 
-	resp.Token, _ = EncodeToken(req.TokenID)
+	resp.Token, _ = EncodeToken(req.TokenID, time.Duration(req.TTL)*time.Second)
 	resp.Setting = setting
 }
+
+func (trpc *TokenRPC) revoke(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &RevokeTokenReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req RevokeTokenRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Only valid JWT is able to be revoked
+	claims, err := DecodeToken(req.Token)
+	if err != nil {
+		resp.Error = &core.Error{
+			Code:    44409,
+			Message: "Invalid token",
+		}
+		return
+	}
+
+	if len(claims.Id) == 0 {
+		resp.Error = &core.Error{
+			Code:    44400,
+			Message: "Token without ID cannot be revoked",
+		}
+		return
+	}
+
+	var expiresAt time.Time
+	if claims.ExpiresAt > 0 {
+		expiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+
+	err = system.sysConfig.RevokeToken(claims.Id, expiresAt)
+	if err != nil {
+		ctx.Res.Error = err
+
+		if err == internal.ErrRevocationListFull {
+			resp.Error = &core.Error{
+				Code:    44400,
+				Message: "Revocation list is full, signing key should be rotated",
+			}
+		} else {
+			resp.Error = InternalServerErr()
+		}
+
+		return
+	}
+}
+
+func (trpc *TokenRPC) rotateKey(ctx *RPCContext) {
+
+	// Prepare response message
+	resp := &RotateKeyReply{}
+	ctx.Res.Data = resp
+
+	// Parsing request
+	var req RotateKeyRequest
+	err := json.Unmarshal(ctx.Req.Data, &req)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	// Asymmetric key is managed by configuration
+	if system.signing != nil {
+		resp.Error = &core.Error{
+			Code:    44400,
+			Message: "Signing key is managed by configuration",
+		}
+		return
+	}
+
+	gracePeriod := DefaultKeyRotationGracePeriod
+	if req.GracePeriod > 0 {
+		gracePeriod = time.Duration(req.GracePeriod) * time.Second
+	}
+
+	// Generate a new signing key
+	secret, err := system.sysConfig.RotateSecret(gracePeriod)
+	if err != nil {
+		ctx.Res.Error = err
+		resp.Error = InternalServerErr()
+		return
+	}
+
+	logger.Info("Signing key was rotated",
+		zap.String("kid", secret.KeyID),
+		zap.Duration("gracePeriod", gracePeriod),
+	)
+
+	resp.KeyID = secret.KeyID
+}
@@ -0,0 +1,199 @@
+package system
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	internal "github.com/BrobridgeOrg/gravity-dispatcher/pkg/system/internal"
+	"github.com/BrobridgeOrg/gravity-sdk/v2/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenExpiration(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	tokenAPI := fmt.Sprintf(token.TokenAPI, sys.connector.GetDomain())
+
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+
+	// Issue a short-lived JWT
+	var reply token.InfoTokenReply
+	RequestTestAPIWithReply(t, nc, tokenAPI+".INFO", adminToken, []byte(`{"token":"admin","ttl":1}`), &reply)
+	require.Nil(t, reply.Error)
+
+	claims, err := DecodeToken(reply.Token)
+	require.Nil(t, err)
+	assert.NotEmpty(t, claims.Id)
+	assert.NotZero(t, claims.ExpiresAt)
+
+	require.Eventually(t, func() bool {
+		_, err := DecodeToken(reply.Token)
+		return err != nil
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// JWT without TTL never expires
+	claims, err = DecodeToken(adminToken)
+	require.Nil(t, err)
+	assert.Zero(t, claims.ExpiresAt)
+}
+
+func TestTokenRevocation(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	tokenAPI := fmt.Sprintf(token.TokenAPI, sys.connector.GetDomain())
+
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+	userToken := CreateTestToken(t, sys, "user", "TOKEN.LIST")
+
+	// Another JWT of the same token
+	anotherUserToken, err := EncodeToken("user", 0)
+	require.Nil(t, err)
+
+	reply := RequestTestAPI(t, nc, tokenAPI+".LIST", userToken, []byte(`{}`))
+	require.Nil(t, reply.Error)
+
+	reply = RequestTestAPI(t, nc, tokenAPI+".REVOKE", adminToken, []byte(fmt.Sprintf(`{"token":"%s"}`, userToken)))
+	require.Nil(t, reply.Error)
+
+	require.Eventually(t, func() bool {
+		_, err := DecodeToken(userToken)
+		return err == ErrTokenRevoked
+	}, 5*time.Second, 10*time.Millisecond)
+
+	reply = RequestTestAPI(t, nc, tokenAPI+".LIST", userToken, []byte(`{}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+
+	// Other JWTs are not affected
+	reply = RequestTestAPI(t, nc, tokenAPI+".LIST", anotherUserToken, []byte(`{}`))
+	assert.Nil(t, reply.Error)
+}
+
+func TestTokenConcurrentRevocation(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	tokenAPI := fmt.Sprintf(token.TokenAPI, sys.connector.GetDomain())
+
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+	CreateTestToken(t, sys, "user", "TOKEN.LIST")
+
+	jwts := make([]string, 10)
+	for i := range jwts {
+		jwt, err := EncodeToken("user", time.Hour)
+		require.Nil(t, err)
+		jwts[i] = jwt
+	}
+
+	// All revocations update the same revocation list
+	var wg sync.WaitGroup
+	for _, jwt := range jwts {
+		wg.Add(1)
+		go func(jwt string) {
+			defer wg.Done()
+			reply := RequestTestAPI(t, nc, tokenAPI+".REVOKE", adminToken, []byte(fmt.Sprintf(`{"token":"%s"}`, jwt)))
+			assert.Nil(t, reply.Error)
+		}(jwt)
+	}
+
+	wg.Wait()
+
+	require.Eventually(t, func() bool {
+		for _, jwt := range jwts {
+			if _, err := DecodeToken(jwt); err != ErrTokenRevoked {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTokenRevocationListFull(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	tokenAPI := fmt.Sprintf(token.TokenAPI, sys.connector.GetDomain())
+
+	maxRevokedTokens := internal.MaxRevokedTokens
+	internal.MaxRevokedTokens = 1
+	t.Cleanup(func() {
+		internal.MaxRevokedTokens = maxRevokedTokens
+	})
+
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+	CreateTestToken(t, sys, "user", "TOKEN.LIST")
+
+	first, err := EncodeToken("user", 0)
+	require.Nil(t, err)
+
+	second, err := EncodeToken("user", 0)
+	require.Nil(t, err)
+
+	reply := RequestTestAPI(t, nc, tokenAPI+".REVOKE", adminToken, []byte(fmt.Sprintf(`{"token":"%s"}`, first)))
+	require.Nil(t, reply.Error)
+
+	// Revocation list is full
+	reply = RequestTestAPI(t, nc, tokenAPI+".REVOKE", adminToken, []byte(fmt.Sprintf(`{"token":"%s"}`, second)))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44400, reply.Error.Code)
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+
+	sys := CreateTestSystem(t)
+	EnableTestAuth(t, sys)
+	nc := CreateTestConnection(t, sys)
+
+	tokenAPI := fmt.Sprintf(token.TokenAPI, sys.connector.GetDomain())
+
+	adminToken := CreateTestToken(t, sys, "admin", "ADMIN")
+	userToken := CreateTestToken(t, sys, "user", "TOKEN.LIST")
+
+	// Only administrator is able to rotate key
+	reply := RequestTestAPI(t, nc, tokenAPI+".ROTATE_KEY", userToken, []byte(`{}`))
+	require.NotNil(t, reply.Error)
+	assert.Equal(t, 44403, reply.Error.Code)
+
+	var rotateReply RotateKeyReply
+	RequestTestAPIWithReply(t, nc, tokenAPI+".ROTATE_KEY", adminToken, []byte(`{"gracePeriod":2}`), &rotateReply)
+	require.Nil(t, rotateReply.Error)
+	require.NotEmpty(t, rotateReply.KeyID)
+
+	require.Eventually(t, func() bool {
+		return sys.sysConfig.GetEntry("secret").Secret().KeyID == rotateReply.KeyID
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Old JWT is still valid in grace period
+	_, err := DecodeToken(userToken)
+	assert.Nil(t, err)
+
+	// New JWT is signed with new key
+	newUserToken, err := EncodeToken("user", 0)
+	require.Nil(t, err)
+
+	claims, err := DecodeToken(newUserToken)
+	require.Nil(t, err)
+	assert.Equal(t, "user", claims.TokenID)
+
+	// Old key is expired
+	require.Eventually(t, func() bool {
+		_, err := DecodeToken(userToken)
+		return err != nil
+	}, 5*time.Second, 100*time.Millisecond)
+
+	reply = RequestTestAPI(t, nc, tokenAPI+".LIST", newUserToken, []byte(`{}`))
+	assert.Nil(t, reply.Error)
+}
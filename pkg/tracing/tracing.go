@@ -0,0 +1,198 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var logger *zap.Logger
+
+const (
+	DefaultExporter    = ExporterNone
+	DefaultEndpoint    = "localhost:4318"
+	DefaultInsecure    = true
+	DefaultSampleRatio = 1.0
+	DefaultServiceName = "gravity-dispatcher"
+)
+
+// Exporters for spans
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const instrumentationName = "github.com/BrobridgeOrg/gravity-dispatcher"
+
+// Trace context is always propagated with W3C headers, no matter what global propagator is
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Tracing initializes tracer provider which exports spans of dispatcher
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+}
+
+func New(lifecycle fx.Lifecycle, l *zap.Logger) *Tracing {
+
+	logger = l.Named("Tracing")
+
+	t := &Tracing{}
+
+	lifecycle.Append(
+		fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				return t.start(ctx)
+			},
+			OnStop: func(ctx context.Context) error {
+				return t.stop(ctx)
+			},
+		},
+	)
+
+	return t
+}
+
+func (t *Tracing) start(ctx context.Context) error {
+
+	viper.SetDefault("tracing.exporter", DefaultExporter)
+	viper.SetDefault("tracing.endpoint", DefaultEndpoint)
+	viper.SetDefault("tracing.insecure", DefaultInsecure)
+	viper.SetDefault("tracing.sample_ratio", DefaultSampleRatio)
+	viper.SetDefault("tracing.service_name", DefaultServiceName)
+
+	exporterType := viper.GetString("tracing.exporter")
+	endpoint := viper.GetString("tracing.endpoint")
+	sampleRatio := viper.GetFloat64("tracing.sample_ratio")
+	serviceName := viper.GetString("tracing.service_name")
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch exporterType {
+	case ExporterNone, "":
+		return nil
+	case ExporterOTLP:
+
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint),
+		}
+
+		if viper.GetBool("tracing.insecure") {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	default:
+		return fmt.Errorf("unknown tracing exporter: %s", exporterType)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Initializing tracer provider",
+		zap.String("exporter", exporterType),
+		zap.String("endpoint", endpoint),
+		zap.Float64("sample_ratio", sampleRatio),
+	)
+
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+
+	otel.SetTracerProvider(t.provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return nil
+}
+
+func (t *Tracing) stop(ctx context.Context) error {
+
+	if t.provider == nil {
+		return nil
+	}
+
+	// Flush spans which were not exported yet
+	return t.provider.Shutdown(ctx)
+}
+
+// Tracer returns tracer of dispatcher from global tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start creates a span from global tracer provider
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records error if it exists, then ends span
+func End(span trace.Span, err error) {
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// HeaderCarrier adapts nats.Header to propagation.TextMapCarrier. Keys are kept as they are because
+// headers of NATS are case-sensitive.
+type HeaderCarrier nats.Header
+
+func (hc HeaderCarrier) Get(key string) string {
+	return nats.Header(hc).Get(key)
+}
+
+func (hc HeaderCarrier) Set(key string, value string) {
+	nats.Header(hc).Set(key, value)
+}
+
+func (hc HeaderCarrier) Keys() []string {
+
+	keys := make([]string, 0, len(hc))
+	for k := range hc {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// Extract returns context which continues trace from headers of incoming message
+func Extract(ctx context.Context, header nats.Header) context.Context {
+
+	if header == nil {
+		return ctx
+	}
+
+	return propagator.Extract(ctx, HeaderCarrier(header))
+}
+
+// Inject writes trace context to headers of outgoing message
+func Inject(ctx context.Context, header nats.Header) {
+	propagator.Inject(ctx, HeaderCarrier(header))
+}
@@ -0,0 +1,37 @@
+package dispatch_state
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// States of circuit breaker
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// State is the state of dispatching events to product stream.
+type State struct {
+	Breaker   string    `json:"breaker"`             // closed, open or half-open
+	Failures  int       `json:"failures"`            // Consecutive failures since the last success.
+	LastError string    `json:"lastError,omitempty"` // The last error of publishing.
+	OpenedAt  time.Time `json:"openedAt,omitempty"`  // Timestamp of opening circuit breaker.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func Unmarshal(data []byte) (*State, error) {
+
+	var s State
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *State) Marshal() ([]byte, error) {
+	return json.Marshal(s)
+}
@@ -0,0 +1,39 @@
+package dry_run
+
+import (
+	"encoding/json"
+)
+
+// Event is a sample event to be processed by rules without publishing.
+type Event struct {
+	Event   string          `json:"event"`   // Name of event, the event of rule will be used if it's empty.
+	Payload json.RawMessage `json:"payload"` // Payload of event in JSON.
+}
+
+// Result describes what dispatcher would do with a sample event.
+type Result struct {
+	Event   string        `json:"event"`
+	Matched bool          `json:"matched"` // Event matched rules and passed their filters.
+	Rules   []string      `json:"rules"`   // Rules which were applied.
+	Outputs []*Output     `json:"outputs"` // Product events which would be published.
+	Errors  []*StageError `json:"errors,omitempty"`
+}
+
+// Output is a product event which would be published to product stream.
+type Output struct {
+	Subject     string                 `json:"subject"`
+	Partition   int32                  `json:"partition"`
+	Event       string                 `json:"event"`
+	Method      string                 `json:"method"`
+	Table       string                 `json:"table"`
+	PrimaryKeys []string               `json:"primaryKeys"`
+	PrimaryKey  []byte                 `json:"primaryKey"`
+	Payload     map[string]interface{} `json:"payload"`
+}
+
+// StageError is an error which occurred at specific stage of processing.
+type StageError struct {
+	Stage string `json:"stage"` // parse, transform or convert
+	Rule  string `json:"rule,omitempty"`
+	Error string `json:"error"`
+}
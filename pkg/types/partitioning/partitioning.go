@@ -0,0 +1,86 @@
+package partitioning
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultPartitions = 256
+	MaxPartitions     = 4096
+)
+
+// Strategies of partitioning
+const (
+	ByPrimaryKey = "primaryKey" // Hash of primary key (default)
+	ByField      = "field"      // Hash of specific field of product event
+	ByRoundRobin = "roundRobin" // Distribute events evenly, there is no ordering between events
+	BySingle     = "single"     // All events go to the first partition for strict global ordering
+)
+
+// Range is partitioning which was applied to events of product stream since StartSeq.
+type Range struct {
+	Partitions  int       `json:"partitions"`
+	PartitionBy string    `json:"partitionBy"`
+	Field       string    `json:"field,omitempty"`
+	StartSeq    uint64    `json:"startSeq"` // The first sequence of product stream with this partitioning.
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Equal reports whether partitioning of both ranges is the same
+func (r *Range) Equal(other *Range) bool {
+	return r.Partitions == other.Partitions &&
+		r.PartitionBy == other.PartitionBy &&
+		r.Field == other.Field
+}
+
+// History keeps partitioning which was applied to product stream in ascending order of StartSeq.
+type History struct {
+	Ranges []*Range `json:"ranges"`
+}
+
+func Unmarshal(data []byte) (*History, error) {
+
+	var h History
+	err := json.Unmarshal(data, &h)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(h.Ranges, func(i, j int) bool {
+		return h.Ranges[i].StartSeq < h.Ranges[j].StartSeq
+	})
+
+	return &h, nil
+}
+
+func (h *History) Marshal() ([]byte, error) {
+	return json.Marshal(h)
+}
+
+// Current returns partitioning which is in use, it returns nil if nothing was recorded
+func (h *History) Current() *Range {
+
+	if len(h.Ranges) == 0 {
+		return nil
+	}
+
+	return h.Ranges[len(h.Ranges)-1]
+}
+
+// Find returns partitioning which was applied to event at specific sequence of product stream
+func (h *History) Find(seq uint64) *Range {
+
+	var found *Range
+	for _, r := range h.Ranges {
+
+		if r.StartSeq > seq {
+			break
+		}
+
+		found = r
+	}
+
+	return found
+}
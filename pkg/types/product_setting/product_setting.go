@@ -0,0 +1,75 @@
+package product_setting
+
+import (
+	product_sdk "github.com/BrobridgeOrg/gravity-sdk/v2/product"
+)
+
+// ProductSetting extends the product setting of SDK with options which are supported by dispatcher.
+type ProductSetting struct {
+	product_sdk.ProductSetting
+	Rules       map[string]*Rule `json:"rules"`                 // A map of event handling rules associated with the product.
+	RetryPolicy *RetryPolicy     `json:"retryPolicy,omitempty"` // Policy for retrying events which were failed to be published.
+
+	// Partitioning of product stream
+	Partitions     int    `json:"partitions,omitempty"`     // Number of partitions, 256 by default.
+	PartitionBy    string `json:"partitionBy,omitempty"`    // primaryKey (default), field, roundRobin or single.
+	PartitionField string `json:"partitionField,omitempty"` // Field of product event to be hashed for "field" partitioning.
+}
+
+func NewProductSetting() *ProductSetting {
+	return &ProductSetting{
+		Rules: make(map[string]*Rule),
+	}
+}
+
+// RetryPolicy controls how dispatcher retries to publish events. Events are never dropped, the circuit breaker
+// will be opened after too many attempts and then probe again after cooldown.
+type RetryPolicy struct {
+	MaxAttempts     int     `json:"maxAttempts,omitempty"`     // Attempts before opening circuit breaker.
+	InitialInterval string  `json:"initialInterval,omitempty"` // Delay before the first retry (e.g. "500ms").
+	MaxInterval     string  `json:"maxInterval,omitempty"`     // Upper bound of delay between retries.
+	Multiplier      float64 `json:"multiplier,omitempty"`      // Factor for increasing delay after every attempt.
+	Jitter          float64 `json:"jitter,omitempty"`          // Fraction of delay to be randomized, between 0 and 1.
+	Cooldown        string  `json:"cooldown,omitempty"`        // How long circuit breaker stays open before probing.
+}
+
+// Rule extends the rule of SDK with options which are supported by dispatcher.
+type Rule struct {
+	product_sdk.Rule
+	Priority      int            `json:"priority"`          // Rules with higher priority will be evaluated first.
+	StopOnMatch   bool           `json:"stopOnMatch"`       // Do not evaluate rules with lower priority if this rule was matched.
+	Filter        *Filter        `json:"filter,omitempty"`  // Only events which match the filter will be handled by this rule.
+	HandlerConfig *HandlerConfig `json:"handler,omitempty"` // Optional configuration for the handler responsible for executing the rule.
+}
+
+func NewRule() *Rule {
+	return &Rule{}
+}
+
+// HandlerConfig extends the handler config of SDK with declarative handlers which are executed without script runtime.
+type HandlerConfig struct {
+	Type      string                 `json:"type"`                // script, mapping, constant or cast
+	Script    string                 `json:"script"`              // Script for "script" handler.
+	Mapping   []*FieldMapping        `json:"mapping,omitempty"`   // Field operations for "mapping" handler, applied in order.
+	Constants map[string]interface{} `json:"constants,omitempty"` // Values to be injected by "constant" handler.
+}
+
+// FieldMapping describes an operation on a top-level field of the event payload.
+type FieldMapping struct {
+	Action string `json:"action,omitempty"` // rename (default), copy or drop
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+}
+
+// Filter is a set of conditions which are evaluated against the event payload before transformation.
+type Filter struct {
+	Match      string       `json:"match,omitempty"` // "all" (default) or "any" of conditions must be satisfied.
+	Conditions []*Condition `json:"conditions"`
+}
+
+// Condition checks a field of the event payload. Nested fields are separated by dots (e.g. "user.region").
+type Condition struct {
+	Field    string      `json:"field"`
+	Operator string      `json:"operator"` // eq, ne, gt, gte, lt, lte, in, nin, exists, notExists
+	Value    interface{} `json:"value,omitempty"`
+}
@@ -0,0 +1,93 @@
+package snapshot_record
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	gravity_sdk_types_product_event "github.com/BrobridgeOrg/gravity-sdk/v2/types/product_event"
+	record_type "github.com/BrobridgeOrg/gravity-sdk/v2/types/record"
+)
+
+// Record is the latest state of a primary key in snapshot store.
+type Record struct {
+	Seq   uint64 `json:"seq"`   // Sequence of product stream which was applied lastly.
+	Event []byte `json:"event"` // Product event which contains the whole record.
+}
+
+// EncodeKey converts primary key to the key of snapshot store.
+func EncodeKey(pk []byte) string {
+	return base64.RawURLEncoding.EncodeToString(pk)
+}
+
+func Unmarshal(data []byte) (*Record, error) {
+
+	var r Record
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (r *Record) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *Record) GetProductEvent() (*gravity_sdk_types_product_event.ProductEvent, error) {
+
+	var pe gravity_sdk_types_product_event.ProductEvent
+	err := gravity_sdk_types_product_event.Unmarshal(r.Event, &pe)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pe, nil
+}
+
+// Apply returns the new state of record after applying product event. Nil will be returned if record was deleted.
+// Truncation is not handled here because it affects all records.
+func Apply(orig *Record, pe *gravity_sdk_types_product_event.ProductEvent, seq uint64) (*Record, error) {
+
+	switch pe.Method {
+	case gravity_sdk_types_product_event.Method_DELETE:
+		return nil, nil
+	case gravity_sdk_types_product_event.Method_UPDATE:
+
+		if orig == nil {
+			break
+		}
+
+		// Merge changes into the existing record
+		origEvent, err := orig.GetProductEvent()
+		if err != nil {
+			return nil, err
+		}
+
+		origRecord, err := origEvent.GetContent()
+		if err != nil {
+			return nil, err
+		}
+
+		updates, err := pe.GetContent()
+		if err != nil {
+			return nil, err
+		}
+
+		origEvent.EventName = pe.EventName
+		origEvent.Method = pe.Method
+		origEvent.Data = record_type.Merge(origRecord, updates)
+
+		pe = origEvent
+	}
+
+	data, err := gravity_sdk_types_product_event.Marshal(pe)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Record{
+		Seq:   seq,
+		Event: data,
+	}, nil
+}